@@ -6,6 +6,7 @@ import (
 	"github.com/nj-eka/fdups/errs"
 	"github.com/nj-eka/fdups/logging"
 	"github.com/nj-eka/fdups/registrator"
+	"sync"
 )
 
 type ErrorProducer interface {
@@ -17,33 +18,49 @@ type ErrorStats registrator.Encounter
 type ErrorModerator interface {
 	Run(ctx context.Context) <-chan struct{}
 	Stats() interface{}
+	// Err returns reason of aborting run by error policy (nil if run is not aborted)
+	Err() error
 }
 
 type errorModerator struct {
+	sync.RWMutex
 	done  <-chan struct{}
 	stats ErrorStats
+	err   error
 }
 
-func NewErrorModerator(ctx context.Context, cancel context.CancelFunc, errProducers ...ErrorProducer) (ErrorModerator, errs.Error) {
+// NewErrorModerator handles errors of producers according to policy (see Policy), cancel is called if run is aborted by policy;
+// reporter (optional) receives every error
+func NewErrorModerator(ctx context.Context, cancel context.CancelFunc, policy Policy, reporter ErrorReporter, errProducers ...ErrorProducer) (ErrorModerator, errs.Error) {
 	ctx = cu.BuildContext(ctx, cu.SetContextOperation("_.errs_moderation"))
 	errChs := make([]<-chan errs.Error, 0, len(errProducers))
 	for _, errProducer := range errProducers {
 		errChs = append(errChs, errProducer.ErrCh())
 	}
+	r := &errorModerator{}
 	errsCh := MergeErrors(ctx, errChs...)
-	mapSeverity2ErrorCh, totalErrorStats := SortFilteredErrors(ctx, errsCh, logging.GetSeveritiesFilter4CurrentLogLevel())
-	errsDone := MapErrorHandlers(
+	policyErrsCh, totalErrorStats := EnforcePolicy(ctx, errsCh, policy, reporter, func(reason errs.Error) {
+		r.Lock()
+		r.err = reason
+		r.Unlock()
+		logging.LogError(reason)
+		cancel()
+	})
+	mapSeverity2ErrorCh := SortFilteredErrors(ctx, policyErrsCh, logging.GetSeveritiesFilter4CurrentLogLevel())
+	r.done = MapErrorHandlers(
 		ctx,
 		mapSeverity2ErrorCh,
-		nil, // map[errs.Severity]FuncErrorHandler{
-		//	errs.SeverityCritical: erf.CriticalErrorHandlerBuilder(cancel, []errs.Kind{...}),
-		//}
+		nil,
 		LoggingErrorHandler,
 	)
-	return &errorModerator{
-		done:  errsDone,
-		stats: totalErrorStats,
-	}, nil
+	r.stats = totalErrorStats
+	return r, nil
+}
+
+func (r *errorModerator) Err() error {
+	r.RLock()
+	defer r.RUnlock()
+	return r.err
 }
 
 func (r *errorModerator) Run(context.Context) <-chan struct{} {
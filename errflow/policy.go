@@ -0,0 +1,243 @@
+package errflow
+
+import (
+	"context"
+	"fmt"
+	cu "github.com/nj-eka/fdups/contexts"
+	"github.com/nj-eka/fdups/errs"
+	"github.com/nj-eka/fdups/logging"
+	"github.com/nj-eka/fdups/registrator"
+	"strconv"
+	"strings"
+)
+
+// Action - what is done with error
+type Action int
+
+const (
+	ActionLog    Action = iota // error is logged (according to log level) and counted - default
+	ActionCount                // error is counted only
+	ActionIgnore               // error is neither logged nor counted
+	ActionAbort                // error is logged and counted, then run is aborted
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionLog:
+		return "log"
+	case ActionCount:
+		return "count"
+	case ActionIgnore:
+		return "ignore"
+	case ActionAbort:
+		return "abort"
+	}
+	return "unknown"
+}
+
+func ParseAction(name string) (Action, error) {
+	for _, action := range []Action{ActionLog, ActionCount, ActionIgnore, ActionAbort} {
+		if action.String() == strings.ToLower(strings.TrimSpace(name)) {
+			return action, nil
+		}
+	}
+	return ActionLog, fmt.Errorf("unknown error action [%s]: expected log, count, ignore or abort", name)
+}
+
+// Selector - selects errors by kind and / or severity (nil = any)
+type Selector struct {
+	Kind     *errs.Kind
+	Severity *errs.Severity
+}
+
+const selectorAny = "total"
+
+// ParseSelector parses selector in format: kind | severity | kind:severity | total (any error);
+// kinds are given by short names (see errs.ParseKind), severities - by wrn, err, cri
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == selectorAny || s == "*" {
+		return sel, nil
+	}
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) == 2 {
+		kind, err := errs.ParseKind(parts[0])
+		if err != nil {
+			return sel, err
+		}
+		severity, err := errs.ParseSeverity(parts[1])
+		if err != nil {
+			return sel, err
+		}
+		sel.Kind, sel.Severity = &kind, &severity
+		return sel, nil
+	}
+	if severity, err := errs.ParseSeverity(s); err == nil {
+		sel.Severity = &severity
+		return sel, nil
+	}
+	kind, err := errs.ParseKind(s)
+	if err != nil {
+		return sel, fmt.Errorf("invalid error selector [%s]: neither kind nor severity", s)
+	}
+	sel.Kind = &kind
+	return sel, nil
+}
+
+func (sel Selector) Match(err errs.Error) bool {
+	return (sel.Kind == nil || *sel.Kind == err.Kind()) && (sel.Severity == nil || *sel.Severity == err.Severity())
+}
+
+// specificity - selector by kind and severity is more specific than by kind only, that is more specific than by severity only
+func (sel Selector) specificity() (result int) {
+	if sel.Kind != nil {
+		result += 2
+	}
+	if sel.Severity != nil {
+		result++
+	}
+	return
+}
+
+func (sel Selector) String() string {
+	switch {
+	case sel.Kind != nil && sel.Severity != nil:
+		return sel.Kind.Name() + ":" + sel.Severity.String()
+	case sel.Kind != nil:
+		return sel.Kind.Name()
+	case sel.Severity != nil:
+		return sel.Severity.String()
+	}
+	return selectorAny
+}
+
+// Rule - action for errors matched selector
+type Rule struct {
+	Selector
+	Action Action
+}
+
+// Budget - max number of errors matched selector, run is aborted as soon as it is reached
+type Budget struct {
+	Selector
+	Limit int
+}
+
+func (b Budget) String() string {
+	return fmt.Sprintf("%s=%d", b.Selector, b.Limit)
+}
+
+// Policy - error handling policy: the most specific matched rule defines action (ActionLog if none is matched),
+// budgets limit number of errors before run is aborted
+type Policy struct {
+	Rules   []Rule
+	Budgets []Budget
+}
+
+// ParsePolicy parses rules in format [selector=action] and budgets in format [selector=limit] (see ParseSelector)
+// examples: permission=count, wrn=ignore, io:cri=abort; io=1000, total=100000
+func ParsePolicy(rules, budgets []string) (Policy, error) {
+	var policy Policy
+	for _, rule := range rules {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 {
+			return policy, fmt.Errorf("invalid error policy rule [%s]: expected selector=action", rule)
+		}
+		sel, err := ParseSelector(parts[0])
+		if err != nil {
+			return policy, fmt.Errorf("invalid error policy rule [%s]: %w", rule, err)
+		}
+		action, err := ParseAction(parts[1])
+		if err != nil {
+			return policy, fmt.Errorf("invalid error policy rule [%s]: %w", rule, err)
+		}
+		policy.Rules = append(policy.Rules, Rule{sel, action})
+	}
+	for _, budget := range budgets {
+		if strings.TrimSpace(budget) == "" {
+			continue
+		}
+		parts := strings.SplitN(budget, "=", 2)
+		if len(parts) != 2 {
+			return policy, fmt.Errorf("invalid error budget [%s]: expected selector=limit", budget)
+		}
+		sel, err := ParseSelector(parts[0])
+		if err != nil {
+			return policy, fmt.Errorf("invalid error budget [%s]: %w", budget, err)
+		}
+		limit, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || limit <= 0 {
+			return policy, fmt.Errorf("invalid error budget [%s]: limit must be positive integer", budget)
+		}
+		policy.Budgets = append(policy.Budgets, Budget{sel, limit})
+	}
+	return policy, nil
+}
+
+// Action returns action for err (the last of the most specific matched rules wins)
+func (p Policy) Action(err errs.Error) Action {
+	action, specificity := ActionLog, -1
+	for _, rule := range p.Rules {
+		if rule.Match(err) && rule.specificity() >= specificity {
+			action, specificity = rule.Action, rule.specificity()
+		}
+	}
+	return action
+}
+
+// EnforcePolicy counts errors according to policy, calls abort (once) on abort action or exceeded budget
+// and passes through errors to be logged; every error (and abort reason) is reported to reporter (if not nil)
+func EnforcePolicy(ctx context.Context, inputErrCh <-chan errs.Error, policy Policy, reporter ErrorReporter, abort func(reason errs.Error)) (<-chan errs.Error, ErrorStats) {
+	ctx = cu.BuildContext(ctx, cu.AddContextOperation("policy"))
+	outputErrCh := make(chan errs.Error, cap(inputErrCh))
+	stats := ErrorStats(registrator.NewEncounter(len(errs.AllSeverities) * int(errs.KindInternal) * 64))
+	go func() {
+		defer func() {
+			close(outputErrCh)
+			logging.LogMsg(ctx).Debug("Policy errors channel - closed")
+		}()
+		budgetCounts := make([]int, len(policy.Budgets))
+		aborted := false
+		abortOnce := func(reason errs.Error) {
+			if !aborted {
+				aborted = true
+				if reporter != nil {
+					reporter.Report(reason, ActionAbort)
+				}
+				abort(reason)
+			}
+		}
+		for err := range inputErrCh {
+			if err == nil {
+				continue
+			}
+			action := policy.Action(err)
+			if reporter != nil {
+				reporter.Report(err, action)
+			}
+			if action == ActionIgnore {
+				continue
+			}
+			stats.CheckIn(ErrStatKey{err.Severity(), err.Kind(), err.OperationPath().String()})
+			for i, budget := range policy.Budgets {
+				if budget.Match(err) {
+					budgetCounts[i]++
+					if budgetCounts[i] == budget.Limit {
+						abortOnce(errs.E(ctx, errs.SeverityCritical, errs.KindInterrupted, fmt.Errorf("error budget [%s] is exhausted - run is aborted", budget)))
+					}
+				}
+			}
+			if action == ActionAbort {
+				abortOnce(errs.E(ctx, errs.SeverityCritical, errs.KindInterrupted, fmt.Errorf("error of kind [%s] with severity [%s] - run is aborted by policy: %w", err.Kind().Name(), err.Severity(), err)))
+			}
+			if action != ActionCount {
+				outputErrCh <- err
+			}
+		}
+	}()
+	return outputErrCh, stats
+}
@@ -0,0 +1,146 @@
+package errflow
+
+import (
+	"context"
+	"github.com/nj-eka/fdups/errs"
+	"sync"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	for _, tc := range []struct {
+		s, expected string
+		isErr       bool
+	}{
+		{s: "total", expected: "total"},
+		{s: "*", expected: "total"},
+		{s: "IO", expected: "io"},
+		{s: "err", expected: "err"},
+		{s: "critical", expected: "cri"},
+		{s: " permission:wrn ", expected: "permission:wrn"},
+		{s: "unknown", isErr: true},
+		{s: "io:unknown", isErr: true},
+		{s: "unknown:err", isErr: true},
+	} {
+		sel, err := ParseSelector(tc.s)
+		if tc.isErr {
+			if err == nil {
+				t.Errorf("[%s]: expected error, got selector %s", tc.s, sel)
+			}
+			continue
+		}
+		if err != nil || sel.String() != tc.expected {
+			t.Errorf("[%s]: expected selector %s, got %s (%v)", tc.s, tc.expected, sel, err)
+		}
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, tc := range []struct {
+		rules, budgets []string
+	}{
+		{rules: []string{"io"}},
+		{rules: []string{"io=drop"}},
+		{rules: []string{"unknown=log"}},
+		{budgets: []string{"io=0"}},
+		{budgets: []string{"io=many"}},
+	} {
+		if _, err := ParsePolicy(tc.rules, tc.budgets); err == nil {
+			t.Errorf("rules %v, budgets %v: expected error", tc.rules, tc.budgets)
+		}
+	}
+	policy, err := ParsePolicy([]string{"", "io=count"}, []string{"total=10", " "})
+	if err != nil || len(policy.Rules) != 1 || len(policy.Budgets) != 1 || policy.Budgets[0].String() != "total=10" {
+		t.Fatalf("unexpected policy %+v (%v)", policy, err)
+	}
+}
+
+// TestPolicyAction checks that kind:severity rule takes precedence over kind rule, that one - over severity rule,
+// and the last of equally specific rules wins
+func TestPolicyAction(t *testing.T) {
+	policy, err := ParsePolicy([]string{"err=count", "io=ignore", "io:cri=abort", "permission:err=log", "io=log", "wrn=ignore"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		kind     errs.Kind
+		severity errs.Severity
+		expected Action
+	}{
+		{errs.KindIO, errs.SeverityError, ActionLog},
+		{errs.KindIO, errs.SeverityCritical, ActionAbort},
+		{errs.KindIO, errs.SeverityWarning, ActionLog},
+		{errs.KindPermission, errs.SeverityError, ActionLog},
+		{errs.KindNotExist, errs.SeverityError, ActionCount},
+		{errs.KindNotExist, errs.SeverityWarning, ActionIgnore},
+		{errs.KindNotExist, errs.SeverityCritical, ActionLog},
+	} {
+		err := errs.E(tc.kind, tc.severity, "test error")
+		if action := policy.Action(err); action != tc.expected {
+			t.Errorf("%s:%s: expected %s, got %s", tc.kind.Name(), tc.severity, tc.expected, action)
+		}
+	}
+}
+
+type testReporter struct {
+	sync.Mutex
+	actions []Action
+}
+
+func (r *testReporter) Report(_ errs.Error, action Action) {
+	r.Lock()
+	defer r.Unlock()
+	r.actions = append(r.actions, action)
+}
+
+func (r *testReporter) Summary(ErrorStats) {}
+
+func TestEnforcePolicyBudget(t *testing.T) {
+	policy, err := ParsePolicy([]string{"permission=ignore", "not_exist=count"}, []string{"io=2", "total=100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		inputErrCh = make(chan errs.Error)
+		reporter   testReporter
+		aborts     []errs.Error
+	)
+	outputErrCh, stats := EnforcePolicy(context.Background(), inputErrCh, policy, &reporter, func(reason errs.Error) {
+		aborts = append(aborts, reason)
+	})
+	var passed int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range outputErrCh {
+			passed++
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		inputErrCh <- errs.E(errs.KindPermission, errs.SeverityError, "ignored")
+		inputErrCh <- errs.E(errs.KindNotExist, errs.SeverityError, "counted")
+	}
+	for i := 0; i < 4; i++ {
+		inputErrCh <- errs.E(errs.KindIO, errs.SeverityError, "logged")
+	}
+	close(inputErrCh)
+	<-done
+	if len(aborts) != 1 || aborts[0].Kind() != errs.KindInterrupted {
+		t.Fatalf("expected run to be aborted once on exhausted budget, got %v", aborts)
+	}
+	if total := stats.TotalCount(); total != 7 {
+		t.Fatalf("expected 7 errors counted (ignored ones are not), got %d", total)
+	}
+	if passed != 4 {
+		t.Fatalf("expected 4 errors passed to be logged, got %d", passed)
+	}
+	var reportedAborts int
+	for _, action := range reporter.actions {
+		if action == ActionAbort {
+			reportedAborts++
+		}
+	}
+	if len(reporter.actions) != 11 || reportedAborts != 1 {
+		t.Fatalf("expected 10 errors and 1 abort reported, got %v", reporter.actions)
+	}
+}
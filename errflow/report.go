@@ -0,0 +1,149 @@
+package errflow
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/nj-eka/fdups/errs"
+	"github.com/nj-eka/fdups/registrator"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrorReporter - receiver of every error passed through error moderator (including ignored ones)
+// and of summary of counted errors on finish of run
+type ErrorReporter interface {
+	Report(err errs.Error, action Action)
+	Summary(stats ErrorStats)
+}
+
+// ErrorRecord - error as it is written to error report
+type ErrorRecord struct {
+	// Type - "error"
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	Severity   string    `json:"severity"`
+	Kind       string    `json:"kind"`
+	Operations string    `json:"operations"`
+	Path       string    `json:"path,omitempty"`
+	// Action - how error is handled by policy (see Action)
+	Action  string `json:"action"`
+	Message string `json:"message"`
+}
+
+// SummaryRecord - number of errors with the same ErrStatKey as it is written to error report
+// (the last record of report is of type "total" with total number of counted errors)
+type SummaryRecord struct {
+	// Type - "summary" or "total"
+	Type       string `json:"type"`
+	Severity   string `json:"severity,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	Operations string `json:"operations,omitempty"`
+	Count      int    `json:"count"`
+}
+
+// JSONErrorReport writes errors and summary to file in JSON lines format;
+// file is created on the first record (so it is not created if no run is done)
+type JSONErrorReport struct {
+	sync.Mutex
+	filePath string
+	file     *os.File
+	w        *bufio.Writer
+	enc      *json.Encoder
+	err      error
+	records  int
+}
+
+func NewJSONErrorReport(filePath string) *JSONErrorReport {
+	return &JSONErrorReport{filePath: filePath}
+}
+
+// FilePath returns path of report file
+func (r *JSONErrorReport) FilePath() string {
+	return r.filePath
+}
+
+func (r *JSONErrorReport) write(record interface{}) {
+	if r.err != nil {
+		return
+	}
+	if r.file == nil {
+		if r.file, r.err = os.OpenFile(r.filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644); r.err != nil {
+			r.err = fmt.Errorf("creating error report [%s] failed: %w", r.filePath, r.err)
+			return
+		}
+		r.w = bufio.NewWriter(r.file)
+		r.enc = json.NewEncoder(r.w)
+	}
+	if r.err = r.enc.Encode(record); r.err != nil {
+		r.err = fmt.Errorf("writing error report [%s] failed: %w", r.filePath, r.err)
+		return
+	}
+	r.records++
+}
+
+func (r *JSONErrorReport) Report(err errs.Error, action Action) {
+	r.Lock()
+	defer r.Unlock()
+	r.write(ErrorRecord{
+		Type:       "error",
+		Time:       err.TimeStamp(),
+		Severity:   err.Severity().String(),
+		Kind:       err.Kind().Name(),
+		Operations: err.OperationPath().String(),
+		Path:       err.Path(),
+		Action:     action.String(),
+		Message:    err.Error(),
+	})
+}
+
+// Summary writes summary of counted errors grouped by ErrStatKey (sorted by severity, operations, kind)
+// and total record (so report is written even if there are no errors)
+func (r *JSONErrorReport) Summary(stats ErrorStats) {
+	r.Lock()
+	defer r.Unlock()
+	cps := stats.GetCounterPairs()
+	sort.Sort(registrator.CounterPairsByKey(cps))
+	for _, cp := range cps {
+		esk := cp.Key.(ErrStatKey)
+		r.write(SummaryRecord{
+			Type:       "summary",
+			Severity:   esk.Severity.String(),
+			Kind:       esk.Kind.Name(),
+			Operations: esk.Operations,
+			Count:      cp.Count,
+		})
+	}
+	r.write(SummaryRecord{Type: "total", Count: stats.TotalCount()})
+	if r.w != nil && r.err == nil {
+		if r.err = r.w.Flush(); r.err != nil {
+			r.err = fmt.Errorf("writing error report [%s] failed: %w", r.filePath, r.err)
+		}
+	}
+}
+
+// Records returns number of records written so far
+func (r *JSONErrorReport) Records() int {
+	r.Lock()
+	defer r.Unlock()
+	return r.records
+}
+
+// Close flushes and closes report file (if it is created), returns the first error occurred on writing
+func (r *JSONErrorReport) Close() error {
+	r.Lock()
+	defer r.Unlock()
+	if r.file == nil {
+		return r.err
+	}
+	if r.err == nil {
+		r.err = r.w.Flush()
+	}
+	if err := r.file.Close(); err != nil && r.err == nil {
+		r.err = fmt.Errorf("closing error report [%s] failed: %w", r.filePath, err)
+	}
+	r.file = nil
+	return r.err
+}
@@ -5,13 +5,13 @@ import (
 	cu "github.com/nj-eka/fdups/contexts"
 	"github.com/nj-eka/fdups/errs"
 	"github.com/nj-eka/fdups/logging"
-	"github.com/nj-eka/fdups/registrator"
 )
 
-func SortFilteredErrors(ctx context.Context, inputErrCh <-chan errs.Error, filterSeverities []errs.Severity) (map[errs.Severity]chan errs.Error, ErrorStats) {
+// SortFilteredErrors sorts errors by severity into channels, errors of severities not in filter are dropped
+// (errors are counted before - see EnforcePolicy)
+func SortFilteredErrors(ctx context.Context, inputErrCh <-chan errs.Error, filterSeverities []errs.Severity) map[errs.Severity]chan errs.Error {
 	ctx = cu.BuildContext(ctx, cu.AddContextOperation("sorting"))
 	scerr := make(map[errs.Severity]chan errs.Error)
-	stats := ErrorStats(registrator.NewEncounter(len(errs.AllSeverities) * int(errs.KindInternal) * 64))
 	for _, severity := range filterSeverities {
 		scerr[severity] = make(chan errs.Error, cap(inputErrCh))
 	}
@@ -27,9 +27,8 @@ func SortFilteredErrors(ctx context.Context, inputErrCh <-chan errs.Error, filte
 				if cerr, ok := scerr[err.Severity()]; ok {
 					cerr <- err
 				}
-				stats.CheckIn(ErrStatKey{err.Severity(), err.Kind(), err.OperationPath().String()})
 			}
 		}
 	}()
-	return scerr, stats
+	return scerr
 }
@@ -6,6 +6,9 @@ import (
 	cu "github.com/nj-eka/fdups/contexts"
 )
 
+// Path - file path error relates to (argument of E)
+type Path string
+
 func E(args ...interface{}) Error {
 	switch len(args) {
 	case 0:
@@ -23,6 +26,8 @@ func E(args ...interface{}) Error {
 			e.severity = a
 		case Kind:
 			e.kind = a
+		case Path:
+			e.path = string(a)
 		case cu.Operation:
 			e.ops = cu.Operations{Stack: []cu.Operation{a}}
 		case cu.Operations:
@@ -43,6 +48,12 @@ func E(args ...interface{}) Error {
 		default:
 		}
 	}
+	// generic kind given by call site is refined by actual cause (e.g. KindOSStat -> KindPermission on EACCES)
+	if isGenericKind(e.kind) {
+		if kind := Classify(e.err); kind != KindOther {
+			e.kind = kind
+		}
+	}
 	e.frames = Trace(2)
 	return e
 }
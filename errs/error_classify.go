@@ -0,0 +1,60 @@
+package errs
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+)
+
+// isGenericKind - kinds given by call sites regardless of actual cause (so they can be refined by Classify)
+func isGenericKind(kind Kind) bool {
+	switch kind {
+	case KindOther, KindTransient, KindIO, KindOSOpenFile, KindOSStat, KindFileStat, KindFileSystemOther:
+		return true
+	}
+	return false
+}
+
+// Classify returns precise kind of err by the first wrapped Error with non generic kind
+// or by wrapped os error (syscall.Errno, fs.ErrNotExist, ...); KindOther - if err can't be classified
+func Classify(err error) Kind {
+	if err == nil {
+		return KindOther
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if ee, ok := e.(Error); ok && !isGenericKind(ee.Kind()) {
+			return ee.Kind()
+		}
+	}
+	switch {
+	case errors.Is(err, syscall.EINTR), errors.Is(err, syscall.EAGAIN):
+		return KindTransient
+	case errors.Is(err, syscall.ELOOP):
+		return KindBrokenLink
+	case errors.Is(err, syscall.EMFILE), errors.Is(err, syscall.ENFILE):
+		return KindTooManyOpenFiles
+	case errors.Is(err, syscall.EIO):
+		return KindIO
+	case errors.Is(err, syscall.EISDIR):
+		return KindIsDir
+	case errors.Is(err, syscall.ENOTDIR):
+		return KindNotDir
+	case errors.Is(err, fs.ErrPermission): // EACCES, EPERM
+		return KindPermission
+	case errors.Is(err, fs.ErrNotExist): // ENOENT
+		return KindNotExist
+	case errors.Is(err, fs.ErrExist): // EEXIST
+		return KindExist
+	}
+	return KindOther
+}
+
+// IsTransient - err is caused by temporary condition (interrupted system call, exhausted open files limit, ...),
+// so failed operation can be retried
+func IsTransient(err error) bool {
+	switch Classify(err) {
+	case KindTransient, KindTooManyOpenFiles:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"syscall"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		errno    syscall.Errno
+		expected Kind
+	}{
+		{syscall.EACCES, KindPermission},
+		{syscall.EPERM, KindPermission},
+		{syscall.ENOENT, KindNotExist},
+		{syscall.ELOOP, KindBrokenLink},
+		{syscall.EMFILE, KindTooManyOpenFiles},
+		{syscall.ENFILE, KindTooManyOpenFiles},
+		{syscall.EIO, KindIO},
+		{syscall.EINTR, KindTransient},
+	} {
+		err := fmt.Errorf("wrapped: %w", &fs.PathError{Op: "open", Path: "file", Err: tc.errno})
+		if kind := Classify(err); kind != tc.expected {
+			t.Errorf("%v: expected %s, got %s", tc.errno, tc.expected.Name(), kind.Name())
+		}
+		// generic kind of call site is refined by cause
+		if kind := E(KindOSStat, Path("file"), err).Kind(); kind != tc.expected {
+			t.Errorf("%v: expected generic kind to be refined to %s, got %s", tc.errno, tc.expected.Name(), kind.Name())
+		}
+	}
+	if kind := Classify(errors.New("unknown")); kind != KindOther {
+		t.Errorf("expected unclassified error to be %s, got %s", KindOther.Name(), kind.Name())
+	}
+}
+
+func TestExplicitKindIsPreserved(t *testing.T) {
+	cause := &fs.PathError{Op: "stat", Path: "link", Err: syscall.ENOENT}
+	err := E(KindBrokenLink, Path("link"), cause)
+	if err.Kind() != KindBrokenLink {
+		t.Fatalf("explicit kind %s is replaced by %s", KindBrokenLink.Name(), err.Kind().Name())
+	}
+	// explicit kind of wrapped error takes precedence over its os cause
+	if kind := Classify(fmt.Errorf("getting FileStat failed: %w", err)); kind != KindBrokenLink {
+		t.Fatalf("expected %s of wrapped error, got %s", KindBrokenLink.Name(), kind.Name())
+	}
+	if kind := E(KindOSStat, err).Kind(); kind != KindBrokenLink {
+		t.Fatalf("expected generic kind to be refined by wrapped error to %s, got %s", KindBrokenLink.Name(), kind.Name())
+	}
+}
@@ -1,17 +1,20 @@
 package errs
 
 import (
+	"errors"
 	cu "github.com/nj-eka/fdups/contexts"
+	"io/fs"
 	"time"
 )
 
 type errorData struct {
-	err       error
-	severity  Severity
-	kind      Kind
-	ops       cu.Operations
-	frames    []Frame
-	ts        int64
+	err      error
+	severity Severity
+	kind     Kind
+	ops      cu.Operations
+	path     string
+	frames   []Frame
+	ts       int64
 }
 
 var _ Error = &errorData{}
@@ -46,6 +49,22 @@ func (e errorData) OperationPath() cu.Operations {
 	return e.ops
 }
 
+// Path returns path given on error building (see Path type) or path of wrapped fs.PathError
+func (e errorData) Path() string {
+	if e.path != "" {
+		return e.path
+	}
+	var ee Error
+	if errors.As(e.err, &ee) {
+		return ee.Path()
+	}
+	var pathErr *fs.PathError
+	if errors.As(e.err, &pathErr) {
+		return pathErr.Path
+	}
+	return ""
+}
+
 func (e errorData) StackTrace() []Frame {
 	return e.frames
 }
@@ -11,6 +11,8 @@ type Error interface {
 	TimeStamp() time.Time
 	Kind() Kind
 	OperationPath() cou.Operations
+	// Path - file path error relates to (empty if unknown)
+	Path() string
 	StackTrace() []Frame
 	Unwrap() error
 }
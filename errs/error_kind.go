@@ -1,26 +1,34 @@
 package errs
 
+import (
+	"fmt"
+	"strings"
+)
+
 type Kind uint32
 
 // todo: make kind values as flags so that masks can be used to classify compound errors
 // const KindOther Kind = 1 << (32 - 1 - iota)
 const (
-	KindOther           Kind = iota // Unclassified error. This value is not printed in the error message.
-	KindTransient                   // Transient error  todo: use prev Error values
-	KindInterrupted                 // Interrupted ( some kind of inconsistency )
-	KindInvalidValue                // Invalid value for this type of item.
-	KindIO                          // External I/O error such as network failure.
-	KindOSOpenFile                  // os.Open errors
-	KindOSStat                      // error returned from os.Lstat, os.Stat
-	KindFileStat                    // FileStat creation failed
-	KindPermission                  // Permission denied.
-	KindExist                       // Item already exists.
-	KindNotExist                    // Item does not exist.
-	KindIsDir                       // Item is a directory.
-	KindNotDir                      // Item is not a directory.
-	KindFileSystemOther             // Other file system related error.
-	KindBrokenLink                  // Link target does not exist.
-	KindInternal                    // Internal error (for current errs pipeline impl this kind should be last in this list so that len(Kinds) = int(errs.KindInternal))
+	KindOther            Kind = iota // Unclassified error. This value is not printed in the error message.
+	KindTransient                    // Transient error  todo: use prev Error values
+	KindInterrupted                  // Interrupted ( some kind of inconsistency )
+	KindInvalidValue                 // Invalid value for this type of item.
+	KindIO                           // External I/O error such as network failure.
+	KindOSOpenFile                   // os.Open errors
+	KindOSStat                       // error returned from os.Lstat, os.Stat
+	KindFileStat                     // FileStat creation failed
+	KindPermission                   // Permission denied.
+	KindExist                        // Item already exists.
+	KindNotExist                     // Item does not exist.
+	KindIsDir                        // Item is a directory.
+	KindNotDir                       // Item is not a directory.
+	KindFileSystemOther              // Other file system related error.
+	KindBrokenLink                   // Link target does not exist.
+	KindTooManyOpenFiles             // Process or system limit of open files is reached.
+	KindReadFallback                 // File is read in fallback mode (e.g. O_DIRECT is not supported by file system).
+	KindVerifyMismatch               // Group of duplicates is split by byte-by-byte verification (hash collision or file modified meanwhile).
+	KindInternal                     // Internal error (for current errs pipeline impl this kind should be last in this list so that len(Kinds) = int(errs.KindInternal))
 )
 
 func (k Kind) String() string {
@@ -33,6 +41,8 @@ func (k Kind) String() string {
 		return "other file system related"
 	case KindInterrupted:
 		return "interrupted"
+	case KindOSOpenFile:
+		return "Open failed"
 	case KindOSStat:
 		return "Stat failed"
 	case KindFileStat:
@@ -47,6 +57,12 @@ func (k Kind) String() string {
 		return "item does not exist"
 	case KindBrokenLink:
 		return "link target does not exist"
+	case KindTooManyOpenFiles:
+		return "too many open files"
+	case KindReadFallback:
+		return "read mode fallback"
+	case KindVerifyMismatch:
+		return "verification mismatch"
 	case KindIsDir:
 		return "item is a directory"
 	case KindNotDir:
@@ -58,3 +74,45 @@ func (k Kind) String() string {
 	}
 	return "unknown"
 }
+
+// kindNames - short names of kinds (used in config)
+var kindNames = map[Kind]string{
+	KindOther:            "other",
+	KindTransient:        "transient",
+	KindInterrupted:      "interrupted",
+	KindInvalidValue:     "invalid_value",
+	KindIO:               "io",
+	KindOSOpenFile:       "open",
+	KindOSStat:           "stat",
+	KindFileStat:         "filestat",
+	KindPermission:       "permission",
+	KindExist:            "exist",
+	KindNotExist:         "not_exist",
+	KindIsDir:            "is_dir",
+	KindNotDir:           "not_dir",
+	KindFileSystemOther:  "fs_other",
+	KindBrokenLink:       "broken_link",
+	KindTooManyOpenFiles: "too_many_open_files",
+	KindReadFallback:     "read_fallback",
+	KindVerifyMismatch:   "verify_mismatch",
+	KindInternal:         "internal",
+}
+
+// Name - short name of kind (see ParseKind)
+func (k Kind) Name() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseKind parses kind by its short name (e.g. io, permission, not_exist)
+func ParseKind(name string) (Kind, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for kind, kindName := range kindNames {
+		if kindName == name {
+			return kind, nil
+		}
+	}
+	return KindOther, fmt.Errorf("unknown error kind [%s]", name)
+}
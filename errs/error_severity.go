@@ -1,5 +1,10 @@
 package errs
 
+import (
+	"fmt"
+	"strings"
+)
+
 type Severity uint32
 
 const (
@@ -26,3 +31,16 @@ func (s Severity) String() string {
 		return "unknown error severity"
 	}
 }
+
+// ParseSeverity parses severity by its short (wrn, err, cri) or full (warning, error, critical) name
+func ParseSeverity(name string) (Severity, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "wrn", "warning":
+		return SeverityWarning, nil
+	case "err", "error":
+		return SeverityError, nil
+	case "cri", "critical":
+		return SeverityCritical, nil
+	}
+	return SeverityWarning, fmt.Errorf("unknown error severity [%s]", name)
+}
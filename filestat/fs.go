@@ -2,11 +2,12 @@
 package filestat
 
 import (
+	"errors"
 	"fmt"
+	"github.com/nj-eka/fdups/errs"
 	"io/fs"
-	"os"
 	"os/user"
-	"path/filepath"
+	"syscall"
 	"time"
 )
 
@@ -20,6 +21,8 @@ type FileStat interface {
 	BaseName() string
 	// Inode - Unix inode (or analogue) used here to resolve multiple links to the same file content
 	Inode() Inode
+	// Dev - id of device file resides on (0 if unknown)
+	Dev() uint64
 	// IsRegular - checks whether file is regular (FileMode & ModeType == 0)
 	IsRegular() bool
 	// Size - content size
@@ -49,29 +52,34 @@ type FileStat interface {
 	SortingKey() string
 }
 
-// GetFileStat - FileStat builder function (uses os specific func newFileStat)
-func GetFileStat(path string, metaKeyFunc MetaKeyFunc, priorFunc PriorFunc, SymLinkEnabled bool) (FileStat, error) {
-	if fileInfo, err := os.Lstat(path); err == nil {
-		if fileInfo.Mode()&os.ModeSymlink == os.ModeSymlink {
+// GetFileStat - FileStat builder function (file info is taken from fsys backend)
+func GetFileStat(fsys FS, path string, metaKeyFunc MetaKeyFunc, priorFunc PriorFunc, SymLinkEnabled bool) (FileStat, error) {
+	if fileInfo, err := fsys.Lstat(path); err == nil {
+		if fileInfo.Mode()&fs.ModeSymlink == fs.ModeSymlink {
 			if SymLinkEnabled {
-				targetPath, err := filepath.EvalSymlinks(path)
+				targetPath, err := fsys.EvalSymlinks(path)
 				if err != nil {
+					// link is broken if its target doesn't exist or there is a loop of links
+					// (loops are detected by Stat since EvalSymlinks reports them without errno)
+					if _, statErr := fsys.Stat(path); errors.Is(statErr, fs.ErrNotExist) || errors.Is(statErr, syscall.ELOOP) {
+						return nil, errs.E(errs.KindBrokenLink, errs.Path(path), fmt.Errorf("broken symlink [%s]: %w", path, statErr))
+					}
 					return nil, fmt.Errorf("unresolved symlink [%s]: %w", path, err)
 				}
-				targetInfo, err := os.Stat(targetPath)
+				targetInfo, err := fsys.Stat(targetPath)
 				if err != nil {
 					return nil, fmt.Errorf("getting target file [%s] Stat for symlink [%s] failed: %w", targetPath, path, err)
 				}
-				sfs, err := newFileStat(path, fileInfo, nil, priorFunc, nil)
+				sfs, err := newFileStat(fsys, path, fileInfo, nil, priorFunc, nil)
 				if err != nil {
 					return nil, fmt.Errorf("getting FileStat for symlink [%s] failed: %w", path, err)
 				}
-				return newFileStat(targetPath, targetInfo, metaKeyFunc, priorFunc, sfs)
+				return newFileStat(fsys, targetPath, targetInfo, metaKeyFunc, priorFunc, sfs)
 			} else {
 				return nil, fmt.Errorf("symlink processing is disabled [%s]", path) // info
 			}
 		} else {
-			return newFileStat(path, fileInfo, metaKeyFunc, priorFunc, nil)
+			return newFileStat(fsys, path, fileInfo, metaKeyFunc, priorFunc, nil)
 		}
 	} else {
 		// errors.Is(err, os.ErrNotExist)
@@ -0,0 +1,137 @@
+package filestat
+
+import (
+	"context"
+	"fmt"
+	"github.com/cespare/xxhash/v2"
+	"io"
+	"log"
+	"math/bits"
+)
+
+// DefaultChunkAvgSize - average size of content-defined chunks by default
+const DefaultChunkAvgSize = 64 * 1024
+
+// ChunkerSettings - sizes of content-defined chunks (see GetChunkFileFunc)
+type ChunkerSettings struct {
+	MinSize, AvgSize, MaxSize int
+}
+
+// NewChunkerSettings - settings of chunks of avgSize on average (rounded to power of 2), from avgSize/4 to avgSize*4
+func NewChunkerSettings(avgSize int) (ChunkerSettings, error) {
+	if avgSize < 256 || avgSize > 1<<30 {
+		return ChunkerSettings{}, fmt.Errorf("invalid average chunk size [%d]: expected 256 .. 1 GiB", avgSize)
+	}
+	avgSize = 1 << (bits.Len(uint(avgSize)) - 1)
+	return ChunkerSettings{MinSize: avgSize / 4, AvgSize: avgSize, MaxSize: avgSize * 4}, nil
+}
+
+// Chunk - content-defined chunk of file: Hash (xxh64) of its content and Size
+type Chunk struct {
+	Hash uint64
+	Size int
+}
+
+// ChunkFileFunc splits file into content-defined chunks passing them to onChunk in order;
+// returns number of bytes read (it is stopped with ctx error as soon as ctx is done)
+type ChunkFileFunc func(ctx context.Context, fs FileStat, onChunk func(Chunk)) (read int64, err error)
+
+// gear - random values of bytes of gear rolling hash (generated by splitmix64 with fixed seed, so chunks are stable)
+var gear = func() (table [256]uint64) {
+	seed := uint64(0x6664757073) // "fdups"
+	for i := range table {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return
+}()
+
+// GetChunkFileFunc customizes chunker func: files are split by FastCDC (gear rolling hash with normalized chunking -
+// stricter mask before average size, looser one after it), read from fsys backend in readMode at rates limited by throttle;
+// progress of large files is kept by tracker (nil = off)
+func GetChunkFileFunc(fsys FS, settings ChunkerSettings, readMode ReadMode, throttle *Throttle, tracker *HashTracker) ChunkFileFunc {
+	level := bits.Len(uint(settings.AvgSize)) - 1
+	// masks of top bits of gear hash (the oldest bytes of window are shifted out of them)
+	maskS := ^uint64(0) << (64 - uint(level+2))
+	maskL := ^uint64(0) << (64 - uint(level-2))
+	cut := func(data []byte) int {
+		n := len(data)
+		if n <= settings.MinSize {
+			return n
+		}
+		if n > settings.MaxSize {
+			n = settings.MaxSize
+		}
+		normal := settings.AvgSize
+		if normal > n {
+			normal = n
+		}
+		var fp uint64
+		i := settings.MinSize
+		for ; i < normal; i++ {
+			if fp = (fp << 1) + gear[data[i]]; fp&maskS == 0 {
+				return i + 1
+			}
+		}
+		for ; i < n; i++ {
+			if fp = (fp << 1) + gear[data[i]]; fp&maskL == 0 {
+				return i + 1
+			}
+		}
+		return n
+	}
+	return func(ctx context.Context, fs FileStat, onChunk func(Chunk)) (read int64, err error) {
+		if err = throttle.waitOpen(ctx); err != nil {
+			return 0, err
+		}
+		file, err := openForRead(ctx, fsys, fs.Path(), readMode)
+		if err != nil {
+			return 0, fmt.Errorf("chunking file [%s] failed: %w", fs.Path(), err)
+		}
+		defer func() {
+			if e := file.Close(); e != nil && err == nil {
+				log.Printf("error while closing file [%s]: %v", fs.Path(), e)
+			}
+		}()
+		tf := tracker.track(fs.Path(), fs.Size())
+		defer tracker.untrack(tf)
+		var (
+			buf        = make([]byte, settings.MaxSize+hashBufferSize)
+			start, end int
+			eof        bool
+		)
+		for {
+			if err = ctx.Err(); err != nil {
+				return read, err
+			}
+			if !eof && end-start < settings.MaxSize { // refill buffer so that the longest chunk fits in
+				end = copy(buf, buf[start:end])
+				start = 0
+				for !eof && end < len(buf) {
+					chunk := throttle.chunk(len(buf) - end)
+					if err = throttle.waitRead(ctx, chunk); err != nil {
+						return read, err
+					}
+					n, er := file.Read(buf[end : end+chunk])
+					end += n
+					read += int64(n)
+					tf.add(n)
+					if er == io.EOF {
+						eof = true
+					} else if er != nil {
+						return read, fmt.Errorf("chunking file [%s] is failed - read %d: %w", fs.Path(), read, er)
+					}
+				}
+			}
+			if start == end {
+				return read, nil
+			}
+			size := cut(buf[start:end])
+			onChunk(Chunk{Hash: xxhash.Sum64(buf[start : start+size]), Size: size})
+			start += size
+		}
+	}
+}
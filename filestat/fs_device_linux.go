@@ -0,0 +1,80 @@
+package filestat
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// fsIocFiemap - FS_IOC_FIEMAP ioctl request (_IOWR('f', 11, struct fiemap))
+const fsIocFiemap = 0xC020660B
+
+// fiemapExtent, fiemap - see linux/fiemap.h (request of the first extent only)
+type fiemapExtent struct {
+	logical    uint64
+	physical   uint64
+	length     uint64
+	reserved64 [2]uint64
+	flags      uint32
+	reserved   [3]uint32
+}
+
+type fiemap struct {
+	start         uint64
+	length        uint64
+	flags         uint32
+	mappedExtents uint32
+	extentCount   uint32
+	reserved      uint32
+	extents       [1]fiemapExtent
+}
+
+func devMajor(dev uint64) uint64 {
+	return (dev>>8)&0xfff | (dev>>32)&^uint64(0xfff)
+}
+
+func devMinor(dev uint64) uint64 {
+	return dev&0xff | (dev>>12)&^uint64(0xff)
+}
+
+// DeviceName - device id in major:minor format
+func DeviceName(dev uint64) string {
+	return fmt.Sprintf("%d:%d", devMajor(dev), devMinor(dev))
+}
+
+// IsRotational - whether block device is rotating media (HDD) according to sysfs;
+// ok is false if it's unknown (e.g. network or virtual file system)
+func IsRotational(dev uint64) (rotational, ok bool) {
+	// /sys/dev/block/<major:minor> is symlink to device dir, e.g. .../block/sda or .../block/sda/sda1 for partition
+	blockDir, err := filepath.EvalSymlinks(filepath.Join("/sys/dev/block", DeviceName(dev)))
+	if err != nil {
+		return false, false
+	}
+	// partitions have no queue - it is taken from parent device
+	for _, queueDir := range []string{filepath.Join(blockDir, "queue"), filepath.Join(filepath.Dir(blockDir), "queue")} {
+		if data, err := os.ReadFile(filepath.Join(queueDir, "rotational")); err == nil {
+			return strings.TrimSpace(string(data)) == "1", true
+		}
+	}
+	return false, false
+}
+
+// PhysicalOffset - physical offset of the first extent of file on device (by FIEMAP ioctl);
+// ok is false if file system doesn't support it or file is empty (or ctx is done while waiting to open file)
+func PhysicalOffset(ctx context.Context, path string) (offset uint64, ok bool) {
+	opened, err := openCtx(ctx, osFS{}, path)
+	if err != nil {
+		return 0, false
+	}
+	defer opened.Close()
+	file := opened.(*osFile)
+	fm := fiemap{length: ^uint64(0), extentCount: 1}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), fsIocFiemap, uintptr(unsafe.Pointer(&fm))); errno != 0 || fm.mappedExtents == 0 {
+		return 0, false
+	}
+	return fm.extents[0].physical, true
+}
@@ -0,0 +1,23 @@
+// +build !linux
+
+package filestat
+
+import (
+	"context"
+	"strconv"
+)
+
+// DeviceName - device id as is
+func DeviceName(dev uint64) string {
+	return strconv.FormatUint(dev, 10)
+}
+
+// IsRotational - type of media is unknown
+func IsRotational(uint64) (rotational, ok bool) {
+	return false, false
+}
+
+// PhysicalOffset - physical layout of files is unknown
+func PhysicalOffset(context.Context, string) (offset uint64, ok bool) {
+	return 0, false
+}
@@ -0,0 +1,219 @@
+package filestat
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"math"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBlksize - block size used for files which file system doesn't provide it
+const DefaultBlksize = 4096
+
+// sysStat - os specific part of file info (see getSysStat)
+type sysStat struct {
+	ino     Inode
+	nlink   uint64
+	blksize int64
+	uid     uint64
+	gid     uint64
+	dev     uint64
+}
+
+// syntheticOwner - owner of files of backends without os specific file info (see newSyntheticSysStat)
+type syntheticOwner struct {
+	uid, gid uint64
+	user     *user.User
+	group    *user.Group
+}
+
+var (
+	currentOwnerOnce sync.Once
+	currentOwnerInfo *syntheticOwner
+)
+
+// currentOwner - current user and its group resolved once (root with uid/gid 0 if they can't be resolved,
+// e.g. without cgo and $USER in containers)
+func currentOwner() *syntheticOwner {
+	currentOwnerOnce.Do(func() {
+		owner := syntheticOwner{
+			user:  &user.User{Uid: "0", Gid: "0", Username: "root", Name: "root"},
+			group: &user.Group{Gid: "0", Name: "root"},
+		}
+		if usr, err := user.Current(); err == nil {
+			if _, err := fmt.Sscan(usr.Uid, &owner.uid); err == nil {
+				owner.user = usr
+				if _, err := fmt.Sscan(usr.Gid, &owner.gid); err != nil {
+					owner.gid = 0
+				}
+				owner.group = &user.Group{Gid: fmt.Sprint(owner.gid), Name: usr.Username}
+				if grp, err := user.LookupGroupId(fmt.Sprint(owner.gid)); err == nil {
+					owner.group = grp
+				}
+			}
+		}
+		currentOwnerInfo = &owner
+	})
+	return currentOwnerInfo
+}
+
+// newSyntheticSysStat makes up os specific file info for backends without it (like io/fs.FS):
+// inode is derived from path with symbolic links resolved (so there are no hard links,
+// but file reached via symbolic link to it or to its dir has the same inode), owner is current user (see currentOwner)
+func newSyntheticSysStat(fsys FS, path string, owner *syntheticOwner) sysStat {
+	if resolved, err := fsys.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(path))
+	return sysStat{
+		ino:     Inode(h.Sum64()),
+		nlink:   1,
+		blksize: DefaultBlksize,
+		uid:     owner.uid,
+		gid:     owner.gid,
+	}
+}
+
+// fileStat implements FileStat interface
+// os specific info is taken from syscall.Stat_t on *nix os (see fs_unix.go) or made up (see newSyntheticSysStat)
+type fileStat struct {
+	path       string
+	fileInfo   fs.FileInfo
+	sys        sysStat
+	user       *user.User
+	group      *user.Group
+	symlink    FileStat
+	metaKey    string
+	sortingKey string
+	repr       string
+	prior      string
+}
+
+func (fs *fileStat) Path() string { return fs.path }
+
+func (fs *fileStat) Inode() Inode { return fs.sys.ino }
+
+func (fs *fileStat) Dev() uint64 { return fs.sys.dev }
+
+func (fs *fileStat) Size() int64 { return fs.fileInfo.Size() }
+
+func (fs *fileStat) Blksize() int64 { return fs.sys.blksize }
+
+func (fs *fileStat) Blocks() int64 {
+	//return filestat.sys.Blocks
+	return int64(math.Ceil(float64(fs.Size() / fs.Blksize())))
+}
+
+func (fs *fileStat) Perm() fs.FileMode { return fs.fileInfo.Mode().Perm() }
+
+func (fs *fileStat) IsRegular() bool { return fs.fileInfo.Mode().IsRegular() }
+
+func (fs *fileStat) BaseName() string { return fs.fileInfo.Name() }
+
+func (fs *fileStat) ModTime() time.Time { return fs.fileInfo.ModTime() }
+
+func (fs *fileStat) User() *user.User { return fs.user }
+
+func (fs *fileStat) Group() *user.Group { return fs.group }
+
+func (fs *fileStat) Symlink() FileStat { return fs.symlink }
+
+func (fs *fileStat) MetaKey() string { return fs.metaKey }
+
+func (fs *fileStat) String() string {
+	if fs.repr == "" {
+		path := fs.path
+		if fs.symlink != nil {
+			path = fmt.Sprintf("%s -> %s", fs.symlink.Path(), path)
+		}
+		ln := fs.Symlink()
+		ino := fs.Inode()
+		nlink := fs.sys.nlink
+		if ln != nil {
+			ino = ln.Inode()
+			nlink = ln.(*fileStat).sys.nlink
+		}
+		fs.repr = fmt.Sprintf(
+			"%10d(%2d)|%10s|%12d|%26s|%s:%s|%s",
+			ino,
+			nlink,
+			fs.Perm(),
+			fs.Size(),
+			fs.ModTime().Format(time.RFC1123),
+			fs.User().Username,
+			fs.Group().Name,
+			path,
+		)
+	}
+	return fs.repr
+}
+
+func (fs *fileStat) Prior() string {
+	return fs.prior
+}
+
+func (fs *fileStat) SortingKey() string {
+	if fs.sortingKey == "" {
+		t := "0"
+		if fs.symlink != nil {
+			t = "1"
+		}
+		fs.sortingKey = fmt.Sprintf("%2s%1s%19s%3d%8s%8s%s",
+			fs.prior,
+			t,
+			fs.ModTime().Format("20060102_1504050000"),
+			strings.Count(fs.path, string(filepath.Separator)),
+			fs.user.Uid,
+			fs.group.Gid,
+			fs.path, // todo: if fs.symlink != nil use fs.symlink.path ...
+		)
+	}
+	return fs.sortingKey
+}
+
+//newFileStat initializes FileStat
+func newFileStat(fsys FS, path string, fileInfo fs.FileInfo, metaKeyFunc MetaKeyFunc, priorFunc PriorFunc, symlink FileStat) (FileStat, error) {
+	var (
+		userOwner  *user.User
+		groupOwner *user.Group
+	)
+	sys, ok := getSysStat(fileInfo)
+	if ok {
+		var err error
+		if userOwner, err = user.LookupId(fmt.Sprint(sys.uid)); err != nil {
+			return nil, err
+		}
+		if groupOwner, err = user.LookupGroupId(fmt.Sprint(sys.gid)); err != nil {
+			return nil, err
+		}
+	} else {
+		owner := currentOwner()
+		if ofs, ok := fsys.(interface{ syntheticOwner() *syntheticOwner }); ok {
+			owner = ofs.syntheticOwner()
+		}
+		sys = newSyntheticSysStat(fsys, path, owner)
+		userOwner, groupOwner = owner.user, owner.group
+	}
+	fS := fileStat{
+		path:     path,
+		fileInfo: fileInfo,
+		sys:      sys,
+		user:     userOwner,
+		group:    groupOwner,
+		symlink:  symlink,
+	}
+	if metaKeyFunc != nil { // fnMetaKey is nil for symlink
+		//if symlink != nil {
+		fS.metaKey = metaKeyFunc(&fS)
+	}
+	if priorFunc != nil {
+		fS.prior = priorFunc(path)
+	}
+	return &fS, nil
+}
@@ -0,0 +1,88 @@
+package filestat
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"github.com/cespare/xxhash/v2"
+	"github.com/zeebo/xxh3"
+	"golang.org/x/crypto/blake2b"
+	"hash"
+	"hash/crc32"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Fast non-cryptographic algos (prefilters) and cryptographic ones (final stage) besides MD5 ... SHA512
+const (
+	XXH64     = "xxh64"
+	XXH3      = "xxh3"
+	CRC32C    = "crc32c"
+	FNV1a     = "fnv1a"
+	SHA512256 = "sha512_256"
+	BLAKE2b   = "blake2b"
+)
+
+// NewHashFunc - constructor of hash of registered algo
+type NewHashFunc func() hash.Hash
+
+var hashAlgos = struct {
+	sync.RWMutex
+	m map[string]NewHashFunc
+}{m: make(map[string]NewHashFunc)}
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+func init() {
+	RegisterHashAlgo(Idle, func() hash.Hash { return &idleHasher{} })
+	RegisterHashAlgo(MD5, md5.New)
+	RegisterHashAlgo(SHA1, sha1.New)
+	RegisterHashAlgo(SHA256, sha256.New)
+	RegisterHashAlgo(SHA512, sha512.New)
+	RegisterHashAlgo(SHA512256, sha512.New512_256)
+	RegisterHashAlgo(BLAKE2b, func() hash.Hash {
+		h, _ := blake2b.New512(nil) // error is returned only for too long key
+		return h
+	})
+	RegisterHashAlgo(XXH64, func() hash.Hash { return xxhash.New() })
+	RegisterHashAlgo(XXH3, func() hash.Hash { return xxh3.New() })
+	RegisterHashAlgo(CRC32C, func() hash.Hash { return crc32.New(crc32cTable) })
+	RegisterHashAlgo(FNV1a, func() hash.Hash { return fnv.New64a() })
+}
+
+// RegisterHashAlgo makes algo available to hashers (see GetHashFileFunc) by name (case insensitive);
+// it panics if algo with the same name is already registered
+func RegisterHashAlgo(name string, newHash NewHashFunc) {
+	name = strings.ToLower(name)
+	hashAlgos.Lock()
+	defer hashAlgos.Unlock()
+	if _, ok := hashAlgos.m[name]; ok {
+		panic(fmt.Sprintf("hash algo [%s] is already registered", name))
+	}
+	hashAlgos.m[name] = newHash
+}
+
+// HashAlgos returns names of registered algos (sorted, idle algo is not included)
+func HashAlgos() []string {
+	hashAlgos.RLock()
+	defer hashAlgos.RUnlock()
+	names := make([]string, 0, len(hashAlgos.m))
+	for name := range hashAlgos.m {
+		if name != Idle {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupHashAlgo(name string) (NewHashFunc, bool) {
+	hashAlgos.RLock()
+	defer hashAlgos.RUnlock()
+	newHash, ok := hashAlgos.m[strings.ToLower(name)]
+	return newHash, ok
+}
@@ -0,0 +1,65 @@
+package filestat
+
+import (
+	"encoding/hex"
+	"hash"
+	"testing"
+)
+
+func sumOf(h hash.Hash, data []byte) []byte {
+	_, _ = h.Write(data)
+	return h.Sum(nil)
+}
+
+func seq(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+// TestBlake2b checks BLAKE2b-512 against RFC 7693 (Appendix A) and reference implementation vectors,
+// data is written at once and in pieces crossing block boundaries
+func TestBlake2b(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"empty", nil, "786a02f742015903c6c6fd852552d272912f4740e15847618a86e217f71f5419d25e1031afee585313896444934eb04b903a685b1448b755d56f701afe9be2ce"},
+		{"abc (RFC 7693)", []byte("abc"), "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"},
+		{"one block", seq(128), "2319e3789c47e2daa5fe807f61bec2a1a6537fa03f19ff32e87eecbfd64b7e0e8ccff439ac333b040f19b0c4ddd11a61e24ac1fe0f10a039806c5dcc0da3d115"},
+		{"block and byte", seq(129), "f59711d44a031d5f97a9413c065d1e614c417ede998590325f49bad2fd444d3e4418be19aec4e11449ac1a57207898bc57d76a1bcf3566292c20c683a5c4648f"},
+		{"several blocks", seq(1000), "c11e1c0340bd7e5a1b275f1230c962fad215ecb1391486e74e31b960a2f2996381a5fad092da06841d5f26e38f6ecfeaf441acbcd1c2de61aef121e7927175f5"},
+	} {
+		newHash, _ := lookupHashAlgo(BLAKE2b)
+		h := newHash()
+		_, _ = h.Write(tc.data)
+		if sum := hex.EncodeToString(h.Sum(nil)); sum != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.expected, sum)
+		}
+		h.Reset()
+		for _, size := range []int{1, 127, 2, 300} {
+			if size > len(tc.data) {
+				size = len(tc.data)
+			}
+			_, _ = h.Write(tc.data[:size])
+			tc.data = tc.data[size:]
+		}
+		_, _ = h.Write(tc.data)
+		if sum := hex.EncodeToString(h.Sum(nil)); sum != tc.expected {
+			t.Errorf("%s (in pieces): expected %s, got %s", tc.name, tc.expected, sum)
+		}
+	}
+}
+
+func TestXXH3(t *testing.T) {
+	newHash, ok := lookupHashAlgo(XXH3)
+	if !ok {
+		t.Fatalf("hash algo [%s] is not registered", XXH3)
+	}
+	if sum := hex.EncodeToString(sumOf(newHash(), nil)); sum != "2d06800538d394c2" {
+		t.Errorf("XXH3-64 of empty input: got %s", sum)
+	}
+}
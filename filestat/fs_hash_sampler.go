@@ -0,0 +1,91 @@
+package filestat
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// GetSampleHashFileFunc customizes hasher func of sampled blocks: count blocks of blockSize (in file blocks if inBlocks)
+// at deterministic offsets spread evenly over the middle of file (see sampleOffsets) are hashed together,
+// so that files with the same headers and trailers (VM images, databases) are told apart without reading them in full;
+// whole file is hashed if it is not larger than all blocks. Files are read as by GetHashFileFunc.
+func GetSampleHashFileFunc(fsys FS, algo string, blockSize int64, count int, inBlocks bool, readMode ReadMode, throttle *Throttle, tracker *HashTracker) (HashFileFunc, error) {
+	fileHasher, ok := lookupHashAlgo(algo)
+	if !ok {
+		return nil, fmt.Errorf("invalid value for algo hashing: [%s] - not supported (supported: %s)", algo, strings.Join(HashAlgos(), ", "))
+	}
+	if blockSize <= 0 || count <= 0 {
+		return nil, fmt.Errorf("invalid sampling: block size [%d] and count [%d] must be positive", blockSize, count)
+	}
+	return func(ctx context.Context, fs FileStat, prefix string) (result string, written int64, err error) {
+		var (
+			h       = fileHasher()
+			size    = fs.Size()
+			bSize   = blockSize
+			offsets []int64
+		)
+		if inBlocks { // files can have different block sizes
+			bSize = bSize * fs.Blksize()
+		}
+		if int64(count)*bSize >= size {
+			offsets, bSize = []int64{0}, size
+		} else {
+			offsets = sampleOffsets(size, bSize, count)
+		}
+		if _, ok := h.(*idleHasher); !ok {
+			if err = throttle.waitOpen(ctx); err != nil {
+				return result, written, err
+			}
+			file, err := openForRead(ctx, fsys, fs.Path(), readMode)
+			if err != nil {
+				return result, written, fmt.Errorf("hasing file [%s] failed: %w", fs.Path(), err)
+			}
+			defer func() {
+				if e := file.Close(); e != nil && err == nil {
+					log.Printf("error while closing file [%s]: %v", fs.Path(), e)
+				}
+			}()
+			tf := tracker.track(fs.Path(), int64(len(offsets))*bSize)
+			defer tracker.untrack(tf)
+			var pos int64
+			for _, offset := range offsets {
+				if err := seekTo(file, pos, offset); err != nil {
+					return result, written, fmt.Errorf("seek file %s (%d) at offset %d is failed: %w", fs.Path(), fs.Size(), offset, err)
+				}
+				n, err := copyN(ctx, h, file, bSize, throttle, tf)
+				written += n
+				if err != nil {
+					return result, written, fmt.Errorf("hashing file [%s] is failed - written %d: %w", fs.Path(), written, err)
+				}
+				pos = offset + bSize
+			}
+		}
+		checksum := hex.EncodeToString(h.Sum(nil))
+		return fmt.Sprintf("%s:%dx%d:%s:%s", prefix, len(offsets), bSize, algo, checksum), written, nil
+	}, nil
+}
+
+// sampleOffsets returns offsets of up to count non overlapping blocks of blockSize spread evenly over file of size
+// (excluding its very head and tail): offsets are aligned to blockSize and depend only on size, blockSize and count,
+// so they are the same for all files of meta group
+func sampleOffsets(size, blockSize int64, count int) []int64 {
+	offsets := make([]int64, 0, count)
+	step := size / int64(count+1)
+	var end int64
+	for i := 1; i <= count; i++ {
+		offset := step * int64(i)
+		offset -= offset % blockSize
+		if offset < end {
+			offset = end
+		}
+		if offset+blockSize > size {
+			break
+		}
+		offsets = append(offsets, offset)
+		end = offset + blockSize
+	}
+	return offsets
+}
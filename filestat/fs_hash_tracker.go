@@ -0,0 +1,83 @@
+package filestat
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultLargeFileSize - files (parts of files) of at least this size are tracked while being hashed
+const DefaultLargeFileSize = 64 << 20
+
+// HashTracker keeps progress of large files being hashed (see GetHashFileFunc)
+type HashTracker struct {
+	sync.Mutex
+	minSize int64
+	files   map[*trackedFile]struct{}
+}
+
+type trackedFile struct {
+	path    string
+	size    int64
+	started time.Time
+	// read - bytes hashed so far (atomic)
+	read int64
+}
+
+// HashingFile - progress of file being hashed
+type HashingFile struct {
+	Path    string
+	Size    int64
+	Read    int64
+	Started time.Time
+}
+
+// HashingStats - large files being hashed (in order of start)
+type HashingStats []HashingFile
+
+// NewHashTracker - tracker of files of at least minSize bytes (0 = DefaultLargeFileSize)
+func NewHashTracker(minSize int64) *HashTracker {
+	if minSize <= 0 {
+		minSize = DefaultLargeFileSize
+	}
+	return &HashTracker{minSize: minSize, files: make(map[*trackedFile]struct{})}
+}
+
+// track starts tracking of file if it is large enough to be tracked (otherwise nil is returned)
+func (t *HashTracker) track(path string, size int64) *trackedFile {
+	if t == nil || size < t.minSize {
+		return nil
+	}
+	tf := trackedFile{path: path, size: size, started: time.Now()}
+	t.Lock()
+	defer t.Unlock()
+	t.files[&tf] = struct{}{}
+	return &tf
+}
+
+func (t *HashTracker) untrack(tf *trackedFile) {
+	if tf != nil {
+		t.Lock()
+		defer t.Unlock()
+		delete(t.files, tf)
+	}
+}
+
+func (tf *trackedFile) add(n int) {
+	if tf != nil {
+		atomic.AddInt64(&tf.read, int64(n))
+	}
+}
+
+// Stats returns HashingStats (so tracker can be passed along with pipeline stat producers)
+func (t *HashTracker) Stats() interface{} {
+	t.Lock()
+	defer t.Unlock()
+	result := make(HashingStats, 0, len(t.files))
+	for tf := range t.files {
+		result = append(result, HashingFile{Path: tf.path, Size: tf.size, Read: atomic.LoadInt64(&tf.read), Started: tf.started})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Started.Before(result[j].Started) })
+	return result
+}
@@ -0,0 +1,142 @@
+package filestat
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// DefaultTreeChunkSize - size of chunks of tree hashing by default
+const DefaultTreeChunkSize = 64 << 20
+
+// TreeHashing - settings of parallel hashing of large files (see GetTreeHashFileFunc)
+type TreeHashing struct {
+	// MinSize - files of at least MinSize bytes are hashed as tree; 0 = off
+	MinSize int64
+	// ChunkSize - size of chunks hashed concurrently; 0 = DefaultTreeChunkSize
+	ChunkSize int64
+	// Workers - max number of chunks of file hashed concurrently (each on its own file descriptor); 0 = NumCPU
+	Workers int
+}
+
+type treeWorkersKey struct{}
+
+// WithTreeWorkers limits number of chunks of file hashed concurrently by tree hasher called with returned ctx
+// (e.g. by number of files read simultaneously from device of file - see filtering.DeviceScheduler)
+func WithTreeWorkers(ctx context.Context, workers int) context.Context {
+	return context.WithValue(ctx, treeWorkersKey{}, workers)
+}
+
+// TreeAlgo - name of algo of tree hash recorded in checksum (so that it is never compared with plain hash of algo)
+func TreeAlgo(algo string, chunkSize int64) string {
+	return fmt.Sprintf("tree_%s_%d", strings.ToLower(algo), chunkSize)
+}
+
+// GetTreeHashFileFunc customizes hasher of full content: files of at least tree.MinSize bytes are split into chunks
+// of tree.ChunkSize hashed concurrently by tree.Workers (but not more than given by WithTreeWorkers), checksum of file is hash of concatenated checksums of chunks
+// recorded with algo TreeAlgo; smaller files are hashed as by GetHashFileFunc
+func GetTreeHashFileFunc(fsys FS, algo string, tree TreeHashing, inBlocks bool, readMode ReadMode, throttle *Throttle, tracker *HashTracker) (HashFileFunc, error) {
+	plainHasher, err := GetHashFileFunc(fsys, algo, 0, inBlocks, readMode, throttle, tracker)
+	if err != nil || tree.MinSize <= 0 {
+		return plainHasher, err
+	}
+	fileHasher, _ := lookupHashAlgo(algo)
+	if _, ok := fileHasher().(*idleHasher); ok {
+		return plainHasher, nil
+	}
+	if tree.ChunkSize <= 0 {
+		tree.ChunkSize = DefaultTreeChunkSize
+	}
+	if tree.Workers <= 0 {
+		tree.Workers = runtime.NumCPU()
+	}
+	treeAlgo := TreeAlgo(algo, tree.ChunkSize)
+	return func(ctx context.Context, fs FileStat, prefix string) (result string, written int64, err error) {
+		size := fs.Size()
+		if size < tree.MinSize || size <= tree.ChunkSize {
+			return plainHasher(ctx, fs, prefix)
+		}
+		chunks := int((size + tree.ChunkSize - 1) / tree.ChunkSize)
+		sums := make([][]byte, chunks)
+		tf := tracker.track(fs.Path(), size)
+		defer tracker.untrack(tf)
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			indexes = make(chan int)
+		)
+		workers := tree.Workers
+		if limit, ok := ctx.Value(treeWorkersKey{}).(int); ok && limit > 0 && workers > limit {
+			workers = limit
+		}
+		if workers > chunks {
+			workers = chunks
+		}
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for index := range indexes {
+					n, e := hashChunk(ctx, fsys, fileHasher, fs.Path(), int64(index)*tree.ChunkSize, tree.ChunkSize, size, readMode, throttle, tf, &sums[index])
+					mu.Lock()
+					written += n
+					if e != nil && err == nil {
+						err = e
+						cancel() // the rest of chunks are not needed
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+	feed:
+		for index := 0; index < chunks; index++ {
+			select {
+			case <-ctx.Done():
+				break feed
+			case indexes <- index:
+			}
+		}
+		close(indexes)
+		wg.Wait()
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			return result, written, fmt.Errorf("tree hashing file [%s] is failed - written %d: %w", fs.Path(), written, err)
+		}
+		h := fileHasher()
+		for _, sum := range sums {
+			h.Write(sum)
+		}
+		return fmt.Sprintf("%s:%d:%s:%s", prefix, size, treeAlgo, hex.EncodeToString(h.Sum(nil))), written, nil
+	}, nil
+}
+
+// hashChunk hashes chunkSize bytes (or the rest of file of size) at offset of file opened on its own descriptor
+func hashChunk(ctx context.Context, fsys FS, newHash NewHashFunc, path string, offset, chunkSize, size int64, readMode ReadMode, throttle *Throttle, tf *trackedFile, sum *[]byte) (written int64, err error) {
+	if size-offset < chunkSize {
+		chunkSize = size - offset
+	}
+	if err = throttle.waitOpen(ctx); err != nil {
+		return 0, err
+	}
+	file, err := openForRead(ctx, fsys, path, readMode)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = file.Close() }()
+	if err = seekTo(file, 0, offset); err != nil {
+		return 0, fmt.Errorf("seek at offset %d is failed: %w", offset, err)
+	}
+	h := newHash()
+	if written, err = copyN(ctx, h, file, chunkSize, throttle, tf); err != nil {
+		return written, err
+	}
+	*sum = h.Sum(nil)
+	return written, nil
+}
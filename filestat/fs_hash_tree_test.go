@@ -0,0 +1,63 @@
+package filestat
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestTreeHash checks that tree checksum doesn't depend on number of workers and never equals plain checksum
+func TestTreeHash(t *testing.T) {
+	const chunkSize = 1000
+	data := make([]byte, 10*chunkSize+123)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	fsys := NewIOFS(fstest.MapFS{"large": {Data: data}})
+	fileStat, err := GetFileStat(fsys, "large", nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainHasher, err := GetHashFileFunc(fsys, SHA256, 0, false, ReadCached, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, _, err := plainHasher(context.Background(), fileStat, "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected string
+	for _, tc := range []struct {
+		workers, limit int
+	}{{1, 0}, {2, 0}, {4, 0}, {16, 0}, {0, 0}, {8, 1}, {8, 3}} {
+		hasher, err := GetTreeHashFileFunc(fsys, SHA256, TreeHashing{MinSize: 1, ChunkSize: chunkSize, Workers: tc.workers}, false, ReadCached, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := context.Background()
+		if tc.limit > 0 {
+			ctx = WithTreeWorkers(ctx, tc.limit)
+		}
+		checksum, written, err := hasher(ctx, fileStat, "0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if written != int64(len(data)) {
+			t.Fatalf("%d workers (limit %d): expected %d bytes hashed, got %d", tc.workers, tc.limit, len(data), written)
+		}
+		if expected == "" {
+			expected = checksum
+		}
+		if checksum != expected {
+			t.Fatalf("%d workers (limit %d): tree checksum %s differs from %s", tc.workers, tc.limit, checksum, expected)
+		}
+	}
+	if expected == plain || !strings.Contains(expected, TreeAlgo(SHA256, chunkSize)) {
+		t.Fatalf("tree checksum %s must be recorded with tree algo and differ from plain one %s", expected, plain)
+	}
+	// plain checksum of the same algo doesn't match by digest either
+	if expected[strings.LastIndex(expected, ":"):] == plain[strings.LastIndex(plain, ":"):] {
+		t.Fatalf("tree digest equals plain digest")
+	}
+}
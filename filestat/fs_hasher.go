@@ -3,17 +3,13 @@
 package filestat
 
 import (
-	"crypto/md5"
-	"crypto/sha1"
-	"crypto/sha256"
-	"crypto/sha512"
+	"context"
 	"encoding/hex"
 	"fmt"
-	"hash"
 	"io"
 	"log"
-	"os"
 	"strings"
+	"sync"
 )
 
 const (
@@ -27,29 +23,18 @@ const (
 const EMPTY_CHECKSUM = "-"
 
 // HashFileFunc - type specifies signature of function that calculates hash / checksum for file [path]
-// initial settings (algo, size, etc.) are taken from closure - see GetHashFileFunc
-type HashFileFunc func(fs FileStat, prefix string) (result string, written int64, err error)
+// initial settings (algo, size, etc.) are taken from closure - see GetHashFileFunc;
+// hashing is stopped (with ctx error) as soon as ctx is done
+type HashFileFunc func(ctx context.Context, fs FileStat, prefix string) (result string, written int64, err error)
 
-// GetHashFileFunc customizes hasher func
-func GetHashFileFunc(algo string, ndMaxSize int64, inBlocks bool) (HashFileFunc, error) {
-	var fileHasher func() hash.Hash
-	switch strings.ToLower(algo) {
-	case Idle:
-		fileHasher = func() hash.Hash { return &idleHasher{} }
-	case MD5:
-		fileHasher = md5.New
-	case SHA1:
-		fileHasher = sha1.New
-	case SHA256:
-		fileHasher = sha256.New
-	case SHA512:
-		fileHasher = sha512.New
-	default:
-		return nil, fmt.Errorf("invalid value for algo hashing: [%s] - not supported", algo)
-		// fileHasher = func() hash.Hash { return &idleHasher{} }
-		// fileHasher = md5.New
+// GetHashFileFunc customizes hasher func: files are read from fsys backend in chunks in readMode (see ReadMode)
+// at rates limited by throttle (nil = unlimited), progress of large files is kept by tracker (nil = off)
+func GetHashFileFunc(fsys FS, algo string, ndMaxSize int64, inBlocks bool, readMode ReadMode, throttle *Throttle, tracker *HashTracker) (HashFileFunc, error) {
+	fileHasher, ok := lookupHashAlgo(algo)
+	if !ok {
+		return nil, fmt.Errorf("invalid value for algo hashing: [%s] - not supported (supported: %s)", algo, strings.Join(HashAlgos(), ", "))
 	}
-	return func(fs FileStat, prefix string) (result string, written int64, err error) {
+	return func(ctx context.Context, fs FileStat, prefix string) (result string, written int64, err error) {
 		var (
 			h        = fileHasher()
 			size     = fs.Size()
@@ -59,7 +44,10 @@ func GetHashFileFunc(algo string, ndMaxSize int64, inBlocks bool) (HashFileFunc,
 			if inBlocks { // dSize is size in blocks
 				dMaxSize = dMaxSize * fs.Blksize() // files can have different block sizes
 			}
-			file, err := os.Open(fs.Path())
+			if err = throttle.waitOpen(ctx); err != nil {
+				return result, written, err
+			}
+			file, err := openForRead(ctx, fsys, fs.Path(), readMode)
 			if err != nil {
 				return result, written, fmt.Errorf("hasing file [%s] failed: %w", fs.Path(), err)
 			}
@@ -78,13 +66,15 @@ func GetHashFileFunc(algo string, ndMaxSize int64, inBlocks bool) (HashFileFunc,
 				if size > fs.Size() {
 					size = fs.Size()
 				}
-				if ret, err := file.Seek(-size, io.SeekEnd); err != nil {
-					return result, written, fmt.Errorf("seek file %s (%d) at offset %d is failed with ret = %d: %w", fs.Path(), fs.Size(), -size, ret, err)
+				if err := seekTo(file, 0, fs.Size()-size); err != nil {
+					return result, written, fmt.Errorf("seek file %s (%d) at offset %d is failed: %w", fs.Path(), fs.Size(), -size, err)
 				}
 			case dMaxSize == 0:
 				// size = fs.Size()
 			}
-			if written, err = io.CopyN(h, file, size); err != nil {
+			tf := tracker.track(fs.Path(), size)
+			defer tracker.untrack(tf)
+			if written, err = copyN(ctx, h, file, size, throttle, tf); err != nil {
 				return result, written, fmt.Errorf("hashing file [%s] is failed - written %d: %w", fs.Path(), written, err)
 			}
 		}
@@ -92,3 +82,64 @@ func GetHashFileFunc(algo string, ndMaxSize int64, inBlocks bool) (HashFileFunc,
 		return fmt.Sprintf("%s:%d:%s:%s", prefix, size, algo, checksum), written, nil
 	}, nil
 }
+
+// hashBufferSize - size of read buffer of hasher
+const hashBufferSize = 128 * 1024
+
+// hashBuffers - read buffers reused by hashers
+var hashBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, hashBufferSize)
+		return &buf
+	},
+}
+
+// copyN copies n bytes from src to dst (like io.CopyN) in chunks as throttle allows;
+// ctx is checked between chunks, so that hashing of large file is stopped quickly
+func copyN(ctx context.Context, dst io.Writer, src io.Reader, n int64, throttle *Throttle, tf *trackedFile) (written int64, err error) {
+	bufPtr := hashBuffers.Get().(*[]byte)
+	defer hashBuffers.Put(bufPtr)
+	buf := *bufPtr
+	for written < n {
+		if err = ctx.Err(); err != nil {
+			return written, err
+		}
+		chunk := throttle.chunk(len(buf))
+		if remaining := n - written; remaining < int64(chunk) {
+			chunk = int(remaining)
+		}
+		if err = throttle.waitRead(ctx, chunk); err != nil {
+			return written, err
+		}
+		nr, er := src.Read(buf[:chunk])
+		if nr > 0 {
+			nw, ew := dst.Write(buf[:nr])
+			written += int64(nw)
+			tf.add(nw)
+			if ew != nil {
+				return written, ew
+			}
+			if nw != nr {
+				return written, io.ErrShortWrite
+			}
+		}
+		if er != nil {
+			return written, er // including io.EOF before n bytes are copied
+		}
+	}
+	return written, nil
+}
+
+// seekTo moves file read position from pos to offset (from start) -
+// by Seek if backend file supports it, otherwise by reading up to offset (so it can only move forward)
+func seekTo(file io.Reader, pos, offset int64) error {
+	if seeker, ok := file.(io.Seeker); ok {
+		ret, err := seeker.Seek(offset, io.SeekStart)
+		if err != nil {
+			return fmt.Errorf("seek returned %d: %w", ret, err)
+		}
+		return nil
+	}
+	_, err := io.CopyN(io.Discard, file, offset-pos)
+	return err
+}
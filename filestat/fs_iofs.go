@@ -0,0 +1,137 @@
+package filestat
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"syscall"
+)
+
+// maxSymlinkHops - max number of symbolic links followed while path is resolved (as by linux MAXSYMLINKS)
+const maxSymlinkHops = 40
+
+// readLinkFS - file system that is able to read symbolic links (like io/fs.ReadLinkFS of Go 1.25+, e.g. fstest.MapFS)
+type readLinkFS interface {
+	LstatFS
+	// ReadLink - target of symbolic link (relative to its dir)
+	ReadLink(name string) (string, error)
+}
+
+// ioFS adapts any io/fs.FS (fstest.MapFS, zip.Reader, embed.FS, overlays, ...) to FS
+// paths are slash separated and unrooted (see fs.ValidPath), "" is treated as root "."
+type ioFS struct {
+	fsys  fs.FS
+	owner *syntheticOwner
+}
+
+// NewIOFS - FS backend built on top of io/fs.FS
+// if fsys implements LstatFS / EvalSymlinksFS they are used, if it is able to read links (see readLinkFS)
+// symbolic links are resolved by ioFS itself (so that loops of links are detected - ELOOP),
+// otherwise symbolic links are not supported (Lstat falls back to Stat and EvalSymlinks returns name as is);
+// files are owned by current user resolved here once (see currentOwner)
+func NewIOFS(fsys fs.FS) FS {
+	return ioFS{fsys: fsys, owner: currentOwner()}
+}
+
+func (r ioFS) syntheticOwner() *syntheticOwner { return r.owner }
+
+func cleanIOName(name string) string {
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (r ioFS) Open(name string) (fs.File, error) {
+	name, err := r.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.fsys.Open(name)
+}
+
+func (r ioFS) Stat(name string) (fs.FileInfo, error) {
+	name, err := r.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(r.fsys, name)
+}
+
+// resolve resolves symbolic links of name if links are read by ioFS itself (see readLinkFS)
+func (r ioFS) resolve(name string) (string, error) {
+	if _, ok := r.fsys.(EvalSymlinksFS); !ok {
+		if rfs, ok := r.fsys.(readLinkFS); ok {
+			return evalLinks(rfs, cleanIOName(name))
+		}
+	}
+	return cleanIOName(name), nil
+}
+
+// evalLinks resolves symbolic links of all elements of name (like filepath.EvalSymlinks)
+func evalLinks(rfs readLinkFS, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "evalsymlinks", Path: name, Err: fs.ErrInvalid}
+	}
+	resolved, rest, hops := ".", strings.Split(name, "/"), 0
+	for len(rest) > 0 {
+		elem := rest[0]
+		rest = rest[1:]
+		if elem == "." {
+			continue
+		}
+		next := path.Join(resolved, elem)
+		fi, err := rfs.Lstat(next)
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if hops++; hops > maxSymlinkHops {
+			return "", &fs.PathError{Op: "evalsymlinks", Path: name, Err: syscall.ELOOP}
+		}
+		target, err := rfs.ReadLink(next)
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(target) {
+			return "", &fs.PathError{Op: "evalsymlinks", Path: name, Err: fs.ErrInvalid}
+		}
+		if target = path.Join(path.Dir(next), target); !fs.ValidPath(target) { // escapes root
+			return "", &fs.PathError{Op: "evalsymlinks", Path: name, Err: fs.ErrInvalid}
+		}
+		// target is resolved from root again
+		resolved, rest = ".", append(strings.Split(target, "/"), rest...)
+	}
+	return resolved, nil
+}
+
+func (r ioFS) Lstat(name string) (fs.FileInfo, error) {
+	if lfs, ok := r.fsys.(LstatFS); ok {
+		return lfs.Lstat(cleanIOName(name))
+	}
+	return r.Stat(name)
+}
+
+func (r ioFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(r.fsys, cleanIOName(name))
+}
+
+func (r ioFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(r.fsys, cleanIOName(pattern))
+}
+
+func (r ioFS) EvalSymlinks(name string) (string, error) {
+	if rfs, ok := r.fsys.(EvalSymlinksFS); ok {
+		return rfs.EvalSymlinks(cleanIOName(name))
+	}
+	if rfs, ok := r.fsys.(readLinkFS); ok {
+		return evalLinks(rfs, cleanIOName(name))
+	}
+	if _, err := r.Stat(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
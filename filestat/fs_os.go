@@ -0,0 +1,136 @@
+package filestat
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// openFilesReserve - open files left for logs, outputs, sockets, os/user lookups, etc.
+	openFilesReserve = 64
+	// defaultOpenFilesLimit - used if limit of open files of process is unknown
+	defaultOpenFilesLimit = 1024
+	minOpenFilesLimit     = 8
+)
+
+var (
+	// openFiles - semaphore limiting files opened simultaneously by osFS (shared by all osFS instances)
+	openFiles = make(chan struct{}, openFilesLimit())
+	// openFilesTaking - slots of openFiles are taken by one taker at a time (see takeOpenFiles)
+	openFilesTaking = make(chan struct{}, 1)
+)
+
+// openFilesLimit - max number of files opened simultaneously by osFS: process limit (RLIMIT_NOFILE) minus reserve
+func openFilesLimit() int {
+	limit, ok := maxOpenFiles()
+	if !ok || limit > 1<<20 { // unknown or unlimited
+		limit = defaultOpenFilesLimit
+	}
+	if limit < minOpenFilesLimit+openFilesReserve {
+		return minOpenFilesLimit
+	}
+	return int(limit - openFilesReserve)
+}
+
+// OpenFilesLimit returns max number of files opened simultaneously by host file system backend (see NewOSFS)
+func OpenFilesLimit() int {
+	return cap(openFiles)
+}
+
+// osFS implements FS on top of os package (paths are os specific: absolute or relative to pwd)
+type osFS struct{}
+
+// NewOSFS - default FS backend: host file system
+// (number of simultaneously opened files is limited by OpenFilesLimit, Open blocks until file is closed by others;
+// pipeline stages wait for it cancelably)
+func NewOSFS() FS {
+	return osFS{}
+}
+
+func (osFS) Open(name string) (fs.File, error) {
+	return openCtx(context.Background(), osFS{}, name)
+}
+
+// takeOpenFiles takes n slots of open files limit for files to be opened on osFS backend (no-op for other backends);
+// it blocks until all of them are free or ctx is done (then none is taken).
+// Slots are taken by one taker at a time, so takers of several slots never hold part of them waiting for the rest.
+func takeOpenFiles(ctx context.Context, fsys FS, n int) error {
+	if _, ok := fsys.(osFS); !ok || n <= 0 {
+		return nil
+	}
+	select {
+	case openFilesTaking <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-openFilesTaking }()
+	for i := 0; i < n; i++ {
+		select {
+		case openFiles <- struct{}{}:
+		case <-ctx.Done():
+			releaseOpenFiles(fsys, i)
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// releaseOpenFiles releases n slots taken by takeOpenFiles (slots of opened files are released by their Close)
+func releaseOpenFiles(fsys FS, n int) {
+	if _, ok := fsys.(osFS); !ok {
+		return
+	}
+	for i := 0; i < n; i++ {
+		<-openFiles
+	}
+}
+
+// openCtx opens file on fsys backend like fsys.Open, but waiting for free slot of open files limit is canceled with ctx
+func openCtx(ctx context.Context, fsys FS, name string) (fs.File, error) {
+	if err := takeOpenFiles(ctx, fsys, 1); err != nil {
+		return nil, err
+	}
+	file, err := openTaken(fsys, name)
+	if err != nil {
+		releaseOpenFiles(fsys, 1)
+	}
+	return file, err
+}
+
+// openTaken opens file on fsys backend holding slot already taken by takeOpenFiles:
+// slot is passed to opened file (released on its Close), it's left to caller if file can't be opened
+func openTaken(fsys FS, name string) (fs.File, error) {
+	if _, ok := fsys.(osFS); !ok {
+		return fsys.Open(name)
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &osFile{File: file}, nil
+}
+
+func (osFS) Stat(name string) (fs.FileInfo, error) { return os.Stat(name) }
+
+func (osFS) Lstat(name string) (fs.FileInfo, error) { return os.Lstat(name) }
+
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+
+func (osFS) Glob(pattern string) ([]string, error) { return filepath.Glob(pattern) }
+
+func (osFS) EvalSymlinks(name string) (string, error) { return filepath.EvalSymlinks(name) }
+
+// osFile - file opened by osFS, its slot of open files limit is released on Close
+type osFile struct {
+	*os.File
+	release sync.Once
+}
+
+func (f *osFile) Close() error {
+	err := f.File.Close()
+	f.release.Do(func() { <-openFiles })
+	return err
+}
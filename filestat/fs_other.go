@@ -0,0 +1,17 @@
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!nacl,!netbsd,!openbsd,!solaris
+
+package filestat
+
+import (
+	"io/fs"
+)
+
+// getSysStat - os specific file info is not supported yet (todo: add windows support), synthetic one is used instead
+func getSysStat(fs.FileInfo) (sysStat, bool) {
+	return sysStat{}, false
+}
+
+// maxOpenFiles - limit of open files is unknown
+func maxOpenFiles() (uint64, bool) {
+	return 0, false
+}
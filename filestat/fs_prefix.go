@@ -0,0 +1,61 @@
+package filestat
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+)
+
+// PrefixFunc checks whether content of file short is prefix of content of file long (short is not larger than long);
+// it reads both files at once chunk by chunk and stops at the first difference
+type PrefixFunc func(ctx context.Context, short, long FileStat) (bool, error)
+
+// GetPrefixFunc customizes prefix checker func: files are read from fsys backend in readMode at rates limited by throttle (nil = unlimited)
+func GetPrefixFunc(fsys FS, readMode ReadMode, throttle *Throttle) PrefixFunc {
+	return func(ctx context.Context, short, long FileStat) (bool, error) {
+		if short.Size() > long.Size() {
+			return false, nil
+		}
+		for i := 0; i < 2; i++ {
+			if err := throttle.waitOpen(ctx); err != nil {
+				return false, err
+			}
+		}
+		files, err := openAllForRead(ctx, fsys, []string{short.Path(), long.Path()}, readMode)
+		if err != nil {
+			return false, fmt.Errorf("prefix check of files [%s] and [%s] failed: %w", short.Path(), long.Path(), err)
+		}
+		defer func() {
+			for _, file := range files {
+				_ = file.Close()
+			}
+		}()
+		shortBuf, longBuf := make([]byte, verifyChunkSize), make([]byte, verifyChunkSize)
+		size := short.Size()
+		for offset := int64(0); offset < size; offset += verifyChunkSize {
+			if err := ctx.Err(); err != nil {
+				return false, err
+			}
+			chunk := int64(verifyChunkSize)
+			if size-offset < chunk {
+				chunk = size - offset
+			}
+			for i, buf := range [][]byte{shortBuf, longBuf} {
+				if err := throttle.waitRead(ctx, int(chunk)); err != nil {
+					return false, err
+				}
+				if _, err := io.ReadFull(files[i], buf[:chunk]); err != nil {
+					if err == io.EOF || err == io.ErrUnexpectedEOF { // truncated meanwhile
+						return false, nil
+					}
+					return false, fmt.Errorf("prefix check of files [%s] and [%s] failed: %w", short.Path(), long.Path(), err)
+				}
+			}
+			if !bytes.Equal(shortBuf[:chunk], longBuf[:chunk]) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+}
@@ -0,0 +1,51 @@
+package filestat
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPrefixFunc(t *testing.T) {
+	full := bytes.Repeat([]byte("0123456789"), verifyChunkSize/5) // two chunks
+	changed := append([]byte(nil), full[:verifyChunkSize+1]...)
+	changed[verifyChunkSize] ^= 1 // differs in the second chunk only
+	fsys := NewIOFS(fstest.MapFS{
+		"full":    &fstest.MapFile{Data: full},
+		"half":    &fstest.MapFile{Data: full[:verifyChunkSize+1]},
+		"head":    &fstest.MapFile{Data: full[:10]},
+		"changed": &fstest.MapFile{Data: changed},
+		"empty":   &fstest.MapFile{},
+	})
+	files := make(map[string]FileStat)
+	for _, name := range []string{"full", "half", "head", "changed", "empty"} {
+		fileStat, err := GetFileStat(fsys, name, nil, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name] = fileStat
+	}
+	prefixFunc := GetPrefixFunc(fsys, ReadFadvise, nil)
+	for _, tc := range []struct {
+		short, long string
+		expected    bool
+	}{
+		{"half", "full", true},
+		{"head", "full", true},
+		{"head", "half", true},
+		{"empty", "full", true},
+		{"full", "full", true},
+		{"changed", "full", false},
+		{"head", "changed", true},
+		{"full", "half", false}, // short is larger
+	} {
+		ok, err := prefixFunc(context.Background(), files[tc.short], files[tc.long])
+		if err != nil {
+			t.Fatalf("%s - %s: %v", tc.short, tc.long, err)
+		}
+		if ok != tc.expected {
+			t.Errorf("%s is prefix of %s: expected %v, got %v", tc.short, tc.long, tc.expected, ok)
+		}
+	}
+}
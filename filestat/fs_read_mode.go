@@ -0,0 +1,183 @@
+package filestat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// ReadMode - how files are read by hashers with respect to page cache
+type ReadMode string
+
+const (
+	// ReadCached - plain reads through page cache
+	ReadCached ReadMode = "cache"
+	// ReadFadvise - sequential read hint before reading, file pages are dropped from page cache after (linux)
+	ReadFadvise ReadMode = "fadvise"
+	// ReadDirect - O_DIRECT reads bypassing page cache (linux); files that can't be opened so are read in fadvise mode
+	ReadDirect ReadMode = "direct"
+)
+
+var errReadModeNotSupported = errors.New("not supported")
+
+// ParseReadMode parses read mode (empty = ReadCached) and checks that it is supported on current platform
+func ParseReadMode(mode string) (ReadMode, error) {
+	switch rm := ReadMode(strings.ToLower(strings.TrimSpace(mode))); rm {
+	case "", ReadCached:
+		return ReadCached, nil
+	case ReadFadvise, ReadDirect:
+		if !readHintsSupported {
+			return ReadCached, fmt.Errorf("read mode [%s] is not supported on this platform", rm)
+		}
+		return rm, nil
+	default:
+		return ReadCached, fmt.Errorf("invalid read mode [%s]: expected %s, %s or %s", mode, ReadCached, ReadFadvise, ReadDirect)
+	}
+}
+
+// ReadFallbackError - file is read in Fallback mode instead of requested Mode (hashing result is not affected)
+type ReadFallbackError struct {
+	Path string
+	// Dev - device of file (0 if unknown)
+	Dev      uint64
+	Mode     ReadMode
+	Fallback ReadMode
+	Err      error
+}
+
+func (e *ReadFallbackError) Error() string {
+	return fmt.Sprintf("read mode [%s] of file [%s] failed, file is read in [%s] mode: %v", e.Mode, e.Path, e.Fallback, e.Err)
+}
+
+func (e *ReadFallbackError) Unwrap() error {
+	return e.Err
+}
+
+type readFallbackHandlerKey struct{}
+
+// WithReadFallbackHandler returns ctx with handler of read mode fallbacks occurred in hashers called with it (see GetHashFileFunc)
+func WithReadFallbackHandler(ctx context.Context, handler func(*ReadFallbackError)) context.Context {
+	return context.WithValue(ctx, readFallbackHandlerKey{}, handler)
+}
+
+// onReadFallback reports fallback of opened file to ctx handler
+func onReadFallback(ctx context.Context, file fs.File, err *ReadFallbackError) {
+	handler, ok := ctx.Value(readFallbackHandlerKey{}).(func(*ReadFallbackError))
+	if !ok || handler == nil {
+		return
+	}
+	if fi, e := file.Stat(); e == nil {
+		if sys, ok := getSysStat(fi); ok {
+			err.Dev = sys.dev
+		}
+	}
+	handler(err)
+}
+
+// ReadFallbacks counts read mode fallbacks so that only the first one of each device and mode is reported
+// (e.g. all files of file system without O_DIRECT support fall back)
+type ReadFallbacks struct {
+	sync.Mutex
+	seen  map[readFallbackKey]struct{}
+	count int64
+}
+
+type readFallbackKey struct {
+	dev  uint64
+	mode ReadMode
+}
+
+// Check counts fallback and returns true if it is the first one of its device and mode
+func (f *ReadFallbacks) Check(err *ReadFallbackError) bool {
+	f.Lock()
+	defer f.Unlock()
+	f.count++
+	key := readFallbackKey{err.Dev, err.Mode}
+	if _, ok := f.seen[key]; ok {
+		return false
+	}
+	if f.seen == nil {
+		f.seen = make(map[readFallbackKey]struct{})
+	}
+	f.seen[key] = struct{}{}
+	return true
+}
+
+// Count - number of fallbacks so far
+func (f *ReadFallbacks) Count() int64 {
+	f.Lock()
+	defer f.Unlock()
+	return f.count
+}
+
+// openForRead opens file in read mode; if mode can't be applied, it falls back to the next one
+// (direct -> fadvise -> cache) and reports fallback to ctx handler.
+// Waiting for free slot of open files limit (see OpenFilesLimit) is canceled with ctx.
+func openForRead(ctx context.Context, fsys FS, path string, mode ReadMode) (fs.File, error) {
+	if err := takeOpenFiles(ctx, fsys, 1); err != nil {
+		return nil, err
+	}
+	file, err := openTakenForRead(ctx, fsys, path, mode)
+	if err != nil {
+		releaseOpenFiles(fsys, 1)
+	}
+	return file, err
+}
+
+// openAllForRead opens files of paths at once (as by openForRead): slots of open files limit are taken for all of them
+// before the first one is opened, so that files are never held open while waiting for the rest;
+// if any file can't be opened, already opened ones are closed
+func openAllForRead(ctx context.Context, fsys FS, paths []string, mode ReadMode) ([]fs.File, error) {
+	if err := takeOpenFiles(ctx, fsys, len(paths)); err != nil {
+		return nil, err
+	}
+	files := make([]fs.File, 0, len(paths))
+	for _, path := range paths {
+		file, err := openTakenForRead(ctx, fsys, path, mode)
+		if err != nil {
+			for _, f := range files {
+				_ = f.Close()
+			}
+			releaseOpenFiles(fsys, len(paths)-len(files))
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// openTakenForRead opens file in read mode holding slot already taken (see openTaken)
+func openTakenForRead(ctx context.Context, fsys FS, path string, mode ReadMode) (fs.File, error) {
+	var directFallback *ReadFallbackError
+	if mode == ReadDirect {
+		file, err := openDirect(fsys, path)
+		if err == nil {
+			return file, nil
+		}
+		if !errors.Is(err, errReadModeNotSupported) && !errors.Is(err, syscall.EINVAL) {
+			return nil, err // file can't be opened at all
+		}
+		directFallback = &ReadFallbackError{Path: path, Mode: ReadDirect, Fallback: ReadFadvise, Err: err}
+		mode = ReadFadvise
+	}
+	file, err := openTaken(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	if directFallback != nil {
+		onReadFallback(ctx, file, directFallback)
+	}
+	if mode != ReadFadvise {
+		return file, nil
+	}
+	advised, err := adviseSequential(file)
+	if err != nil {
+		onReadFallback(ctx, file, &ReadFallbackError{Path: path, Mode: ReadFadvise, Fallback: ReadCached, Err: err})
+		return file, nil
+	}
+	return advised, nil
+}
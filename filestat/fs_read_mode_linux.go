@@ -0,0 +1,115 @@
+package filestat
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"unsafe"
+)
+
+const readHintsSupported = true
+
+// directAlignment - alignment of buffers, offsets and sizes of O_DIRECT reads (logical block size of most devices)
+const directAlignment = 4096
+
+// directBuffers - aligned read buffers of O_DIRECT files
+var directBuffers = sync.Pool{
+	New: func() interface{} {
+		raw := make([]byte, hashBufferSize+directAlignment)
+		shift := directAlignment - int(uintptr(unsafe.Pointer(&raw[0]))%directAlignment)
+		if shift == directAlignment {
+			shift = 0
+		}
+		buf := raw[shift : shift+hashBufferSize]
+		return &buf
+	},
+}
+
+// advisedFile - file read with sequential hint, its pages are dropped from page cache on Close
+type advisedFile struct {
+	*osFile
+}
+
+func (f *advisedFile) Close() error {
+	_ = unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+	return f.osFile.Close()
+}
+
+// adviseSequential hints kernel that file is read sequentially (read ahead is increased)
+func adviseSequential(file fs.File) (fs.File, error) {
+	f, ok := file.(*osFile)
+	if !ok {
+		return file, fmt.Errorf("fadvise: %w for file system backend", errReadModeNotSupported)
+	}
+	if err := unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_SEQUENTIAL); err != nil {
+		return file, fmt.Errorf("fadvise: %w", err)
+	}
+	return &advisedFile{f}, nil
+}
+
+// directFile - file opened with O_DIRECT: it is read by aligned blocks into aligned buffer,
+// so that reads from any offset (e.g. tail prefilter) and of any size are possible
+type directFile struct {
+	*osFile
+	buf *[]byte
+	// bufOffset, bufLen - file offset and size of data in buffer
+	bufOffset int64
+	bufLen    int
+	// offset - logical read position
+	offset int64
+}
+
+// openDirect opens file of host file system bypassing page cache holding slot already taken (see openTaken)
+func openDirect(fsys FS, path string) (fs.File, error) {
+	if _, ok := fsys.(osFS); !ok {
+		return nil, fmt.Errorf("O_DIRECT: %w for file system backend", errReadModeNotSupported)
+	}
+	file, err := os.OpenFile(path, os.O_RDONLY|unix.O_DIRECT, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &directFile{osFile: &osFile{File: file}, buf: directBuffers.Get().(*[]byte)}, nil
+}
+
+func (f *directFile) Read(p []byte) (int, error) {
+	if f.offset < f.bufOffset || f.offset >= f.bufOffset+int64(f.bufLen) {
+		f.bufOffset = f.offset &^ (directAlignment - 1)
+		n, err := f.osFile.ReadAt(*f.buf, f.bufOffset)
+		f.bufLen = n
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if f.offset >= f.bufOffset+int64(n) {
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, (*f.buf)[f.offset-f.bufOffset:f.bufLen])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *directFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	default:
+		return f.offset, fmt.Errorf("seek whence [%d] is not supported by O_DIRECT file", whence)
+	}
+	if offset < 0 {
+		return f.offset, fmt.Errorf("negative seek offset [%d]", offset)
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *directFile) Close() error {
+	if f.buf != nil {
+		directBuffers.Put(f.buf)
+		f.buf = nil
+	}
+	return f.osFile.Close()
+}
@@ -0,0 +1,18 @@
+// +build !linux
+
+package filestat
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+const readHintsSupported = false
+
+func adviseSequential(file fs.File) (fs.File, error) {
+	return file, fmt.Errorf("fadvise: %w", errReadModeNotSupported)
+}
+
+func openDirect(FS, string) (fs.File, error) {
+	return nil, fmt.Errorf("O_DIRECT: %w", errReadModeNotSupported)
+}
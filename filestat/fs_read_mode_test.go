@@ -0,0 +1,37 @@
+package filestat
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadFallbacksAreReportedOncePerDevice(t *testing.T) {
+	fsys := NewIOFS(fstest.MapFS{
+		"a": {Data: []byte("a")},
+		"b": {Data: []byte("b")},
+		"c": {Data: []byte("c")},
+	})
+	var (
+		fallbacks ReadFallbacks
+		reported  []*ReadFallbackError
+	)
+	ctx := WithReadFallbackHandler(context.Background(), func(err *ReadFallbackError) {
+		if fallbacks.Check(err) {
+			reported = append(reported, err)
+		}
+	})
+	for _, path := range []string{"a", "b", "c"} {
+		file, err := openForRead(ctx, fsys, path, ReadFadvise)
+		if err != nil {
+			t.Fatalf("opening [%s] failed: %v", path, err)
+		}
+		_ = file.Close()
+	}
+	if count := fallbacks.Count(); count != 3 {
+		t.Fatalf("expected 3 fallbacks counted, got %d", count)
+	}
+	if len(reported) != 1 || reported[0].Path != "a" || reported[0].Mode != ReadFadvise {
+		t.Fatalf("expected the first fallback to be reported only, got %v", reported)
+	}
+}
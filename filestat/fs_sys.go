@@ -0,0 +1,73 @@
+package filestat
+
+import (
+	"io/fs"
+)
+
+// FS - file system abstraction used by all pipeline stages (searching, validating, hashing)
+// it is io/fs.FS with stat / glob / readdir capabilities and the following extensions:
+// LstatFS - to get file info without following symbolic links,
+// EvalSymlinksFS - to resolve symbolic links.
+// Path format is defined by implementation: NewOSFS works with os specific paths,
+// NewIOFS - with slash separated unrooted paths (see fs.ValidPath)
+type FS interface {
+	fs.StatFS
+	fs.ReadDirFS
+	fs.GlobFS
+	LstatFS
+	EvalSymlinksFS
+}
+
+// LstatFS - file system that is able to describe file without following symbolic link
+type LstatFS interface {
+	fs.FS
+	// Lstat - like os.Lstat
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// EvalSymlinksFS - file system that is able to resolve symbolic links
+type EvalSymlinksFS interface {
+	fs.FS
+	// EvalSymlinks - like filepath.EvalSymlinks
+	EvalSymlinks(name string) (string, error)
+}
+
+// WalkDir walks file tree of root on fsys backend like fs.WalkDir, but root is described by Lstat
+// (as by filepath.WalkDir): symbolic link given as root is passed to fn as is and is not followed
+func WalkDir(fsys FS, root string, fn fs.WalkDirFunc) error {
+	info, err := fsys.Lstat(root)
+	if err == nil && info.IsDir() {
+		return fs.WalkDir(fsys, root, fn)
+	}
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = fn(root, infoDirEntry{info}, nil)
+	}
+	if err == fs.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// infoDirEntry - fs.DirEntry of described file
+type infoDirEntry struct {
+	info fs.FileInfo
+}
+
+func (e infoDirEntry) Name() string               { return e.info.Name() }
+func (e infoDirEntry) IsDir() bool                { return e.info.IsDir() }
+func (e infoDirEntry) Type() fs.FileMode          { return e.info.Mode().Type() }
+func (e infoDirEntry) Info() (fs.FileInfo, error) { return e.info, nil }
+
+// InodeOf returns inode of described file, false if file info is not backed by os specific one
+func InodeOf(info fs.FileInfo) (Inode, bool) {
+	sys, ok := getSysStat(info)
+	return sys.ino, ok
+}
+
+// NlinkOf returns number of hard links of described file, false if file info is not backed by os specific one
+func NlinkOf(info fs.FileInfo) (uint64, bool) {
+	sys, ok := getSysStat(info)
+	return sys.nlink, ok
+}
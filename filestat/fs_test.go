@@ -0,0 +1,38 @@
+package filestat
+
+import (
+	"errors"
+	"github.com/nj-eka/fdups/errs"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestBrokenSymlinks(t *testing.T) {
+	mapFS := fstest.MapFS{
+		"file":        {Data: []byte("content")},
+		"dir/link":    {Data: []byte("../file"), Mode: fs.ModeSymlink},
+		"dangling":    {Data: []byte("missing"), Mode: fs.ModeSymlink},
+		"loop1":       {Data: []byte("loop2"), Mode: fs.ModeSymlink},
+		"loop2":       {Data: []byte("loop1"), Mode: fs.ModeSymlink},
+		"dir/through": {Data: []byte("../loop1/file"), Mode: fs.ModeSymlink},
+	}
+	if _, ok := interface{}(mapFS).(readLinkFS); !ok {
+		t.Skip("fstest.MapFS doesn't support symbolic links (Go < 1.25)")
+	}
+	fsys := NewIOFS(mapFS)
+	fileStat, err := GetFileStat(fsys, "dir/link", nil, nil, true)
+	if err != nil {
+		t.Fatalf("resolving symlink failed: %v", err)
+	}
+	if fileStat.Path() != "file" || fileStat.Symlink() == nil || fileStat.Symlink().Path() != "dir/link" {
+		t.Fatalf("expected symlink [dir/link] to [file], got [%s]", fileStat.Path())
+	}
+	for _, name := range []string{"dangling", "loop1", "dir/through"} {
+		_, err := GetFileStat(fsys, name, nil, nil, true)
+		var e errs.Error
+		if !errors.As(err, &e) || e.Kind() != errs.KindBrokenLink {
+			t.Errorf("[%s]: expected %s error, got %v", name, errs.KindBrokenLink.Name(), err)
+		}
+	}
+}
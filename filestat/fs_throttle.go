@@ -0,0 +1,155 @@
+package filestat
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// throttleMaxWait - read chunk is cut so that it is read within this time at current rate limit
+// (limit changes take effect quickly and hashers are not stuck on huge reservations)
+const throttleMaxWait = 100 * time.Millisecond
+
+// Throttle limits rate of reading (bytes/s) and opening (files/s) of files shared by all hashers
+// (see GetHashFileFunc), so that hashing doesn't starve other services of the host;
+// limits can be changed at any time, 0 = unlimited
+type Throttle struct {
+	read, open rateLimiter
+	// waited - total time hashers have been held back (ns)
+	waited int64
+}
+
+// ThrottleStats - current limits and total time hashers have been held back
+type ThrottleStats struct {
+	ReadRate int64
+	OpenRate int64
+	Waited   time.Duration
+}
+
+func NewThrottle(readRate, openRate int64) *Throttle {
+	t := Throttle{}
+	t.SetLimits(readRate, openRate)
+	return &t
+}
+
+// SetLimits sets read rate (bytes/s) and open rate (files/s); 0 (or negative) = unlimited
+func (t *Throttle) SetLimits(readRate, openRate int64) {
+	t.read.setRate(readRate)
+	t.open.setRate(openRate)
+}
+
+func (t *Throttle) Limits() (readRate, openRate int64) {
+	return t.read.getRate(), t.open.getRate()
+}
+
+// Stats returns ThrottleStats (so throttle can be passed along with pipeline stat producers)
+func (t *Throttle) Stats() interface{} {
+	readRate, openRate := t.Limits()
+	return ThrottleStats{ReadRate: readRate, OpenRate: openRate, Waited: time.Duration(atomic.LoadInt64(&t.waited))}
+}
+
+// waitOpen blocks until file can be opened or ctx is done (then reservation is canceled and ctx error is returned)
+func (t *Throttle) waitOpen(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.wait(ctx, &t.open, 1)
+}
+
+// waitRead blocks until n bytes can be read or ctx is done (as waitOpen)
+func (t *Throttle) waitRead(ctx context.Context, n int) error {
+	if t == nil {
+		return nil
+	}
+	return t.wait(ctx, &t.read, int64(n))
+}
+
+// chunk - size of next read (not greater than size) that fits in throttleMaxWait at current read rate
+func (t *Throttle) chunk(size int) int {
+	if t == nil {
+		return size
+	}
+	rate := t.read.getRate()
+	if rate <= 0 {
+		return size
+	}
+	chunk := int(rate * int64(throttleMaxWait) / int64(time.Second))
+	if chunk < 512 {
+		chunk = 512
+	}
+	if chunk > size {
+		chunk = size
+	}
+	return chunk
+}
+
+func (t *Throttle) wait(ctx context.Context, l *rateLimiter, n int64) error {
+	d, cancel := l.reserve(n)
+	if d <= 0 {
+		return nil
+	}
+	started := time.Now()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		atomic.AddInt64(&t.waited, int64(d))
+		return nil
+	case <-ctx.Done():
+		cancel()
+		atomic.AddInt64(&t.waited, int64(time.Since(started)))
+		return ctx.Err()
+	}
+}
+
+// rateLimiter - evenly spaced reservations of units at rate per second (no bursts)
+type rateLimiter struct {
+	sync.Mutex
+	rate int64
+	// next - time when next reservation starts
+	next time.Time
+	// epoch - number of rate changes (reservations made at previous rate are not canceled)
+	epoch int64
+}
+
+func (l *rateLimiter) setRate(rate int64) {
+	if rate < 0 {
+		rate = 0
+	}
+	l.Lock()
+	defer l.Unlock()
+	l.rate = rate
+	l.next = time.Time{} // reservations made at previous rate are forgiven
+	l.epoch++
+}
+
+func (l *rateLimiter) getRate() int64 {
+	l.Lock()
+	defer l.Unlock()
+	return l.rate
+}
+
+// reserve reserves n units and returns time to wait before using them and func to cancel reservation
+// (time reserved is given back to next reservations)
+func (l *rateLimiter) reserve(n int64) (time.Duration, func()) {
+	l.Lock()
+	defer l.Unlock()
+	if l.rate <= 0 {
+		return 0, func() {}
+	}
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	span, epoch := time.Duration(n*int64(time.Second)/l.rate), l.epoch
+	l.next = l.next.Add(span)
+	return wait, func() {
+		l.Lock()
+		defer l.Unlock()
+		if l.epoch == epoch {
+			l.next = l.next.Add(-span)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package filestat
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestThrottleWaitIsCanceled(t *testing.T) {
+	throttle := NewThrottle(1024, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := throttle.waitRead(ctx, 1024); err != nil { // the first reservation is not waited for
+		t.Fatalf("unexpected error: %v", err)
+	}
+	started := time.Now()
+	if err := throttle.waitRead(ctx, 10*1024); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("wait is not canceled with ctx: %v", elapsed)
+	}
+	// canceled reservation is given back: the next one waits only for the first one (1s)
+	if wait, _ := throttle.read.reserve(1); wait > time.Second {
+		t.Fatalf("canceled reservation is not given back: next wait %v", wait)
+	}
+}
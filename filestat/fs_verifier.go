@@ -0,0 +1,225 @@
+package filestat
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+const (
+	// verifyChunkSize - size of chunk read from each file at once
+	verifyChunkSize = 64 * 1024
+	// VerifyMaxOpenFiles - max number of files of group opened at once by VerifyFunc (but not more than OpenFilesLimit);
+	// larger groups are verified in batches, each together with representatives of classes found by previous ones
+	VerifyMaxOpenFiles = 64
+)
+
+// VerifyFunc compares contents of files (one per inode) byte by byte reading them all at once;
+// returns classes of files with equal content (in order of files, classes of single file are dropped)
+// and files modified while being verified (their size or modification time differ from FileStat)
+type VerifyFunc func(ctx context.Context, files []FileStat) (classes [][]FileStat, modified []FileStat, err error)
+
+// GetVerifyFunc customizes verifier func: files are read from fsys backend in readMode at rates limited by throttle (nil = unlimited).
+// Groups larger than VerifyMaxOpenFiles are verified in batches: files of batch are compared with each other and
+// with representatives (the first file) of classes found so far, files equal to representative join its class,
+// the rest form new classes. If representatives take more than half of batch, they are compared in parts.
+func GetVerifyFunc(fsys FS, readMode ReadMode, throttle *Throttle) VerifyFunc {
+	return func(ctx context.Context, files []FileStat) (classes [][]FileStat, modified []FileStat, err error) {
+		if len(files) < 2 {
+			return nil, nil, nil
+		}
+		maxOpen := VerifyMaxOpenFiles
+		if limit := OpenFilesLimit(); maxOpen > limit {
+			maxOpen = limit
+		}
+		isModified := make(map[FileStat]bool)
+		for pending := files; len(pending) > 0; {
+			var reps []FileStat
+			repClass := make(map[FileStat]int)
+			for i, class := range classes {
+				if len(class) > 0 {
+					reps = append(reps, class[0])
+					repClass[class[0]] = i
+				}
+			}
+			size := maxOpen - len(reps)
+			if size < maxOpen/2 {
+				size = maxOpen / 2
+			}
+			if size > len(pending) {
+				size = len(pending)
+			}
+			unmatched := pending[:size]
+			pending = pending[size:]
+			partSize := maxOpen - size
+			var newClasses [][]FileStat
+			for from := 0; ; from += partSize {
+				to := from + partSize
+				if to > len(reps) {
+					to = len(reps)
+				}
+				batch := append(append(make([]FileStat, 0, to-from+len(unmatched)), reps[from:to]...), unmatched...)
+				batchClasses, batchModified, err := verifyBatch(ctx, fsys, readMode, throttle, batch)
+				if err != nil {
+					return nil, nil, err
+				}
+				for _, fileStat := range batchModified {
+					if isModified[fileStat] {
+						continue // representative is compared in several batches
+					}
+					isModified[fileStat] = true
+					modified = append(modified, fileStat)
+					if i, ok := repClass[fileStat]; ok { // the next member represents class
+						classes[i] = classes[i][1:]
+					}
+				}
+				matched := make(map[FileStat]bool)
+				newClasses = newClasses[:0]
+				for _, class := range batchClasses {
+					i, ok := repClass[class[0]]
+					if !ok {
+						newClasses = append(newClasses, class)
+						continue
+					}
+					for _, fileStat := range class[1:] {
+						if _, isRep := repClass[fileStat]; !isRep {
+							classes[i] = append(classes[i], fileStat)
+							matched[fileStat] = true
+						}
+					}
+				}
+				left := unmatched[:0:0]
+				for _, fileStat := range unmatched {
+					if !matched[fileStat] && !isModified[fileStat] {
+						left = append(left, fileStat)
+					}
+				}
+				unmatched = left
+				if to == len(reps) || len(unmatched) == 0 {
+					break
+				}
+			}
+			// files left unmatched were compared with each other in the last batch
+			for _, class := range newClasses {
+				var members []FileStat
+				for _, fileStat := range class {
+					if _, isRep := repClass[fileStat]; !isRep {
+						members = append(members, fileStat)
+					}
+				}
+				if len(members) > 0 {
+					classes = append(classes, members)
+				}
+			}
+		}
+		return dropSingles(classes), modified, nil
+	}
+}
+
+type verifiedFile struct {
+	FileStat
+	file fs.File
+	buf  []byte
+	// n - bytes in buf read by the last chunk
+	n int
+}
+
+// verifyBatch reads all files of batch at once chunk by chunk; files are split into classes as soon as their chunks differ
+// (classes of single file are kept - they are merged with classes of other batches by GetVerifyFunc)
+func verifyBatch(ctx context.Context, fsys FS, readMode ReadMode, throttle *Throttle, batch []FileStat) (classes [][]FileStat, modified []FileStat, err error) {
+	paths := make([]string, 0, len(batch))
+	for _, fileStat := range batch {
+		if err = throttle.waitOpen(ctx); err != nil {
+			return nil, nil, err
+		}
+		paths = append(paths, fileStat.Path())
+	}
+	files, err := openAllForRead(ctx, fsys, paths, readMode)
+	if err != nil {
+		return nil, nil, fmt.Errorf("verification of files failed: %w", err)
+	}
+	members := make([]*verifiedFile, 0, len(batch))
+	for i, fileStat := range batch {
+		members = append(members, &verifiedFile{FileStat: fileStat, file: files[i], buf: make([]byte, verifyChunkSize)})
+	}
+	defer func() {
+		for _, vf := range members {
+			_ = vf.file.Close()
+		}
+	}()
+	size := batch[0].Size()
+	groups, done := [][]*verifiedFile{members}, [][]*verifiedFile(nil)
+	for offset := int64(0); offset < size && len(groups) > 0; offset += verifyChunkSize {
+		if err = ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		chunk := int64(verifyChunkSize)
+		if size-offset < chunk {
+			chunk = size - offset
+		}
+		var next [][]*verifiedFile
+		for _, group := range groups {
+			var read []*verifiedFile
+			for _, vf := range group {
+				if err = throttle.waitRead(ctx, int(chunk)); err != nil {
+					return nil, nil, err
+				}
+				if vf.n, err = io.ReadFull(vf.file, vf.buf[:chunk]); err != nil {
+					if err == io.EOF || err == io.ErrUnexpectedEOF { // truncated meanwhile
+						modified = append(modified, vf.FileStat)
+						continue
+					}
+					return nil, nil, fmt.Errorf("verification of file [%s] failed: %w", vf.Path(), err)
+				}
+				read = append(read, vf)
+			}
+			// split group by chunk content (order of files is kept)
+			var split [][]*verifiedFile
+		nextFile:
+			for _, vf := range read {
+				for i, class := range split {
+					if bytes.Equal(class[0].buf[:class[0].n], vf.buf[:vf.n]) {
+						split[i] = append(class, vf)
+						continue nextFile
+					}
+				}
+				split = append(split, []*verifiedFile{vf})
+			}
+			for _, class := range split {
+				if len(class) > 1 {
+					next = append(next, class)
+				} else {
+					done = append(done, class) // file differing from others is not read further
+				}
+			}
+		}
+		groups = next
+	}
+	for _, group := range append(done, groups...) {
+		class := make([]FileStat, 0, len(group))
+		for _, vf := range group {
+			// file is modified meanwhile if it has grown or its modification time has changed
+			if fi, err := fsys.Stat(vf.Path()); err != nil || fi.Size() != vf.Size() || !fi.ModTime().Equal(vf.ModTime()) {
+				modified = append(modified, vf.FileStat)
+				continue
+			}
+			class = append(class, vf.FileStat)
+		}
+		if len(class) > 0 {
+			classes = append(classes, class)
+		}
+	}
+	return classes, modified, nil
+}
+
+func dropSingles(classes [][]FileStat) [][]FileStat {
+	result := classes[:0]
+	for _, class := range classes {
+		if len(class) > 1 {
+			result = append(result, class)
+		}
+	}
+	return result
+}
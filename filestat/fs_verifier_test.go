@@ -0,0 +1,67 @@
+package filestat
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"testing/fstest"
+)
+
+// TestVerifyLargeGroup checks that classes of group verified in several batches are merged:
+// equal files of different batches get into one class and each file gets into one class only
+func TestVerifyLargeGroup(t *testing.T) {
+	for _, classCount := range []int{3, VerifyMaxOpenFiles} { // representatives of many classes are compared in parts
+		t.Run(fmt.Sprintf("%d classes", classCount), func(t *testing.T) {
+			testVerifyLargeGroup(t, classCount)
+		})
+	}
+}
+
+func testVerifyLargeGroup(t *testing.T, classCount int) {
+	count := 3*VerifyMaxOpenFiles + 1
+	mapFS := fstest.MapFS{}
+	for i := 0; i < count; i++ {
+		content := fmt.Sprintf("%04d", i%classCount)
+		if i == count-1 {
+			content = "last" // the only file with such content
+		}
+		mapFS[fmt.Sprintf("f%03d", i)] = &fstest.MapFile{Data: []byte(content)}
+	}
+	fsys := NewIOFS(mapFS)
+	files := make([]FileStat, 0, count)
+	for i := 0; i < count; i++ {
+		fileStat, err := GetFileStat(fsys, fmt.Sprintf("f%03d", i), nil, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, fileStat)
+	}
+	classes, modified, err := GetVerifyFunc(fsys, ReadFadvise, nil)(context.Background(), files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(modified) != 0 {
+		t.Fatalf("unexpected modified files: %v", modified)
+	}
+	if len(classes) != classCount {
+		t.Fatalf("expected %d classes, got %d", classCount, len(classes))
+	}
+	seen := make(map[FileStat]bool)
+	for i, class := range classes {
+		if class[0] != files[i] {
+			t.Fatalf("class %d must start with [%s], got [%s]", i, files[i].Path(), class[0].Path())
+		}
+		for _, fileStat := range class {
+			if seen[fileStat] {
+				t.Fatalf("file [%s] is in several classes", fileStat.Path())
+			}
+			seen[fileStat] = true
+			if string(mapFS[fileStat.Path()].Data) != string(mapFS[class[0].Path()].Data) {
+				t.Fatalf("file [%s] differs from [%s]", fileStat.Path(), class[0].Path())
+			}
+		}
+	}
+	if len(seen) != count-1 {
+		t.Fatalf("expected %d files in classes, got %d", count-1, len(seen))
+	}
+}
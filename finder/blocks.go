@@ -0,0 +1,115 @@
+package finder
+
+import (
+	"context"
+	erf "github.com/nj-eka/fdups/errflow"
+	"github.com/nj-eka/fdups/workflow"
+	"github.com/nj-eka/fdups/workflow/chunking"
+	"github.com/nj-eka/fdups/workflow/searching"
+	"github.com/nj-eka/fdups/workflow/validating"
+	"time"
+)
+
+// BlockStats - content-defined chunks of files (see chunking.BlockStats)
+type BlockStats = chunking.BlockStats
+
+// RootBlockStats - content-defined chunks of files of root (see chunking.RootBlockStats)
+type RootBlockStats = chunking.RootBlockStats
+
+// BlockResult - estimate of block-level dedup savings made by Finder.AnalyzeBlocks
+type BlockResult struct {
+	// ChunkSize - average size of chunks
+	ChunkSize int
+	// Total - chunks of all files (unique across roots)
+	Total BlockStats
+	// Roots - chunks of files per root (unique within root)
+	Roots []RootBlockStats
+	// IsCompleted - false if processing was interrupted (so result is partial)
+	IsCompleted bool
+	// Stats - statistics of all pipeline stages (see output.PrintStats)
+	Stats []workflow.StatProducer
+}
+
+func newBlockResult(chunkSize int, blocks *chunking.BlockDedupStats, stats []workflow.StatProducer) *BlockResult {
+	return &BlockResult{
+		ChunkSize:   chunkSize,
+		Total:       blocks.Total(),
+		Roots:       blocks.Roots(),
+		IsCompleted: blocks.IsCompleted(),
+		Stats:       stats,
+	}
+}
+
+// AnalyzeBlocks estimates how much space block-level dedup would save: files found and validated as by Run
+// are split into content-defined chunks of Options.ChunkSize on average (hard links are counted once)
+// and their unique chunks are counted per root and overall.
+// If ctx is done, partial result is returned along with ctx error (or ErrAborted if run is aborted by error policy).
+func (f *Finder) AnalyzeBlocks(ctx context.Context) (*BlockResult, error) {
+	startTime := time.Now()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// pipeline building
+	searcher := searching.NewSearcher(
+		ctx,
+		f.opts.FS,
+		f.opts.Roots,
+		f.opts.Patterns,
+		f.opts.Search,
+		f.opts.FoundFilesInitCapacity,
+	)
+	validator := validating.NewValidator(
+		ctx,
+		f.opts.FS,
+		searcher.FoundFilePathsCh(),
+		f.statMetaKeyFunc,
+		f.priorDupsFunc,
+		f.statValidatorFunc,
+		f.opts.SymlinkEnabled,
+		f.opts.Retry,
+		f.opts.Validation,
+		f.opts.FoundFilesInitCapacity,
+	)
+	chunker := chunking.NewChunker(
+		ctx,
+		validator.ValidatedFileStatCh(),
+		f.opts.Roots,
+		f.chunkFileFunc,
+		f.opts.Retry,
+		f.opts.Hashing,
+	)
+	errModerator, err := erf.NewErrorModerator(
+		ctx,
+		cancel,
+		f.opts.ErrorPolicy,
+		f.opts.ErrorReporter,
+		searcher,
+		validator,
+		chunker,
+	)
+	if err != nil {
+		return nil, err
+	}
+	pipeline := workflow.Pipelines{
+		errModerator,
+		chunker,
+		validator,
+		searcher,
+	}
+	blocks := chunker.Stats().(*chunking.BlockDedupStats)
+	statProducers := func() []workflow.StatProducer {
+		return append(pipeline.StatProducers(), f.throttle, f.tracker)
+	}
+	progress := func() {
+		if f.opts.OnProgress != nil {
+			f.opts.OnProgress(newProgress(startTime, statProducers()))
+		}
+	}
+
+	// run pipeline
+	finish := workflow.Run(ctx, pipeline.Runners()...)
+	if err := f.monitor(ctx, finish, errModerator, progress); err != nil {
+		return newBlockResult(f.opts.ChunkSize, blocks, statProducers()), err
+	}
+	return newBlockResult(f.opts.ChunkSize, blocks, statProducers()), nil
+}
@@ -0,0 +1,346 @@
+// Package finder provides embeddable Go API for finding duplicate files:
+// it builds and runs the same pipeline as fdups utility (searching -> validating -> meta filtering -> content filtering)
+package finder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	erf "github.com/nj-eka/fdups/errflow"
+	fs "github.com/nj-eka/fdups/filestat"
+	"github.com/nj-eka/fdups/registrator"
+	"github.com/nj-eka/fdups/workflow"
+	"github.com/nj-eka/fdups/workflow/filtering"
+	"github.com/nj-eka/fdups/workflow/searching"
+	"github.com/nj-eka/fdups/workflow/validating"
+	"strings"
+	"time"
+)
+
+// Finder - configured (see New) duplicates finding pipeline
+type Finder struct {
+	opts Options
+
+	statValidatorFunc fs.FileStatValidatorFunc
+	statMetaKeyFunc   fs.MetaKeyFunc
+	priorDupsFunc     fs.PriorFunc
+	stages            []filtering.HashStage
+	verifyFunc        fs.VerifyFunc
+	chunkFileFunc     fs.ChunkFileFunc
+	headHash          fs.HashFileFunc
+	headIndex         int // index of head stage of headHash
+	headSkip          fs.FileSizeLesserFunc
+	prefixFunc        fs.PrefixFunc
+	throttle          *fs.Throttle
+	tracker           *fs.HashTracker
+}
+
+// Find finds duplicates with options opts (shortcut for New + Run)
+func Find(ctx context.Context, opts Options) (*Result, error) {
+	f, err := New(opts)
+	if err != nil {
+		return nil, err
+	}
+	return f.Run(ctx)
+}
+
+// New validates options and prepares pipeline functions
+func New(opts Options) (*Finder, error) {
+	var err error
+	if opts.FS == nil {
+		opts.FS = fs.NewOSFS()
+	}
+	if len(opts.Roots) == 0 {
+		return nil, fmt.Errorf("no roots to search")
+	}
+	for _, root := range opts.Roots {
+		if fi, err := opts.FS.Stat(root); err != nil {
+			return nil, fmt.Errorf("invalid root: %w", err)
+		} else if !fi.IsDir() {
+			return nil, fmt.Errorf("invalid root: not a directory [%s]", root)
+		}
+	}
+	if len(opts.Patterns) == 0 {
+		opts.Patterns = []string{DefaultPattern}
+	}
+	if opts.Patterns, err = ExpandPatterns(opts.Patterns); err != nil {
+		return nil, err
+	}
+	for _, stage := range []struct {
+		name        string
+		concurrency workflow.Concurrency
+	}{
+		{"search", opts.Search},
+		{"validation", opts.Validation},
+		{"metafilter", opts.MetaFilter},
+		{"hashing", opts.Hashing},
+	} {
+		if err = stage.concurrency.Validate(stage.name); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ReadMode, err = fs.ParseReadMode(string(opts.ReadMode)); err != nil {
+		return nil, err
+	}
+	if opts.TreeHashing.MinSize < 0 || opts.TreeHashing.ChunkSize < 0 || opts.TreeHashing.Workers < 0 {
+		return nil, fmt.Errorf("invalid tree hashing min size (%d) / chunk size (%d) / workers (%d): must not be negative", opts.TreeHashing.MinSize, opts.TreeHashing.ChunkSize, opts.TreeHashing.Workers)
+	}
+	if opts.ReadRate < 0 || opts.OpenRate < 0 {
+		return nil, fmt.Errorf("invalid read rate (%d) / open rate (%d): must not be negative", opts.ReadRate, opts.OpenRate)
+	}
+	if opts.ProgressRate <= 0 {
+		opts.ProgressRate = DefaultProgressRate
+	}
+	if opts.FoundFilesInitCapacity <= 0 {
+		opts.FoundFilesInitCapacity = DefaultOptions().FoundFilesInitCapacity
+	}
+	if opts.DupGroupsInitCapacity <= 0 {
+		opts.DupGroupsInitCapacity = DefaultOptions().DupGroupsInitCapacity
+	}
+	fixedChain := len(opts.Stages) == 0
+	if fixedChain {
+		opts.Stages = legacyStages(opts)
+	}
+	if opts.Tuning.Enabled && len(opts.Stages) == 1 {
+		fixedChain = true
+		head := Stage{Type: StageHead, Settings: DefaultAdaptiveHeadHashing}
+		if opts.SizeInBlocks {
+			head.Settings = fs.SHA1 + ";1"
+		}
+		opts.Stages = append([]Stage{head}, opts.Stages...)
+	}
+	if last := opts.Stages[len(opts.Stages)-1]; (last.Type != StageFull && last.Type != StageCustom) || last.MinSize > 0 {
+		return nil, fmt.Errorf("invalid final stage [%s]: it must be full or custom one applied to all files", last)
+	}
+	f := Finder{
+		opts:     opts,
+		throttle: fs.NewThrottle(opts.ReadRate, opts.OpenRate),
+		tracker:  fs.NewHashTracker(fs.DefaultLargeFileSize),
+	}
+
+	// validator
+	f.statValidatorFunc = fs.NewRegularSizeStatValidator(opts.MinSize, opts.MaxSize)
+
+	// meta filters
+	metaGroups := map[rune]bool{'s': true}
+	for _, rc := range strings.ToLower(opts.MetaGroups) {
+		metaGroups[rc] = true
+	}
+	f.statMetaKeyFunc = fs.NewMetaKeyFunc(
+		metaGroups['s'],
+		metaGroups['n'],
+		metaGroups['p'],
+		metaGroups['u'],
+		metaGroups['g'],
+		metaGroups['m'],
+	)
+
+	// hash filter stages
+	env := StageEnv{FS: opts.FS, SizeInBlocks: opts.SizeInBlocks, ReadMode: opts.ReadMode, Throttle: f.throttle, Tracker: f.tracker, TreeHashing: opts.TreeHashing}
+	var prefiltersSize int64
+	for i, stage := range opts.Stages {
+		hasher, size, err := stage.newHasher(env)
+		if err != nil {
+			return nil, fmt.Errorf("hash filter stage [%d] init [%s] failed: %w", i, stage, err)
+		}
+		f.stages = append(f.stages, filtering.HashStage{Name: string(stage.Type) + " " + stage.Settings, Hash: hasher})
+		prefiltersSize += size
+		if stage.Type == StageHead && f.headHash == nil {
+			f.headHash, f.headSkip = hasher, fs.NewFileSizeLesserFunc(size, opts.SizeInBlocks)
+			f.headIndex = i
+		}
+	}
+	// files smaller than all prefilters of fixed chain together skip them (see legacyStages)
+	if fixedChain {
+		for i := range opts.Stages[:len(opts.Stages)-1] {
+			opts.Stages[i].MinSize = prefiltersSize
+		}
+	}
+	for i, stage := range opts.Stages {
+		if stage.MinSize > 0 {
+			f.stages[i].Skip = fs.NewFileSizeLesserFunc(stage.MinSize, opts.SizeInBlocks)
+		}
+	}
+	f.opts.Stages = opts.Stages
+
+	// byte-by-byte verification of final groups
+	if opts.Verify {
+		f.verifyFunc = fs.GetVerifyFunc(opts.FS, opts.ReadMode, f.throttle)
+	}
+
+	// truncated copies detection (by checksums of head prefilter)
+	if opts.Truncated {
+		if f.headHash == nil {
+			return nil, fmt.Errorf("truncated copies detection requires head prefilter stage")
+		}
+		f.prefixFunc = fs.GetPrefixFunc(opts.FS, opts.ReadMode, f.throttle)
+	}
+
+	// content-defined chunking of block-level dedup estimate
+	if opts.ChunkSize == 0 {
+		opts.ChunkSize = fs.DefaultChunkAvgSize
+	}
+	chunkerSettings, err := fs.NewChunkerSettings(opts.ChunkSize)
+	if err != nil {
+		return nil, err
+	}
+	f.opts.ChunkSize = chunkerSettings.AvgSize
+	f.chunkFileFunc = fs.GetChunkFileFunc(opts.FS, chunkerSettings, opts.ReadMode, f.throttle, f.tracker)
+
+	// dups priority (for output ordering)
+	f.priorDupsFunc = fs.NewPriorFunc(opts.Roots)
+	return &f, nil
+}
+
+// Options returns validated options finder works with
+func (f *Finder) Options() Options {
+	return f.opts
+}
+
+// Throttle returns limiter of hashing reads / opens (limits can be changed while running)
+func (f *Finder) Throttle() *fs.Throttle {
+	return f.throttle
+}
+
+// ErrAborted - run is aborted by error policy (see Options.ErrorPolicy)
+var ErrAborted = errors.New("run is aborted by error policy")
+
+// Run builds and runs pipeline until all duplicates are found or ctx is done.
+// In the latter case, partial result is returned along with ctx error
+// (or ErrAborted if run is aborted by error policy).
+func (f *Finder) Run(ctx context.Context) (*Result, error) {
+	startTime := time.Now()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // in case of early return (on error) - signal to close already running goroutines
+
+	// pipeline building
+	searcher := searching.NewSearcher(
+		ctx,
+		f.opts.FS,
+		f.opts.Roots,
+		f.opts.Patterns,
+		f.opts.Search,
+		f.opts.FoundFilesInitCapacity,
+	)
+	validator := validating.NewValidator(
+		ctx,
+		f.opts.FS,
+		searcher.FoundFilePathsCh(),
+		f.statMetaKeyFunc,
+		f.priorDupsFunc,
+		f.statValidatorFunc,
+		f.opts.SymlinkEnabled,
+		f.opts.Retry,
+		f.opts.Validation,
+		f.opts.FoundFilesInitCapacity,
+	)
+	validatedCh := validator.ValidatedFileStatCh()
+	var truncationFilter filtering.TruncationFilter
+	stages := f.stages
+	if f.opts.Truncated {
+		// head of each file is read once by truncation filter and head prefilter stage together
+		headHash := filtering.NewHeadChecksums(f.headHash).Hash
+		stages = append([]filtering.HashStage(nil), f.stages...)
+		stages[f.headIndex].Hash = headHash
+		truncationFilter = filtering.NewTruncationFilter(
+			ctx,
+			validatedCh,
+			headHash,
+			f.headSkip,
+			f.prefixFunc,
+			f.opts.Retry,
+			f.opts.Hashing,
+		)
+		validatedCh = truncationFilter.OutputCh()
+	}
+	metaFilter := filtering.NewMetaFilter(
+		ctx,
+		validatedCh,
+		f.opts.MetaFilter,
+		f.opts.FoundFilesInitCapacity,
+	)
+	contentFilter := filtering.NewContentFilter(
+		ctx,
+		metaFilter.DuplicateCh(),
+		metaFilter.Stats().(registrator.MifsRegister),
+		stages,
+		f.verifyFunc,
+		f.opts.OnGroupEvent,
+		f.opts.Retry,
+		f.opts.Hashing,
+		f.opts.Tuning,
+		f.opts.Scheduling,
+		f.opts.DupGroupsInitCapacity,
+	)
+	errProducers := []erf.ErrorProducer{searcher, validator, metaFilter, contentFilter}
+	if truncationFilter != nil {
+		errProducers = append(errProducers, truncationFilter)
+	}
+	errModerator, err := erf.NewErrorModerator(
+		ctx,
+		cancel,
+		f.opts.ErrorPolicy,
+		f.opts.ErrorReporter,
+		errProducers...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	pipeline := workflow.Pipelines{
+		errModerator,
+		contentFilter,
+		metaFilter,
+	}
+	var truncated *filtering.TruncationStats
+	if truncationFilter != nil {
+		pipeline = append(pipeline, truncationFilter)
+		truncated = truncationFilter.Stats().(*filtering.TruncationStats)
+	}
+	pipeline = append(pipeline, validator, searcher)
+	dups := contentFilter.Stats().(*filtering.ContentFilterStats)
+	statProducers := func() []workflow.StatProducer {
+		return append(pipeline.StatProducers(), f.throttle, f.tracker)
+	}
+	progress := func() {
+		if f.opts.OnProgress != nil {
+			f.opts.OnProgress(newProgress(startTime, statProducers()))
+		}
+	}
+
+	// run pipeline
+	finish := workflow.Run(ctx, pipeline.Runners()...)
+	if err := f.monitor(ctx, finish, errModerator, progress); err != nil {
+		return newResult(dups, truncated, statProducers()), err
+	}
+	return newResult(dups, truncated, statProducers()), nil
+}
+
+// monitor reports progress of running pipeline until it is finished (or ctx is done);
+// on finish all errors are passed through error moderator
+func (f *Finder) monitor(ctx context.Context, finish <-chan struct{}, errModerator erf.ErrorModerator, progress func()) error {
+	summarizeErrors := func() {
+		if f.opts.ErrorReporter != nil {
+			f.opts.ErrorReporter.Summary(errModerator.Stats().(erf.ErrorStats))
+		}
+	}
+	for {
+		select {
+		case <-finish:
+			summarizeErrors()
+			if err := errModerator.Err(); err != nil {
+				return fmt.Errorf("%w: %v", ErrAborted, err)
+			}
+			progress()
+			return nil
+		case <-ctx.Done():
+			<-finish
+			summarizeErrors()
+			if err := errModerator.Err(); err != nil {
+				return fmt.Errorf("%w: %v", ErrAborted, err)
+			}
+			return ctx.Err()
+		case <-time.After(f.opts.ProgressRate):
+			progress()
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package finder
+
+import (
+	"context"
+	fs "github.com/nj-eka/fdups/filestat"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFindOnMapFS(t *testing.T) {
+	content := []byte("duplicated content")
+	fsys := fstest.MapFS{
+		"a/one.txt":       {Data: content},
+		"a/sub/two.txt":   {Data: content},
+		"b/three.txt":     {Data: content},
+		"b/other.txt":     {Data: []byte("other content")},
+		"b/same_size.txt": {Data: []byte("duplicated CONTENT")},
+		"b/empty.txt":     {Data: nil},
+	}
+	opts := DefaultOptions("a", "b")
+	opts.FS = fs.NewIOFS(fsys)
+	opts.HeadHashing = fs.XXH64 + ";4"
+	result, err := Find(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	if !result.IsCompleted {
+		t.Fatalf("result is not completed")
+	}
+	groups := result.Groups()
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 group of duplicates, got %d", len(groups))
+	}
+	var paths []string
+	for _, file := range groups[0].Files {
+		paths = append(paths, file.Path())
+	}
+	sort.Strings(paths)
+	expected := []string{"a/one.txt", "a/sub/two.txt", "b/three.txt"}
+	if len(paths) != len(expected) {
+		t.Fatalf("expected files %v, got %v", expected, paths)
+	}
+	for i := range expected {
+		if paths[i] != expected[i] {
+			t.Fatalf("expected files %v, got %v", expected, paths)
+		}
+	}
+	if wasted := groups[0].Wasted(); wasted != int64(2*len(content)) {
+		t.Errorf("expected %d wasted bytes, got %d", 2*len(content), wasted)
+	}
+}
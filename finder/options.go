@@ -0,0 +1,162 @@
+package finder
+
+import (
+	"fmt"
+	erf "github.com/nj-eka/fdups/errflow"
+	"github.com/nj-eka/fdups/fh"
+	fs "github.com/nj-eka/fdups/filestat"
+	"github.com/nj-eka/fdups/workflow"
+	"github.com/nj-eka/fdups/workflow/filtering"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPattern      = "**/*"
+	DefaultProgressRate = 5 * time.Second
+	// DefaultAdaptiveHeadHashing - head prefilter added for adaptive tuning (one block if sizes are given in blocks)
+	DefaultAdaptiveHeadHashing = fs.SHA1 + ";4096"
+)
+
+// Options - settings of duplicates finding (see DefaultOptions)
+type Options struct {
+	// File system backend to search in; nil = host file system (filestat.NewOSFS)
+	FS fs.FS
+	// List of dirs to search (paths format is defined by FS). Order sets priority of sorting found duplicates.
+	Roots []string
+	// Glob patterns (including ** and {}) to search in roots.
+	Patterns []string
+
+	// Min file size to search
+	MinSize int64
+	// Max file size to search, -1 = no upper limit
+	MaxSize int64
+	// Include symbolic links in processing.
+	SymlinkEnabled bool
+	// Dup grouping based on meta info:
+	// string combination of file base (n)ame, (m)odification time, (p)ermition, owner (u)ser, owner (g)roup - note (s)ize id on by definition
+	MetaGroups string
+
+	// Hash filter stages in order of applying (see Stage); the last one must be full or custom stage without MinSize.
+	// Empty = fixed chain of HeadHashing, TailHashing, SampleHashing (files smaller than all of them together skip them) and FullHashing
+	Stages []Stage
+	// Head hash filter settings in format [algo;size], empty = off
+	HeadHashing string
+	// Tail hash filter settings in format [algo;size], empty = off
+	TailHashing string
+	// Sampled blocks hash filter settings in format [algo;size;count] - count blocks of size spread evenly over file
+	// (after head and tail filters), empty = off
+	SampleHashing string
+	// Final hash filter settings in format [algo]
+	FullHashing string
+	// Prefilter (head/tail/sample) size is given in file blocks (otherwise in bytes)
+	SizeInBlocks bool
+	// Parallel hashing of large files by full stages: files of at least MinSize bytes are split into chunks hashed concurrently
+	// and combined into tree hash (see filestat.GetTreeHashFileFunc); zero value = off
+	TreeHashing fs.TreeHashing
+	// Members of found groups are compared byte by byte before result is completed (see filestat.VerifyFunc):
+	// groups are split on hash collisions, files modified meanwhile are excluded
+	Verify bool
+	// Truncated copies detection: files with the same head checksum (of the first head prefilter stage, it is required)
+	// and different sizes are checked whether smaller file is prefix of larger one (see Result.Truncated)
+	Truncated bool
+	// Average size of content-defined chunks of block-level dedup estimate (see Finder.AnalyzeBlocks);
+	// 0 = filestat.DefaultChunkAvgSize
+	ChunkSize int
+
+	// Concurrency settings of pipeline stages, zero values = defaults:
+	// search - buffer of found paths (number of root patterns; each root pattern is searched by its own worker),
+	// validation - cap(search buffer) * NumCPU workers and buffer of the same size,
+	// meta filter - buffer (NumCPU*2; files are registered by single worker),
+	// hashing - NumCPU workers per hash filter stage and buffer of twice as many
+	Search, Validation, MetaFilter, Hashing workflow.Concurrency
+	// Adaptive tuning of hashing workers and prefilters (see filtering.Tuner); zero value = off.
+	// If it is enabled and there is no prefilter stage, head prefilter (DefaultAdaptiveHeadHashing) is added
+	// so that tuner decides whether it is worth running
+	Tuning filtering.TunerSettings
+	// Per device scheduling of hashing reads (see filtering.DeviceScheduler); zero value = off
+	Scheduling filtering.DeviceSchedulerSettings
+	// How files are read by hashing with respect to page cache (see filestat.ReadMode); empty = ReadCached
+	ReadMode fs.ReadMode
+	// Limits of hashing reads (bytes/s) and opens (files/s), 0 = unlimited; can be changed while running (see Finder.Throttle)
+	ReadRate, OpenRate int64
+
+	// Error handling policy (see errflow.ParsePolicy); zero value = all errors are logged, run is never aborted
+	ErrorPolicy erf.Policy
+	// Retry policy of file stat and hashing operations failed with transient errors (e.g. too many open files);
+	// zero value = no retries
+	Retry workflow.RetryPolicy
+	// ErrorReporter (if set) receives every error occurred during run and summary of errors on finish (see errflow.JSONErrorReport)
+	ErrorReporter erf.ErrorReporter
+
+	// How often OnProgress is called
+	ProgressRate time.Duration
+	// OnProgress (if set) is called every ProgressRate and once on finish
+	OnProgress func(Progress)
+	// OnGroupEvent (if set) is called as soon as group of duplicates is confirmed (reaches two members)
+	// and then on each new member of it - so results can be shown live during scanning
+	// (final groups are given by Result.Groups).
+	// It is called sequentially from pipeline goroutine, so it should return quickly.
+	OnGroupEvent func(GroupEvent)
+
+	// Estimated number of files found
+	FoundFilesInitCapacity int
+	// Estimated number of duplicate groups
+	DupGroupsInitCapacity int
+}
+
+// DefaultOptions returns options to search all files in roots with full content sha256 hashing
+func DefaultOptions(roots ...string) Options {
+	return Options{
+		Roots:                  roots,
+		Patterns:               []string{DefaultPattern},
+		MinSize:                1,
+		MaxSize:                -1,
+		FullHashing:            fs.SHA256,
+		Retry:                  workflow.DefaultRetryPolicy,
+		ProgressRate:           DefaultProgressRate,
+		FoundFilesInitCapacity: 1024 * 256,
+		DupGroupsInitCapacity:  1024,
+	}
+}
+
+// ParseHashing parses prefilter hashing settings in format [algo;size]
+func ParseHashing(settings string) (algo string, size int64, err error) {
+	parts := strings.Split(settings, ";")
+	if len(parts) != 2 {
+		return "", 0, fmt.Errorf("invalid hashing settings [%s] - expected format [algo;size]", settings)
+	}
+	if size, err = strconv.ParseInt(parts[1], 10, 64); err != nil || size <= 0 {
+		return "", 0, fmt.Errorf("invalid hashing size [%s]", parts[1])
+	}
+	return parts[0], size, nil
+}
+
+// ParseSampling parses sampled blocks hashing settings in format [algo;size;count]
+func ParseSampling(settings string) (algo string, size int64, count int, err error) {
+	parts := strings.Split(settings, ";")
+	if len(parts) != 3 {
+		return "", 0, 0, fmt.Errorf("invalid sampling settings [%s] - expected format [algo;size;count]", settings)
+	}
+	if algo, size, err = ParseHashing(parts[0] + ";" + parts[1]); err != nil {
+		return "", 0, 0, err
+	}
+	if count, err = strconv.Atoi(parts[2]); err != nil || count <= 0 {
+		return "", 0, 0, fmt.Errorf("invalid sampling count [%s]", parts[2])
+	}
+	return algo, size, count, nil
+}
+
+// ExpandPatterns expands {comma separated lists} in patterns (see fh.ExpandPatternLists)
+func ExpandPatterns(patterns []string) ([]string, error) {
+	result := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		patternExts, err := fh.ExpandPatternLists(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+		result = append(result, patternExts...)
+	}
+	return result, nil
+}
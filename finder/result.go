@@ -0,0 +1,147 @@
+package finder
+
+import (
+	erf "github.com/nj-eka/fdups/errflow"
+	fs "github.com/nj-eka/fdups/filestat"
+	"github.com/nj-eka/fdups/registrator"
+	"github.com/nj-eka/fdups/workflow"
+	"github.com/nj-eka/fdups/workflow/chunking"
+	"github.com/nj-eka/fdups/workflow/filtering"
+	"github.com/nj-eka/fdups/workflow/searching"
+	"github.com/nj-eka/fdups/workflow/validating"
+	"time"
+)
+
+// GroupEvent - event of group of duplicates confirmed during processing (see Options.OnGroupEvent)
+type GroupEvent = filtering.GroupEvent
+
+const (
+	GroupConfirmed   = filtering.GroupConfirmed
+	GroupMemberAdded = filtering.GroupMemberAdded
+	GroupSplit       = filtering.GroupSplit
+	GroupRemoved     = filtering.GroupRemoved
+)
+
+// Group - group of duplicates (files with the same content and meta key)
+type Group struct {
+	Key registrator.MCKey
+	// Files - all files of group (including links) sorted by priority (see filestat.FileStat.SortingKey)
+	Files []fs.FileStat
+	// Inodes - number of unique inodes in group
+	Inodes int
+}
+
+// Size - content size of one file in group
+func (g Group) Size() int64 {
+	if len(g.Files) == 0 {
+		return 0
+	}
+	return g.Files[0].Size()
+}
+
+// Wasted - bytes that can be freed by keeping only one inode of group
+func (g Group) Wasted() int64 {
+	if g.Inodes < 2 {
+		return 0
+	}
+	return g.Size() * int64(g.Inodes-1)
+}
+
+// Result - duplicates found by Finder
+type Result struct {
+	// Dups - found duplicates grouped by meta and content keys
+	Dups registrator.Mcifs
+	// Truncated - truncated copies (files that are exact prefixes of larger files) if Options.Truncated is set
+	Truncated []TruncatedPair
+	// IsCompleted - false if processing was interrupted (so result is partial)
+	IsCompleted bool
+	// IsVerified - groups are verified byte by byte (see Options.Verify); it's false if verification is interrupted
+	IsVerified bool
+	// Stats - statistics of all pipeline stages (see output.PrintStats)
+	Stats []workflow.StatProducer
+}
+
+// TruncatedPair - file Truncated is exact prefix of file Full (see Options.Truncated)
+type TruncatedPair = filtering.TruncatedPair
+
+func newResult(dups *filtering.ContentFilterStats, truncated *filtering.TruncationStats, stats []workflow.StatProducer) *Result {
+	mcifs, isCompleted := dups.GetResult()
+	result := &Result{
+		Dups:        mcifs,
+		IsCompleted: isCompleted,
+		IsVerified:  dups.IsVerified(),
+		Stats:       stats,
+	}
+	if truncated != nil {
+		var truncatedCompleted bool
+		result.Truncated, truncatedCompleted = truncated.GetResult()
+		result.IsCompleted = result.IsCompleted && truncatedCompleted
+	}
+	return result
+}
+
+// Groups returns groups of duplicates sorted by meta key (in the same order as they are saved to output files)
+func (r *Result) Groups() []Group {
+	groups := make([]Group, 0, len(r.Dups))
+	for _, mckey := range r.Dups.GetKeysSortedByMid() {
+		inodes := registrator.Inofs(r.Dups[mckey])
+		groups = append(groups, Group{
+			Key:    mckey,
+			Files:  inodes.GetFileStatSorted(),
+			Inodes: len(inodes),
+		})
+	}
+	return groups
+}
+
+// Progress - snapshot of processing progress
+type Progress struct {
+	// Elapsed - time since start of processing
+	Elapsed time.Duration
+	// IsCompleted - processing is finished
+	IsCompleted bool
+	// FilesFound - number of unique paths found by search patterns
+	FilesFound int
+	// FilesValidated - number of files passed validation (regular files within size limits)
+	FilesValidated int
+	// DupGroups - number of groups of duplicates found so far
+	DupGroups int
+	// DupInodes - number of inodes in groups of duplicates found so far
+	DupInodes int
+	// Truncated - number of truncated copies found so far (see Options.Truncated)
+	Truncated int
+	// Errors - number of errors occurred so far
+	Errors int
+	// Stats - detailed statistics of all pipeline stages (see output.PrintStats)
+	Stats []workflow.StatProducer
+}
+
+func newProgress(startTime time.Time, statProducers []workflow.StatProducer) Progress {
+	progress := Progress{
+		Elapsed: time.Since(startTime),
+		Stats:   statProducers,
+	}
+	truncationCompleted := true
+	for _, statProducer := range statProducers {
+		switch st := statProducer.Stats().(type) {
+		case searching.SearcherStats:
+			progress.FilesFound = st.KeysCount()
+		case *validating.ValidatorStats:
+			progress.FilesValidated = st.FileStats.KeysCount()
+		case erf.ErrorStats:
+			progress.Errors = st.TotalCount()
+		case *filtering.TruncationStats:
+			truncationCompleted = st.IsCompleted()
+			progress.Truncated = st.Found()
+		case *chunking.BlockDedupStats:
+			progress.IsCompleted = st.IsCompleted()
+		case *filtering.ContentFilterStats:
+			progress.IsCompleted = st.IsCompleted()
+			keysCounter := st.ContentRegister.GetKeysCounter()
+			progress.DupGroups = keysCounter.KeysCount()
+			progress.DupInodes = keysCounter.TotalCount()
+		}
+	}
+	progress.IsCompleted = progress.IsCompleted && truncationCompleted // detection of truncated copies can take longer
+	return progress
+}
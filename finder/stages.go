@@ -0,0 +1,155 @@
+package finder
+
+import (
+	"fmt"
+	fs "github.com/nj-eka/fdups/filestat"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StageType - type of hash filter stage
+type StageType string
+
+const (
+	// StageHead - hash of file head, settings [algo;size]
+	StageHead StageType = "head"
+	// StageTail - hash of file tail, settings [algo;size]
+	StageTail StageType = "tail"
+	// StageSample - hash of blocks sampled evenly over file, settings [algo;size;count]
+	StageSample StageType = "sample"
+	// StageFull - hash of full file content, settings [algo] (large files are hashed in parallel if Options.TreeHashing is set)
+	StageFull StageType = "full"
+	// StageCustom - stage registered by RegisterCustomStage, settings [name] or [name;args]
+	StageCustom StageType = "custom"
+)
+
+// Stage - hash filter stage settings (see Options.Stages)
+type Stage struct {
+	Type StageType
+	// Settings - in format of stage type (see StageType)
+	Settings string
+	// MinSize - files smaller than MinSize (in blocks if Options.SizeInBlocks) skip this stage; 0 = all files are hashed
+	MinSize int64
+}
+
+// String returns stage in format of ParseStage
+func (s Stage) String() string {
+	if s.MinSize > 0 {
+		return fmt.Sprintf("%s %s min=%d", s.Type, s.Settings, s.MinSize)
+	}
+	return fmt.Sprintf("%s %s", s.Type, s.Settings)
+}
+
+// ParseStage parses stage in format [type settings] or [type settings min=size],
+// e.g. "head xxh64;4096", "sample xxh64;4096;16 min=1048576", "full sha256"
+func ParseStage(s string) (Stage, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 || len(fields) > 3 {
+		return Stage{}, fmt.Errorf("invalid stage [%s] - expected format [type settings] or [type settings min=size]", s)
+	}
+	stage := Stage{Type: StageType(strings.ToLower(fields[0])), Settings: fields[1]}
+	if len(fields) == 3 {
+		value := strings.TrimPrefix(fields[2], "min=")
+		minSize, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || value == fields[2] || minSize < 0 {
+			return Stage{}, fmt.Errorf("invalid stage [%s] min size [%s]", s, fields[2])
+		}
+		stage.MinSize = minSize
+	}
+	return stage, nil
+}
+
+// StageEnv - environment hashers of stages are made in: file system backend, read mode and limits shared by all stages
+type StageEnv struct {
+	FS           fs.FS
+	SizeInBlocks bool
+	ReadMode     fs.ReadMode
+	Throttle     *fs.Throttle
+	Tracker      *fs.HashTracker
+	// TreeHashing - parallel hashing of large files by full stages
+	TreeHashing fs.TreeHashing
+}
+
+// CustomStageFunc makes hasher of custom stage by its args (settings after stage name, empty if not given)
+type CustomStageFunc func(env StageEnv, args string) (fs.HashFileFunc, error)
+
+var customStages = struct {
+	sync.RWMutex
+	m map[string]CustomStageFunc
+}{m: make(map[string]CustomStageFunc)}
+
+// RegisterCustomStage makes custom stage available by name (case insensitive) - e.g. "custom name;args";
+// it panics if stage with the same name is already registered
+func RegisterCustomStage(name string, newStage CustomStageFunc) {
+	name = strings.ToLower(name)
+	customStages.Lock()
+	defer customStages.Unlock()
+	if _, ok := customStages.m[name]; ok {
+		panic(fmt.Sprintf("custom stage [%s] is already registered", name))
+	}
+	customStages.m[name] = newStage
+}
+
+// newHasher makes hasher of stage; size - amount of file read by prefilter (0 - for full and custom stages)
+func (s Stage) newHasher(env StageEnv) (hasher fs.HashFileFunc, size int64, err error) {
+	switch s.Type {
+	case StageHead, StageTail:
+		algo, size, err := ParseHashing(s.Settings)
+		if err != nil {
+			return nil, 0, err
+		}
+		if s.Type == StageTail {
+			hasher, err = fs.GetHashFileFunc(env.FS, algo, -size, env.SizeInBlocks, env.ReadMode, env.Throttle, env.Tracker)
+		} else {
+			hasher, err = fs.GetHashFileFunc(env.FS, algo, size, env.SizeInBlocks, env.ReadMode, env.Throttle, env.Tracker)
+		}
+		return hasher, size, err
+	case StageSample:
+		algo, size, count, err := ParseSampling(s.Settings)
+		if err != nil {
+			return nil, 0, err
+		}
+		hasher, err = fs.GetSampleHashFileFunc(env.FS, algo, size, count, env.SizeInBlocks, env.ReadMode, env.Throttle, env.Tracker)
+		return hasher, size * int64(count), err
+	case StageFull:
+		hasher, err = fs.GetTreeHashFileFunc(env.FS, s.Settings, env.TreeHashing, env.SizeInBlocks, env.ReadMode, env.Throttle, env.Tracker)
+		return hasher, 0, err
+	case StageCustom:
+		name, args := s.Settings, ""
+		if i := strings.Index(name, ";"); i >= 0 {
+			name, args = name[:i], name[i+1:]
+		}
+		customStages.RLock()
+		newStage, ok := customStages.m[strings.ToLower(name)]
+		customStages.RUnlock()
+		if !ok {
+			return nil, 0, fmt.Errorf("custom stage [%s] is not registered", name)
+		}
+		hasher, err = newStage(env, args)
+		return hasher, 0, err
+	}
+	return nil, 0, fmt.Errorf("unknown stage type [%s] (supported: %s, %s, %s, %s, %s)", s.Type, StageHead, StageTail, StageSample, StageFull, StageCustom)
+}
+
+// legacyStages - stages of fixed chain given by HeadHashing, TailHashing, SampleHashing and FullHashing:
+// files smaller than all prefilters together skip them
+func legacyStages(opts Options) []Stage {
+	var (
+		stages     []Stage
+		prefilters = []struct {
+			stageType StageType
+			settings  string
+		}{
+			{StageHead, opts.HeadHashing},
+			{StageTail, opts.TailHashing},
+			{StageSample, opts.SampleHashing},
+		}
+	)
+	for _, prefilter := range prefilters {
+		if prefilter.settings != "" {
+			stages = append(stages, Stage{Type: prefilter.stageType, Settings: prefilter.settings})
+		}
+	}
+	return append(stages, Stage{Type: StageFull, Settings: opts.FullHashing})
+}
@@ -5,9 +5,13 @@ go 1.16
 // require github.com/heetch/confita v0.10.0 // indirect
 
 require (
+	github.com/cespare/xxhash/v2 v2.1.2
 	github.com/heetch/confita v0.10.0
+	github.com/klauspost/cpuid/v2 v2.0.11 // indirect
 	github.com/sirupsen/logrus v1.8.1
+	github.com/zeebo/xxh3 v1.0.1
+	golang.org/x/crypto v0.8.0
 	golang.org/x/exp v0.0.0-20210812203943-8c280c88aa00 // indirect
-	golang.org/x/sys v0.0.0-20210510120138-977fb7262007 // indirect
+	golang.org/x/sys v0.7.0
 	gonum.org/v1/gonum v0.9.3
 )
@@ -11,26 +11,41 @@ import (
 	"github.com/nj-eka/fdups/errs"
 	"github.com/nj-eka/fdups/fh"
 	fs "github.com/nj-eka/fdups/filestat"
+	"github.com/nj-eka/fdups/finder"
 	"github.com/nj-eka/fdups/logging"
 	out "github.com/nj-eka/fdups/output"
-	"github.com/nj-eka/fdups/registrator"
+	"github.com/nj-eka/fdups/server"
+	"github.com/nj-eka/fdups/tui"
 	"github.com/nj-eka/fdups/workflow"
 	"github.com/nj-eka/fdups/workflow/filtering"
-	"github.com/nj-eka/fdups/workflow/searching"
-	"github.com/nj-eka/fdups/workflow/validating"
 	log "github.com/sirupsen/logrus"
+	"net/http"
 	"os"
 	"os/signal"
 	"os/user"
 	fp "path/filepath"
-	"strconv"
 	"strings"
 	"time"
 )
 
+// commands (the first argument, scan by default)
+const (
+	CommandScan   = "scan"   // search duplicates and save results
+	CommandReview = "review" // review duplicates (found by scanning or loaded from saved results) in terminal UI
+	CommandServe  = "serve"  // browse duplicates (found by scanning or loaded from saved results) in web UI
+	CommandBlocks = "blocks" // estimate block-level dedup savings by content-defined chunking of files and save report
+)
+
+// byte-by-byte verification of found groups (see Config.Verify)
+const (
+	VerifyNever   = "never"
+	VerifyActions = "actions" // only if duplicates can be acted upon (review command)
+	VerifyAlways  = "always"
+)
+
 const (
 	DefaultRoot                   = ""
-	DefaultPattern                = "**/*"
+	DefaultPattern                = finder.DefaultPattern
 	DefaultOutputDir              = ""
 	DefaultMaxGroupsPerOutputFile = 100
 )
@@ -86,17 +101,120 @@ type Config struct {
 	// Maximum number of groups of duplicates per output file
 	MaxGroupsPerOutputFile int `config:"groups,description=Maximum number of groups of duplicates per output file" yaml:"output_groups_per_file"`
 
+	// Hash filter stages in order of applying, each in format [type settings] or [type settings min=size]
+	// (see finder.ParseStage), e.g. "head xxh64;4096", "sample xxh64;4096;16 min=1048576", "full sha256";
+	// files smaller than min size skip the stage; if set, head / tail / sample / full settings are ignored
+	Stages []string `config:"stages,description=Hash filter stages in order of applying: [type settings] or [type settings min=size] - type: head / tail / sample / full / custom (overrides head / tail / sample / full)" yaml:"stages"`
 	// Head hash filter settings in format [algo;size]
 	HeadHashing string `config:"head,description=Head hash filter settings in format [algo;size]" yaml:"head_hashing"`
 	// Tail hash filter settings in format [algo;size]
 	TailHashing string `config:"tail,description=Tail hash filter settings in format [algo;size]" yaml:"tail_hashing"`
+	// Sampled blocks hash filter settings in format [algo;size;count]: count blocks spread evenly over file are hashed
+	// (tells apart files with the same headers and trailers, e.g. VM images, databases)
+	SampleHashing string `config:"sample,description=Sampled blocks hash filter settings in format [algo;size;count]" yaml:"sample_hashing"`
 	// Final hash filter settings in format [algo]
 	FullHashing string `config:"full,description=Final hash filter settings in format [algo]" yaml:"full_hashing"`
-	// Prefilter (head/tail) size is given in file blocks (otherwise in bytes)
-	SizeInBlocks bool `config:"blocks,description=Prefilter (head/tail) size is given in file blocks (otherwise in bytes)" yaml:"size_in_blocks"`
+	// Prefilter (head/tail/sample) size is given in file blocks (otherwise in bytes)
+	SizeInBlocks bool `config:"blocks,description=Prefilter (head/tail/sample) size is given in file blocks (otherwise in bytes)" yaml:"size_in_blocks"`
 
 	// Statistics update rate (how often stats are printed out to os.Stdout)
 	StatsUpdateRate time.Duration `config:"refresh,description=Statistics update rate (how often stats are printed out to os.Stdout)" yaml:"stats_update_rate"`
+	// Progress output mode: auto (dashboard on terminal, single line otherwise), dashboard, line, none
+	ProgressMode string `config:"progress,description=Progress output mode: auto (dashboard on terminal - single line otherwise) dashboard line none" yaml:"progress_mode"`
+	// Stats stream in JSON lines format (one object per stats update): file path or fd:N; empty = off
+	StatsStream string `config:"stats_stream,description=Stats stream in JSON lines format (one object per stats update): file path or fd:N; empty = off" yaml:"stats_stream"`
+
+	// Error handling policies in format [selector=action]: selector is error kind (io, permission, not_exist, ...),
+	// severity (wrn, err, cri) or kind:severity; action is log, count (count only), ignore or abort (the run)
+	// example: ["permission=count", "wrn=ignore", "io:cri=abort"]
+	ErrorPolicies []string `config:"error_policies,description=Error handling policies in format [selector=action]: selector - kind / severity / kind:severity; action - log count ignore abort" yaml:"error_policies"`
+	// Error budgets in format [selector=limit]: run is aborted as soon as number of errors matched selector reaches limit
+	// (selector total matches all errors); example: ["io=1000", "total=100000"]
+	ErrorBudgets []string `config:"error_budgets,description=Error budgets in format [selector=limit]: run is aborted as soon as limit is reached; selector total matches all errors" yaml:"error_budgets"`
+
+	// Concurrency of pipeline stages (0 = default): spinning disks benefit from few workers, NVMe arrays - from many
+	// Buffer of found paths (default: number of root patterns)
+	SearchBuffer int `config:"search_buffer,description=Buffer of found paths - 0 = number of root patterns" yaml:"search_buffer"`
+	// Max number of validation workers (default: search buffer * NumCPU)
+	ValidationWorkers int `config:"validation_workers,description=Max number of validation workers - 0 = search buffer * NumCPU" yaml:"validation_workers"`
+	// Buffer of validated files (default: number of validation workers)
+	ValidationBuffer int `config:"validation_buffer,description=Buffer of validated files - 0 = number of validation workers" yaml:"validation_buffer"`
+	// Buffer of duplicate candidates passed from meta filter to hashing (default: NumCPU*2); meta filter has single worker
+	MetaFilterBuffer int `config:"metafilter_buffer,description=Buffer of duplicate candidates passed to hashing - 0 = NumCPU*2" yaml:"metafilter_buffer"`
+	// Max number of workers per hash filter stage (default: NumCPU)
+	HashingWorkers int `config:"hashing_workers,description=Max number of workers per hash filter stage - 0 = NumCPU" yaml:"hashing_workers"`
+	// Buffer of each hash filter stage output (default: number of hashing workers * 2)
+	HashingBuffer int `config:"hashing_buffer,description=Buffer of hash filter stage output - 0 = hashing workers * 2" yaml:"hashing_buffer"`
+	// Max number of workers saving results (default: NumCPU*64)
+	SaveWorkers int `config:"save_workers,description=Max number of workers saving results - 0 = NumCPU*64" yaml:"save_workers"`
+
+	// Adaptive tuning: workers of hash filter stages are adjusted by throughput and prefilters (head / tail)
+	// are skipped for file sizes they don't pay off; head prefilter is added if neither head nor tail is set
+	Adaptive bool `config:"adaptive,description=Self-tuning of hashing workers and prefilters (head prefilter is added if none is set)" yaml:"adaptive"`
+
+	// Per device scheduling of hashing: devices are read in parallel, each with limited number of files at once;
+	// files waiting for rotating device (HDD) are read in order of their physical offsets (linux only, others are unordered)
+	DeviceScheduling bool `config:"device_scheduling,description=Per device scheduling of hashing reads (devices are read in parallel - each with limited concurrency)" yaml:"device_scheduling"`
+	// Max number of files read simultaneously from non-rotating device (SSD, NVMe, network or unknown media)
+	DeviceReads int `config:"device_reads,description=Max number of files read simultaneously from non-rotating device (device scheduling)" yaml:"device_reads"`
+	// Max number of files read simultaneously from rotating device (HDD)
+	HDDReads int `config:"hdd_reads,description=Max number of files read simultaneously from rotating device - HDD (device scheduling)" yaml:"hdd_reads"`
+	// Files waiting for rotating device are read in order of their physical offsets
+	HDDOrdered bool `config:"hdd_ordered,description=Files waiting for rotating device are read in order of their physical offsets (device scheduling)" yaml:"hdd_ordered"`
+
+	// How files are read by hashing with respect to page cache: cache (plain reads), fadvise (pages of hashed files are dropped
+	// from page cache after reading), direct (O_DIRECT reads bypassing page cache); fadvise and direct are linux only,
+	// files that can't be read in given mode are read in the next one (direct -> fadvise -> cache) and counted as read_fallback warnings
+	ReadMode string `config:"read_mode,description=How files are read by hashing: cache / fadvise (pages are dropped from page cache after reading) / direct (O_DIRECT) - linux only" yaml:"read_mode"`
+
+	// Parallel hashing of very large files by full stage: files of at least tree_min_size bytes are split into chunks
+	// of tree_chunk_size hashed concurrently (each on its own file descriptor) and combined into tree hash - its checksums
+	// are recorded with distinct algo (tree_<algo>_<chunk size>), so they are never compared with plain ones
+	TreeMinSize int64 `config:"tree_min_size,description=Files of at least this size are hashed by full stage in parallel chunks (tree hash) - 0 = off" yaml:"tree_min_size"`
+	// Size of chunks of tree hashing
+	TreeChunkSize int64 `config:"tree_chunk_size,description=Size of chunks of tree hashing" yaml:"tree_chunk_size"`
+	// Max number of chunks of file hashed concurrently
+	TreeWorkers int `config:"tree_workers,description=Max number of chunks of file hashed concurrently by tree hashing - 0 = NumCPU" yaml:"tree_workers"`
+
+	// Byte-by-byte verification of found groups before results are completed: never, actions (only if duplicates
+	// can be acted upon - review command), always; groups are split on hash collisions, files modified meanwhile are excluded
+	// (both are counted as verify_mismatch errors)
+	Verify string `config:"verify,description=Byte-by-byte verification of found groups: never / actions (review command) / always" yaml:"verify"`
+
+	// Detection of truncated copies (files that are exact prefixes of larger ones - left by interrupted downloads / copies):
+	// files with the same head checksum (head prefilter is required) and different sizes are compared,
+	// found pairs are reported separately (saved to output dir along with results)
+	Truncated bool `config:"truncated,description=Detect truncated copies (files that are prefixes of larger files) - requires head prefilter" yaml:"truncated"`
+
+	// Average size of content-defined chunks of block-level dedup estimate (blocks command):
+	// rounded down to power of 2, chunks are from 1/4 to 4 times of it
+	ChunkSize int `config:"chunk_size,description=Average size of content-defined chunks (blocks command)" yaml:"chunk_size"`
+
+	// Limits of hashing (so that it doesn't starve other services of the host), 0 = unlimited;
+	// can be changed while running by POST /api/throttle (JSON) on web UI (serve) or metrics (-metrics) address
+	// Max rate of reading files by hashing (bytes/s)
+	ReadRate int64 `config:"read_rate,description=Max rate of reading files by hashing in bytes/s - 0 = unlimited (changeable by POST /api/throttle)" yaml:"read_rate"`
+	// Max rate of opening files by hashing (files/s)
+	OpenRate int64 `config:"open_rate,description=Max rate of opening files by hashing in files/s - 0 = unlimited (changeable by POST /api/throttle)" yaml:"open_rate"`
+
+	// Max attempts of file stat and hashing operations failed with transient errors
+	// (too many open files, interrupted system call); retries are made with exponential backoff, 1 = no retries
+	RetryAttempts int `config:"retry_attempts,description=Max attempts of operations failed with transient errors (too many open files / interrupted system call) - 1 = no retries" yaml:"retry_attempts"`
+
+	// Write error report (JSON lines: every error with path, kind, severity, operations and summary) to output dir
+	// along with results (not in dry run)
+	ErrorsReport bool `config:"errors_report,description=Write error report (JSON lines) to output dir along with results (not in dry run)" yaml:"errors_report"`
+
+	// Saved results files to review (review command) instead of scanning
+	Reports []string `config:"reports,description=Saved results files to review (review / serve command) instead of scanning" yaml:"reports"`
+
+	// Listen address of web UI (serve command): host:port or unix:/path/to/socket
+	Listen string `config:"listen,description=Listen address of web UI (serve command): host:port or unix:/path/to/socket" yaml:"listen"`
+	// Listen address of Prometheus metrics endpoint (/metrics) while scanning (scan / review command); empty = off
+	// note: serve command provides /metrics on web UI address
+	MetricsListen string `config:"metrics,description=Listen address of Prometheus metrics endpoint (/metrics) while scanning; empty = off" yaml:"metrics_listen"`
+	// File to write metrics in Prometheus text format to at each stats update (e.g. for node_exporter textfile collector); empty = off
+	MetricsFile string `config:"metrics_file,description=File to write metrics in Prometheus text format to at each stats update; empty = off" yaml:"metrics_file"`
 
 	// various initial map length settings
 	// Estimated number of files found
@@ -122,43 +240,64 @@ var cfg = Config{
 
 	IsDry: false,
 
+	RetryAttempts: workflow.DefaultRetryPolicy.Attempts,
+	ErrorsReport:  true,
+
+	ReadMode: string(fs.ReadCached),
+	Verify:   VerifyActions,
+
+	TreeChunkSize: fs.DefaultTreeChunkSize,
+	ChunkSize:     fs.DefaultChunkAvgSize,
+
+	DeviceReads: filtering.DefaultDeviceSchedulerSettings.Reads,
+	HDDReads:    filtering.DefaultDeviceSchedulerSettings.RotationalReads,
+	HDDOrdered:  filtering.DefaultDeviceSchedulerSettings.Ordered,
+
 	OutputDir:              DefaultOutputDir,
 	OutputFilePrefix:       DefaultOutputFilePrefix,
 	MaxGroupsPerOutputFile: DefaultMaxGroupsPerOutputFile,
 
-	HeadHashing: "", // off by default
-	TailHashing: "", // off by default
-	FullHashing: fs.SHA256,
+	HeadHashing:   "", // off by default
+	TailHashing:   "", // off by default
+	SampleHashing: "", // off by default
+	FullHashing:   fs.SHA256,
 
 	SizeInBlocks: false,
 
 	StatsUpdateRate: 5 * time.Second,
+	ProgressMode:    string(out.ProgressAuto),
+
+	Listen: server.DefaultListenAddr,
 
 	// some internal optimization params
 	PatternFoundFilesInitCapacity: 1024 * 256,
 	DupGroupsInitCapacity:         1024,
 }
 
-// TODO: move global vars to app.config
 var (
-	startTime                            time.Time
-	currentUser                          *user.User
-	statValidatorFunc                    fs.FileStatValidatorFunc
-	statMetaKeyFunc                      fs.MetaKeyFunc
-	skipPrefiltersMaxSizeFunc            fs.FileSizeLesserFunc
-	priorDupsFunc                        fs.PriorFunc
-	hashFilterFuncs                      []fs.HashFileFunc
-	prefilterHeadSize, prefilterTailSize int64
-	minSize2Prefilters                   int64 // = 1 * (prefilterHeadSize + prefilterTailSize)
+	command        = CommandScan
+	startTime      time.Time
+	currentUser    *user.User
+	fdupsFinder    *finder.Finder
+	webServer      *server.Server // set for serve command or if metrics endpoint is on
+	progressMode   out.ProgressMode
+	statsStream    *out.StatsStream // nil if off
+	statsCollector *out.StatsCollector
+	errorReport    *erf.JSONErrorReport // nil if off
 )
 
 // TODO: after moving global variables, refactoring of this method is required (most likely it will disappear as unnecessary ? logger ?)
 func init() {
 	var (
-		err      error
-		ok       bool
+		err error
+		ok  bool
 	)
 	startTime = time.Now()
+	statsCollector = out.NewStatsCollector(startTime)
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		command = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
 	ctx := cu.BuildContext(
 		context.Background(),
 		cu.SetContextOperation("00.init"),
@@ -180,6 +319,13 @@ func init() {
 	}
 	// logger is initialized
 
+	switch command {
+	case CommandScan, CommandReview, CommandServe, CommandBlocks:
+	default:
+		logging.LogError(ctx, fmt.Errorf("unknown command [%s]; supported commands: %s, %s, %s, %s", command, CommandScan, CommandReview, CommandServe, CommandBlocks))
+		log.Exit(1)
+	}
+
 	// roots validation
 	for i, root := range cfg.Roots {
 		if root, err = fh.SafeParentResolvePath(root, currentUser, 0700); err == nil {
@@ -193,18 +339,6 @@ func init() {
 		}
 	}
 
-	// patterns validation
-	patterns := make([]string, 0, len(cfg.Patterns))
-	for _, pattern := range cfg.Patterns {
-		if patternExts, err := fh.ExpandPatternLists(pattern); err == nil {
-			patterns = append(patterns, patternExts...)
-		} else {
-			logging.LogError(ctx, fmt.Errorf("invalid pattern: %w", err))
-			log.Exit(1)
-		}
-	}
-	cfg.Patterns = patterns
-
 	// output validation
 	if cfg.OutputDir, err = fh.SafeParentResolvePath(cfg.OutputDir, currentUser, 0700); err != nil {
 		logging.LogError(ctx, fmt.Errorf("invalid pattern: %w", err))
@@ -215,79 +349,148 @@ func init() {
 		log.Exit(1)
 	}
 
-	// validator
-	statValidatorFunc = fs.NewRegularSizeStatValidator(cfg.MinSize, cfg.MaxSize)
-
-	// meta filters
-	metaGroups := map[rune]bool{'s': true}
-	for _, rc := range strings.ToLower(cfg.MetaGroupping) {
-		metaGroups[rc] = true
+	// stats output validation
+	if progressMode, err = out.ParseProgressMode(cfg.ProgressMode); err != nil {
+		logging.LogError(ctx, err)
+		log.Exit(1)
 	}
-	statMetaKeyFunc = fs.NewMetaKeyFunc(
-		metaGroups['s'],
-		metaGroups['n'],
-		metaGroups['p'],
-		metaGroups['u'],
-		metaGroups['g'],
-		metaGroups['m'],
-	)
-
-	// head hashing
-	if len(cfg.HeadHashing) > 0 {
-		if parts := strings.Split(cfg.HeadHashing, ";"); len(parts) == 2 {
-			if size, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
-				if hasher, err := fs.GetHashFileFunc(parts[0], size, cfg.SizeInBlocks); err == nil {
-					hashFilterFuncs = append(hashFilterFuncs, hasher)
-					prefilterHeadSize = size
-				} else {
-					logging.LogError(ctx, fmt.Errorf("head hashing init [%v] failed: %w", parts, err))
-					log.Exit(1)
-				}
-			} else {
-				logging.LogError(ctx, fmt.Errorf("invalid head hashing size [%s]", parts[1]))
-				log.Exit(1)
-			}
-		} else {
-			logging.LogError(ctx, fmt.Errorf("invalid head hashing settings [%s]", cfg.HeadHashing))
+	progressMode = progressMode.Resolve(os.Stdout)
+	if cfg.StatsStream != "" {
+		if statsStream, err = out.OpenStatsStream(cfg.StatsStream); err != nil {
+			logging.LogError(ctx, err)
 			log.Exit(1)
 		}
 	}
 
-	// tail hashing
-	if len(cfg.TailHashing) > 0 {
-		if parts := strings.Split(cfg.TailHashing, ";"); len(parts) == 2 {
-			if size, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
-				if hasher, err := fs.GetHashFileFunc(parts[0], -size, cfg.SizeInBlocks); err == nil {
-					hashFilterFuncs = append(hashFilterFuncs, hasher)
-					prefilterTailSize = size
-				} else {
-					logging.LogError(ctx, fmt.Errorf("tail hashing init [%v] failed: %w", parts, err))
-					log.Exit(1)
-				}
-			} else {
-				logging.LogError(ctx, fmt.Errorf("invalid tail hashing size [%s]", parts[1]))
-				log.Exit(1)
-			}
-		} else {
-			logging.LogError(ctx, fmt.Errorf("invalid tail hashing settings [%s]", cfg.TailHashing))
-			log.Exit(1)
-		}
+	if cfg.ErrorsReport && !cfg.IsDry {
+		errorReport = erf.NewJSONErrorReport(fp.Join(cfg.OutputDir, fmt.Sprintf("%s_errors_%s.jsonl", cfg.OutputFilePrefix, startTime.Format("20060102_150405"))))
 	}
 
-	// full content hashing
-	if hasher, err := fs.GetHashFileFunc(cfg.FullHashing, 0, cfg.SizeInBlocks); err == nil {
-		hashFilterFuncs = append(hashFilterFuncs, hasher)
-		minSize2Prefilters = 1 * (prefilterHeadSize + prefilterTailSize) // 1.5 2 ...
-	} else {
-		logging.LogError(ctx, errs.SeverityCritical, errs.KindInvalidValue, fmt.Errorf("result hashing init [%s] failed: %w", cfg.FullHashing, err))
+	// pipeline settings validation
+	finderOpts, err := finderOptions(cfg)
+	if err != nil {
+		logging.LogError(ctx, err)
 		log.Exit(1)
 	}
+	if fdupsFinder, err = finder.New(finderOpts); err != nil {
+		logging.LogError(ctx, err)
+		log.Exit(1)
+	}
+}
 
-	// head/tail skipper
-	skipPrefiltersMaxSizeFunc = fs.NewFileSizeLesserFunc(minSize2Prefilters, cfg.SizeInBlocks)
-
-	// dups priority (for output ordering)
-	priorDupsFunc = fs.NewPriorFunc(cfg.Roots)
+// finderOptions maps app config to finder options (pipeline works on host file system)
+func finderOptions(cfg Config) (finder.Options, error) {
+	errorPolicy, err := erf.ParsePolicy(cfg.ErrorPolicies, cfg.ErrorBudgets)
+	if err != nil {
+		return finder.Options{}, err
+	}
+	if cfg.RetryAttempts < 1 {
+		return finder.Options{}, fmt.Errorf("invalid retry attempts [%d]: must be at least 1", cfg.RetryAttempts)
+	}
+	if cfg.SaveWorkers < 0 {
+		return finder.Options{}, fmt.Errorf("invalid save workers [%d]: must not be negative", cfg.SaveWorkers)
+	}
+	if cfg.DeviceReads < 1 || cfg.HDDReads < 1 {
+		return finder.Options{}, fmt.Errorf("invalid device reads [%d] / hdd reads [%d]: must be at least 1", cfg.DeviceReads, cfg.HDDReads)
+	}
+	var verify bool
+	switch cfg.Verify {
+	case VerifyNever:
+	case VerifyActions:
+		verify = command == CommandReview
+	case VerifyAlways:
+		verify = true
+	default:
+		return finder.Options{}, fmt.Errorf("invalid verify [%s]: supported values: %s, %s, %s", cfg.Verify, VerifyNever, VerifyActions, VerifyAlways)
+	}
+	stages := make([]finder.Stage, 0, len(cfg.Stages))
+	for _, s := range cfg.Stages {
+		stage, err := finder.ParseStage(s)
+		if err != nil {
+			return finder.Options{}, err
+		}
+		stages = append(stages, stage)
+	}
+	retryPolicy := workflow.DefaultRetryPolicy
+	retryPolicy.Attempts = cfg.RetryAttempts
+	tuning := filtering.DefaultTunerSettings
+	tuning.Enabled = cfg.Adaptive
+	scheduling := filtering.DeviceSchedulerSettings{
+		Enabled:         cfg.DeviceScheduling,
+		Reads:           cfg.DeviceReads,
+		RotationalReads: cfg.HDDReads,
+		Ordered:         cfg.HDDOrdered,
+	}
+	opts := finder.Options{
+		FS:             fs.NewOSFS(),
+		Roots:          cfg.Roots,
+		Patterns:       cfg.Patterns,
+		MinSize:        cfg.MinSize,
+		MaxSize:        cfg.MaxSize,
+		SymlinkEnabled: cfg.SLinkEnabled,
+		MetaGroups:     cfg.MetaGroupping,
+		Stages:         stages,
+		HeadHashing:    cfg.HeadHashing,
+		TailHashing:    cfg.TailHashing,
+		SampleHashing:  cfg.SampleHashing,
+		FullHashing:    cfg.FullHashing,
+		SizeInBlocks:   cfg.SizeInBlocks,
+		Verify:         verify,
+		Truncated:      cfg.Truncated,
+		ChunkSize:      cfg.ChunkSize,
+		TreeHashing:    fs.TreeHashing{MinSize: cfg.TreeMinSize, ChunkSize: cfg.TreeChunkSize, Workers: cfg.TreeWorkers},
+		ErrorPolicy:    errorPolicy,
+		Retry:          retryPolicy,
+		Search:         workflow.Concurrency{Buffer: cfg.SearchBuffer},
+		Validation:     workflow.Concurrency{Workers: cfg.ValidationWorkers, Buffer: cfg.ValidationBuffer},
+		MetaFilter:     workflow.Concurrency{Buffer: cfg.MetaFilterBuffer},
+		Hashing:        workflow.Concurrency{Workers: cfg.HashingWorkers, Buffer: cfg.HashingBuffer},
+		Tuning:         tuning,
+		Scheduling:     scheduling,
+		ReadMode:       fs.ReadMode(cfg.ReadMode),
+		ReadRate:       cfg.ReadRate,
+		OpenRate:       cfg.OpenRate,
+		ProgressRate:   cfg.StatsUpdateRate,
+		OnProgress: func(progress finder.Progress) {
+			stats := statsCollector.Collect(progress.Stats...)
+			out.WriteProgress(context.TODO(), os.Stdout, progressMode, stats)
+			if statsStream != nil {
+				if err := statsStream.Write(stats); err != nil {
+					logging.LogError(err)
+				}
+			}
+			if webServer != nil {
+				webServer.SetStats(stats)
+			}
+			if cfg.MetricsFile != "" {
+				if err := out.SaveMetrics(cfg.MetricsFile, stats); err != nil {
+					logging.LogError(err)
+				}
+			}
+		},
+		OnGroupEvent: func(event finder.GroupEvent) {
+			if webServer != nil && command == CommandServe {
+				files := make([]out.ReportFile, 0, len(event.Files))
+				for _, fileStat := range event.Files {
+					files = append(files, out.NewReportFile(fileStat))
+				}
+				switch event.Type {
+				case finder.GroupSplit:
+					webServer.ReplaceFiles(event.Key.String(), files...)
+				case finder.GroupRemoved:
+					webServer.RemoveGroup(event.Key.String())
+				default:
+					webServer.AddFiles(event.Key.String(), files...)
+				}
+			}
+		},
+		FoundFilesInitCapacity: cfg.PatternFoundFilesInitCapacity,
+		DupGroupsInitCapacity:  cfg.DupGroupsInitCapacity,
+	}
+	if errorReport != nil {
+		opts.ErrorReporter = errorReport
+	}
+	return opts, nil
 }
 
 func main() {
@@ -301,89 +504,251 @@ func main() {
 		logging.LogMsg(ctx).Debugf("stop listening for signals: %v", ctx.Err())
 	}()
 	defer cancel() // in case of early return (on error) - signal to close already running goroutines
+	if errorReport != nil {
+		defer func() {
+			if err := errorReport.Close(); err != nil {
+				logging.LogError(ctx, err)
+			} else if errorReport.Records() > 0 {
+				logging.LogMsg(ctx).Infof("error report written to file [%s]", errorReport.FilePath())
+			}
+		}()
+	}
+	if statsStream != nil {
+		defer func() {
+			if err := statsStream.Close(); err != nil {
+				logging.LogError(ctx, fmt.Errorf("closing stats stream failed: %w", err))
+			}
+		}()
+	}
 
-	// pipeline building
-	searcher := searching.NewSearcher(
-		ctx,
-		cfg.Roots,
-		cfg.Patterns,
-		cfg.PatternFoundFilesInitCapacity,
-	)
-	validator := validating.NewValidator(
-		ctx,
-		searcher.FoundFilePathsCh(),
-		statMetaKeyFunc,
-		priorDupsFunc,
-		statValidatorFunc,
-		cfg.SLinkEnabled,
-		cfg.PatternFoundFilesInitCapacity,
-	)
-	metaFilter := filtering.NewMetaFilter(
-		ctx,
-		validator.ValidatedFileStatCh(),
-		cfg.PatternFoundFilesInitCapacity,
-	)
-	contentFilter := filtering.NewContentFilter(
-		ctx,
-		metaFilter.DuplicateCh(),
-		metaFilter.Stats().(registrator.MifsRegister),
-		hashFilterFuncs,
-		skipPrefiltersMaxSizeFunc,
-		cfg.DupGroupsInitCapacity,
-	)
-	errModerator, err := erf.NewErrorModerator(
-		ctx,
-		cancel,
-		searcher,
-		validator,
-		metaFilter,
-		contentFilter,
-	)
+	if cfg.MetricsListen != "" && command != CommandServe {
+		serveMetrics(ctx)
+	}
+	switch command {
+	case CommandReview:
+		review(ctx)
+	case CommandServe:
+		serve(ctx)
+	case CommandBlocks:
+		blocks(ctx)
+	default:
+		scan(ctx)
+	}
+}
+
+// scan finds duplicates and saves results (if not dry run), returns nil if nothing is found due to error
+func scan(ctx context.Context) *finder.Result {
+	result, err := fdupsFinder.Run(ctx)
+	if result == nil {
+		logging.LogError(err)
+		return nil
+	}
 	if err != nil {
+		fmt.Printf("\nProcessing stopped: %v\n", err)
+		offerToSaveResults(ctx, result)
+		return result
+	}
+	if !cfg.IsDry {
+		SaveResults(ctx, result)
+	}
+	return result
+}
+
+// offerToSaveResults saves results of stopped processing (if not dry run) on user confirmation
+func offerToSaveResults(ctx context.Context, result *finder.Result) {
+	if cfg.IsDry {
+		return
+	}
+	fmt.Println("Do you wish to save reports of already found duplicates? [Y]es / [N]o")
+	var answer string
+	if n, err := fmt.Scanln(&answer); n >= 1 && err == nil {
+		if strings.ToUpper(strings.SplitN(answer, "", 1)[0]) == "Y" {
+			SaveResults(ctx, result)
+		}
+	}
+}
+
+// blocks estimates block-level dedup savings and saves report (if not dry run)
+func blocks(ctx context.Context) {
+	result, err := fdupsFinder.AnalyzeBlocks(ctx)
+	if result == nil {
 		logging.LogError(err)
 		return
 	}
-	pipeline := []workflow.Pipeliner{
-		errModerator,
-		contentFilter,
-		metaFilter,
-		validator,
-		searcher,
+	if err != nil {
+		fmt.Printf("\nProcessing stopped: %v\n", err)
 	}
+	msg := fmt.Sprintf("block-level dedup (%s chunks on average) of %d file(s): %s of %s unique - %s can be saved",
+		fh.BytesToHuman(uint64(result.ChunkSize)), result.Total.Files, fh.BytesToHuman(uint64(result.Total.UniqueBytes)), fh.BytesToHuman(uint64(result.Total.Bytes)), fh.BytesToHuman(uint64(result.Total.Saved())))
+	logging.LogMsg(ctx).Info(msg)
+	fmt.Println(msg)
+	if cfg.IsDry {
+		return
+	}
+	filePath, err := out.SaveBlocksReport(cfg.OutputDir, cfg.OutputFilePrefix, out.NewBlocksReport(result.ChunkSize, result.Total, result.Roots, result.IsCompleted))
+	if err != nil {
+		logging.LogError(ctx, err)
+		return
+	}
+	logging.LogMsg(ctx).Infof("blocks report written to file [%s]", filePath)
+}
 
-	// run pipeline
-	finish := workflow.Run(ctx, workflow.Pipelines(pipeline).Runners()...)
+// review runs terminal UI on saved results (if given) or on results of scanning
+func review(ctx context.Context) {
+	var groups []*tui.Group
+	if len(cfg.Reports) > 0 {
+		for _, filePath := range cfg.Reports {
+			if out.IsPartialResultsFile(filePath) {
+				// groups of interrupted scan are not proven to be duplicates
+				msg := fmt.Sprintf("results file [%s] is partial - review is refused", filePath)
+				logging.LogMsg(ctx).Warn(msg)
+				fmt.Println(msg)
+				return
+			}
+		}
+		reportGroups, err := out.LoadDupsResults(cfg.Reports...)
+		if err != nil {
+			logging.LogError(ctx, err)
+			return
+		}
+		groups = tui.NewGroupsFromReport(reportGroups)
+	} else {
+		result := scan(ctx)
+		if result == nil {
+			return
+		}
+		if !result.IsCompleted || (cfg.Verify != VerifyNever && !result.IsVerified) {
+			// files of incomplete (interrupted or aborted) scan or verification are not proven to be duplicates
+			msg := "scanning (or verification) is not completed - review is refused"
+			logging.LogMsg(ctx).Warn(msg)
+			fmt.Println(msg)
+			return
+		}
+		groups = tui.NewGroupsFromResult(result.Dups)
+	}
+	if len(groups) == 0 {
+		fmt.Println("No duplicates to review")
+		return
+	}
+	report, err := tui.Run(ctx, groups, tui.Options{
+		ScriptPath: fp.Join(cfg.OutputDir, fmt.Sprintf("%s_marks_%s.sh", cfg.OutputFilePrefix, time.Now().Format("20060102_150405"))),
+	})
+	if err != nil {
+		logging.LogError(ctx, fmt.Errorf("review failed: %w", err))
+		return
+	}
+	for _, err := range report.Errs {
+		logging.LogError(ctx, errs.SeverityWarning, err)
+	}
+	msg := fmt.Sprintf("review finished: %d file(s) deleted, %d file(s) linked, %s freed, %d error(s)", report.Deleted, report.Linked, fh.BytesToHuman(uint64(report.FreedBytes)), len(report.Errs))
+	logging.LogMsg(ctx).Info(msg)
+	fmt.Println(msg)
+}
 
-monitoring:
-	for {
-		select {
-		case <-finish:
-			break monitoring
-		case <-ctx.Done():
-			fmt.Println("\nProcessing stopped")
+// serveMetrics serves Prometheus metrics endpoint while app is running
+func serveMetrics(ctx context.Context) {
+	webServer = server.New(cfg.Roots, server.StateScanning)
+	ln, err := server.Listen(cfg.MetricsListen)
+	if err != nil {
+		logging.LogError(ctx, err)
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle(server.MetricsPath, webServer.MetricsHandler())
+	if fdupsFinder != nil {
+		webServer.SetThrottler(fdupsFinder.Throttle())
+		mux.Handle(server.ThrottlePath, webServer.ThrottleHandler())
+	}
+	go func() {
+		if err := server.ServeHandler(ctx, ln, mux); err != nil {
+			logging.LogError(ctx, err)
+		}
+	}()
+	logging.LogMsg(ctx).Infof("metrics are served at %s%s", server.URL(ln), server.MetricsPath)
+}
+
+// serve runs web UI on saved results (if given) or on results of scanning (shown live while scanning)
+// until interrupted: interrupting of scanning stops only scanning, results found so far are served until interrupted again
+func serve(ctx context.Context) {
+	state := server.StateScanning
+	if len(cfg.Reports) > 0 {
+		state = server.StateLoaded
+	}
+	webServer = server.New(cfg.Roots, state)
+	ln, err := server.Listen(cfg.Listen)
+	if err != nil {
+		logging.LogError(ctx, err)
+		return
+	}
+	serverCtx, stopServer := context.WithCancel(cu.BuildContext(context.Background(), cu.SetContextOperation("0.serve")))
+	defer stopServer()
+	served := make(chan error, 1)
+	go func() {
+		served <- webServer.Serve(serverCtx, ln)
+	}()
+	// ctx is done after the first interrupt (stopping scanning), so server is stopped by the next one
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	msg := fmt.Sprintf("web UI is served at %s (press Ctrl+C to stop)", server.URL(ln))
+	logging.LogMsg(ctx).Info(msg)
+	fmt.Println(msg)
+
+	if len(cfg.Reports) > 0 {
+		reportGroups, err := out.LoadDupsResults(cfg.Reports...)
+		if err != nil {
+			logging.LogError(ctx, err)
+			return
+		}
+		webServer.SetGroups(reportGroups)
+	} else {
+		webServer.SetThrottler(fdupsFinder.Throttle())
+		result, err := fdupsFinder.Run(ctx)
+		if result != nil {
+			webServer.SetStats(statsCollector.Collect(result.Stats...))
+			webServer.SetGroups(out.NewReportGroups(result.Dups))
+		}
+		switch {
+		case result == nil:
+			logging.LogError(err)
+			return
+		case err != nil:
+			logging.LogError(err)
+			webServer.SetState(server.StateInterrupted)
+			select {
+			case <-interrupts: // the one scanning is stopped by
+			default:
+			}
+			fmt.Printf("\nProcessing stopped: %v\n", err)
+			offerToSaveResults(ctx, result)
+		default:
+			webServer.SetState(server.StateCompleted)
 			if !cfg.IsDry {
-				fmt.Println("Do you wish to save reports of already found duplicates? [Y]es / [N]o")
-				var answer string
-				if n, err := fmt.Scanln(&answer); n >= 1 && err == nil {
-					if strings.ToUpper(strings.SplitN(answer, "", 1)[0]) == "Y" {
-						SaveResults(ctx, contentFilter.Stats().(*filtering.ContentFilterStats))
-					}
-				}
+				SaveResults(ctx, result)
 			}
-			<-finish
-			return
-		case <-time.After(cfg.StatsUpdateRate):
-			out.PrintStats(ctx, startTime, workflow.Pipelines(pipeline).StatProducers()...)
 		}
+		fmt.Println(msg)
 	}
-	out.PrintStats(ctx, startTime, workflow.Pipelines(pipeline).StatProducers()...)
-	if !cfg.IsDry {
-		SaveResults(ctx, contentFilter.Stats().(*filtering.ContentFilterStats))
+	select {
+	case <-interrupts:
+		stopServer()
+		err = <-served
+	case err = <-served:
+	}
+	if err != nil {
+		logging.LogError(ctx, err)
 	}
 }
 
-func SaveResults(ctx context.Context, dups *filtering.ContentFilterStats) {
-	reports := out.SaveDupsResults(ctx, cfg.OutputDir, cfg.OutputFilePrefix, cfg.MaxGroupsPerOutputFile, dups)
+func SaveResults(ctx context.Context, result *finder.Result) {
+	if cfg.Truncated {
+		SaveTruncated(ctx, result)
+	}
+	reports := out.SaveDupsResults(ctx, cfg.OutputDir, cfg.OutputFilePrefix, cfg.MaxGroupsPerOutputFile, cfg.SaveWorkers, result.Dups, result.IsCompleted)
+	if reports == nil {
+		logging.LogMsg(ctx).Info("no duplicates found - nothing to save")
+		return
+	}
 	for report := range reports {
 		if report.Err != nil {
 			logging.LogError(report.Err)
@@ -399,3 +764,17 @@ func SaveResults(ctx context.Context, dups *filtering.ContentFilterStats) {
 		}
 	}
 }
+
+// SaveTruncated saves report of truncated copies found (if any)
+func SaveTruncated(ctx context.Context, result *finder.Result) {
+	if len(result.Truncated) == 0 {
+		logging.LogMsg(ctx).Info("no truncated copies found - nothing to save")
+		return
+	}
+	filePath, err := out.SaveTruncatedReport(cfg.OutputDir, cfg.OutputFilePrefix, out.NewTruncatedReport(result.Truncated, result.IsCompleted))
+	if err != nil {
+		logging.LogError(ctx, err)
+		return
+	}
+	logging.LogMsg(ctx).Infof("truncated copies report written to file [%s]: %d(pairs)", filePath, len(result.Truncated))
+}
@@ -0,0 +1,157 @@
+package output
+
+import (
+	"bufio"
+	"fmt"
+	fs "github.com/nj-eka/fdups/filestat"
+	"github.com/nj-eka/fdups/registrator"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ReportGroup - group of duplicates loaded from saved results (see SaveDupsResults)
+type ReportGroup struct {
+	// Key - meta and content key of group in format mid{...};cid{...}
+	Key   string       `json:"key"`
+	Files []ReportFile `json:"files"`
+}
+
+// ReportFile - file of group of duplicates loaded from saved results (line format is defined by FileStat.String)
+type ReportFile struct {
+	Inode uint64 `json:"inode"`
+	Nlink uint64 `json:"nlink"`
+	Perm  string `json:"perm"`
+	Size  int64  `json:"size"`
+	// ModTime - modification time as it is saved (RFC1123)
+	ModTime string `json:"mod_time"`
+	// Owner - user:group
+	Owner string `json:"owner"`
+	// Path - path of file (or symlink)
+	Path string `json:"path"`
+	// Target - resolved path if file is symlink
+	Target string `json:"target,omitempty"`
+	// Line - line as it is saved
+	Line string `json:"-"`
+}
+
+// LoadDupsResults loads groups of duplicates from result files saved by SaveDupsResults
+// groups are returned in the order they are saved in files
+func LoadDupsResults(filePaths ...string) ([]ReportGroup, error) {
+	var groups []ReportGroup
+	for _, filePath := range filePaths {
+		fileGroups, err := loadDupsResultsFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, fileGroups...)
+	}
+	return groups, nil
+}
+
+// partialResultsFileRe - name of results file of interrupted processing (see SaveDupsResults)
+var partialResultsFileRe = regexp.MustCompile(`_p_\d{8}_\d{6}_\d+\.dat$`)
+
+// IsPartialResultsFile - results file is saved by interrupted (or aborted) processing, so its groups are partial
+func IsPartialResultsFile(filePath string) bool {
+	return partialResultsFileRe.MatchString(filepath.Base(filePath))
+}
+
+// NewReportGroups makes groups of duplicates from in-memory results
+// in the same form as they are loaded from saved results (groups are sorted by meta key)
+func NewReportGroups(dups registrator.Mcifs) []ReportGroup {
+	groups := make([]ReportGroup, 0, len(dups))
+	for _, mcKey := range dups.GetKeysSortedByMid() {
+		group := ReportGroup{Key: mcKey.String()}
+		for _, fileStat := range registrator.Inofs(dups[mcKey]).GetFileStatSorted() {
+			group.Files = append(group.Files, NewReportFile(fileStat))
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// NewReportFile makes report file from fileStat as it would be loaded from saved results
+func NewReportFile(fileStat fs.FileStat) ReportFile {
+	rf, err := parseReportFile(fileStat.String())
+	if err != nil {
+		// should not happen as long as line format is defined by FileStat.String
+		rf = ReportFile{Inode: uint64(fileStat.Inode()), Size: fileStat.Size(), Path: fileStat.Path(), Line: fileStat.String()}
+	}
+	return rf
+}
+
+func loadDupsResultsFile(filePath string) (groups []ReportGroup, err error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening results file [%s] failed: %w", filePath, err)
+	}
+	defer func() {
+		if e := file.Close(); e != nil && err == nil {
+			err = fmt.Errorf("closing results file [%s] failed: %w", filePath, e)
+		}
+	}()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			// #%d: %d(%d) mid{...};cid{...}
+			parts := strings.SplitN(line, " ", 3)
+			if len(parts) != 3 {
+				return nil, fmt.Errorf("invalid group header in [%s:%d]: %s", filePath, lineNumber, line)
+			}
+			groups = append(groups, ReportGroup{Key: parts[2]})
+			continue
+		}
+		if len(groups) == 0 {
+			return nil, fmt.Errorf("file line without group header in [%s:%d]: %s", filePath, lineNumber, line)
+		}
+		rf, err := parseReportFile(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file line in [%s:%d]: %w", filePath, lineNumber, err)
+		}
+		groups[len(groups)-1].Files = append(groups[len(groups)-1].Files, rf)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading results file [%s] failed: %w", filePath, err)
+	}
+	return groups, nil
+}
+
+// parseReportFile parses line in format: inode(nlink)|perm|size|modtime|user:group|path[ -> target]
+func parseReportFile(line string) (rf ReportFile, err error) {
+	parts := strings.SplitN(line, "|", 6)
+	if len(parts) != 6 {
+		return rf, fmt.Errorf("expected 6 fields separated by |: %s", line)
+	}
+	rf.Line = line
+	inodeLinks := strings.SplitN(strings.TrimSpace(parts[0]), "(", 2)
+	if len(inodeLinks) != 2 {
+		return rf, fmt.Errorf("invalid inode(nlink) field [%s]", parts[0])
+	}
+	if rf.Inode, err = strconv.ParseUint(inodeLinks[0], 10, 64); err != nil {
+		return rf, fmt.Errorf("invalid inode [%s]: %w", inodeLinks[0], err)
+	}
+	if rf.Nlink, err = strconv.ParseUint(strings.TrimSpace(strings.TrimSuffix(inodeLinks[1], ")")), 10, 64); err != nil {
+		return rf, fmt.Errorf("invalid nlink [%s]: %w", inodeLinks[1], err)
+	}
+	rf.Perm = strings.TrimSpace(parts[1])
+	if rf.Size, err = strconv.ParseInt(strings.TrimSpace(parts[2]), 10, 64); err != nil {
+		return rf, fmt.Errorf("invalid size [%s]: %w", parts[2], err)
+	}
+	rf.ModTime = strings.TrimSpace(parts[3])
+	rf.Owner = parts[4]
+	rf.Path = parts[5]
+	if pathTarget := strings.SplitN(parts[5], " -> ", 2); len(pathTarget) == 2 {
+		rf.Path, rf.Target = pathTarget[0], pathTarget[1]
+	}
+	return rf, nil
+}
@@ -0,0 +1,257 @@
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// MetricsNamespace - prefix of all exported metrics names
+const MetricsNamespace = "fdups"
+
+type metricsWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (mw *metricsWriter) printf(format string, args ...interface{}) {
+	if mw.err == nil {
+		_, mw.err = fmt.Fprintf(mw.w, format, args...)
+	}
+}
+
+// family writes metric family header
+func (mw *metricsWriter) family(name, typ, help string) {
+	mw.printf("# HELP %s_%s %s\n# TYPE %s_%s %s\n", MetricsNamespace, name, help, MetricsNamespace, name, typ)
+}
+
+// sample writes sample of metric family; labels are given as name, value pairs
+func (mw *metricsWriter) sample(name string, value float64, labels ...string) {
+	var sb strings.Builder
+	if len(labels) > 0 {
+		sb.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(labels[i])
+			sb.WriteString(`="`)
+			sb.WriteString(escapeLabelValue(labels[i+1]))
+			sb.WriteByte('"')
+		}
+		sb.WriteByte('}')
+	}
+	mw.printf("%s_%s%s %s\n", MetricsNamespace, name, sb.String(), strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func (mw *metricsWriter) metric(name, typ, help string, value float64) {
+	mw.family(name, typ, help)
+	mw.sample(name, value)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
+
+// WriteMetrics writes out statistics snapshot in Prometheus text exposition format (version 0.0.4)
+func WriteMetrics(w io.Writer, st Stats) error {
+	mw := metricsWriter{w: bufio.NewWriter(w)}
+	completed := 0.0
+	if st.IsCompleted {
+		completed = 1
+	}
+	mw.metric("elapsed_seconds", "gauge", "Time since start of processing.", st.Elapsed.Seconds())
+	mw.metric("completed", "gauge", "Processing is completed (1) or still in progress / interrupted (0).", completed)
+	mw.metric("mem_alloc_bytes", "gauge", "Bytes of allocated heap objects.", float64(st.Mem.Alloc))
+	mw.metric("mem_sys_bytes", "gauge", "Bytes of memory obtained from the OS.", float64(st.Mem.Sys))
+	mw.metric("gc_total", "counter", "Number of completed GC cycles.", float64(st.Mem.NumGC))
+
+	if st.Found != nil {
+		mw.metric("files_found_total", "counter", "Paths found by search patterns (including repeats).", float64(st.Found.Total))
+		mw.metric("files_found_unique", "gauge", "Unique paths found by search patterns.", float64(st.Found.Unique))
+		mw.metric("files_found_per_second", "gauge", "Current search throughput.", st.Found.Rate.FilesPerSec)
+	}
+	if st.Validated != nil {
+		mw.metric("files_validated_per_second", "gauge", "Current validation throughput.", st.Validated.Rate.FilesPerSec)
+		mw.metric("files_validated_total", "counter", "Files passed validation.", float64(st.Validated.Unique))
+		mw.metric("files_validated_bytes", "gauge", "Size of files passed validation.", float64(st.Validated.Bytes))
+	}
+	if st.Inodes != nil {
+		mw.metric("inodes_validated_total", "counter", "Unique inodes of validated files.", float64(st.Inodes.Unique))
+		mw.metric("inodes_validated_bytes", "gauge", "Size of unique inodes of validated files.", float64(st.Inodes.Bytes))
+	}
+	if len(st.Stages) > 0 {
+		mw.family("stage_groups", "gauge", "Groups registered by hash filter stage.")
+		for _, stage := range st.Stages {
+			mw.sample("stage_groups", float64(stage.Groups), "stage", strconv.Itoa(stage.Stage), "name", stage.Name)
+		}
+		mw.family("stage_inodes_total", "counter", "Inodes processed by hash filter stage.")
+		for _, stage := range st.Stages {
+			mw.sample("stage_inodes_total", float64(stage.Inodes), "stage", strconv.Itoa(stage.Stage), "name", stage.Name)
+		}
+		mw.family("stage_read_bytes_total", "counter", "Bytes read by hash filter stage.")
+		for _, stage := range st.Stages {
+			mw.sample("stage_read_bytes_total", float64(stage.Read), "stage", strconv.Itoa(stage.Stage), "name", stage.Name)
+		}
+		mw.family("stage_read_bytes_per_second", "gauge", "Current read throughput of hash filter stage.")
+		for _, stage := range st.Stages {
+			mw.sample("stage_read_bytes_per_second", stage.Rate.BytesPerSec, "stage", strconv.Itoa(stage.Stage), "name", stage.Name)
+		}
+		mw.family("stage_current_workers", "gauge", "Current max number of workers of hash filter stage.")
+		for _, stage := range st.Stages {
+			mw.sample("stage_current_workers", float64(stage.Workers), "stage", strconv.Itoa(stage.Stage), "name", stage.Name)
+		}
+		mw.family("stage_bypassed_total", "counter", "Files passed by hash filter stage without hashing as prefilter doesn't pay off.")
+		for _, stage := range st.Stages {
+			mw.sample("stage_bypassed_total", float64(stage.Bypassed), "stage", strconv.Itoa(stage.Stage), "name", stage.Name)
+		}
+		mw.family("stage_skipped_total", "counter", "Files passed by hash filter stage without hashing as they are smaller than its min size.")
+		for _, stage := range st.Stages {
+			mw.sample("stage_skipped_total", float64(stage.Skipped), "stage", strconv.Itoa(stage.Stage), "name", stage.Name)
+		}
+		mw.family("stage_inodes_per_second", "gauge", "Current hashing throughput of hash filter stage.")
+		for _, stage := range st.Stages {
+			mw.sample("stage_inodes_per_second", stage.Rate.FilesPerSec, "stage", strconv.Itoa(stage.Stage), "name", stage.Name)
+		}
+	}
+	if st.Content != nil {
+		mw.metric("content_candidates_bytes", "gauge", "Size of candidate inodes passed to content filter.", float64(st.Content.Bytes))
+		mw.metric("content_queued_bytes", "gauge", "Bytes of candidates not hashed by final stage yet (upper bound).", float64(st.Content.Queued))
+		mw.metric("content_eta_seconds", "gauge", "Estimated time to finish content filtering (0 - unknown or completed).", st.Content.ETA.Seconds())
+	}
+	if st.Dups != nil {
+		mw.metric("dup_groups", "gauge", "Groups of duplicates found.", float64(st.Dups.Groups))
+		mw.metric("dup_inodes", "gauge", "Inodes in groups of duplicates.", float64(st.Dups.Inodes))
+		mw.metric("dup_unique_bytes", "gauge", "Size of unique content in groups of duplicates.", float64(st.Dups.Unique))
+		mw.metric("dup_total_bytes", "gauge", "Total size of inodes in groups of duplicates.", float64(st.Dups.Total))
+		mw.metric("dup_wasted_bytes", "gauge", "Bytes that can be freed by removing duplicates.", float64(st.Dups.Wasted))
+	}
+	if st.Verification != nil {
+		mw.metric("verify_groups", "gauge", "Groups of duplicates to verify byte by byte.", float64(st.Verification.Groups))
+		mw.metric("verify_groups_verified", "gauge", "Groups of duplicates verified byte by byte so far.", float64(st.Verification.Verified))
+		mw.metric("verify_groups_split_total", "counter", "Groups of duplicates split by verification (hash collisions).", float64(st.Verification.Split))
+		mw.metric("verify_modified_files_total", "counter", "Files excluded from groups by verification as they were modified meanwhile.", float64(st.Verification.Modified))
+	}
+	if st.Truncation != nil {
+		mw.metric("truncation_inodes", "gauge", "Inodes registered by truncated copies detection.", float64(st.Truncation.Files))
+		mw.metric("truncation_hashed_inodes", "gauge", "Inodes hashed by head by truncated copies detection.", float64(st.Truncation.Hashed))
+		mw.metric("truncation_groups", "gauge", "Groups of inodes with the same head checksum and different sizes.", float64(st.Truncation.Groups))
+		mw.metric("truncation_compared_total", "counter", "Pairs of files compared by truncated copies detection.", float64(st.Truncation.Compared))
+		mw.metric("truncation_skipped_groups", "gauge", "Groups not compared for truncated copies as too large.", float64(st.Truncation.Skipped))
+		mw.metric("truncated_copies", "gauge", "Truncated copies found (files that are exact prefixes of larger files).", float64(st.Truncation.Found))
+	}
+	if st.Blocks != nil {
+		mw.metric("blocks_files", "gauge", "Unique inodes split into content-defined chunks.", float64(st.Blocks.Total.Files))
+		mw.metric("blocks_chunks", "gauge", "Content-defined chunks of files.", float64(st.Blocks.Total.Chunks))
+		mw.metric("blocks_unique_chunks", "gauge", "Content-defined chunks of files with distinct content.", float64(st.Blocks.Total.UniqueChunks))
+		mw.metric("blocks_bytes", "gauge", "Size of content-defined chunks of files.", float64(st.Blocks.Total.Bytes))
+		mw.metric("blocks_unique_bytes", "gauge", "Size of content-defined chunks of files with distinct content.", float64(st.Blocks.Total.UniqueBytes))
+		mw.metric("blocks_saved_bytes", "gauge", "Bytes that block-level dedup would save.", float64(st.Blocks.Total.Saved))
+		mw.family("blocks_root_bytes", "gauge", "Size of content-defined chunks of files of root.")
+		for _, bs := range st.Blocks.Roots {
+			mw.sample("blocks_root_bytes", float64(bs.Bytes), "root", bs.Root)
+		}
+		mw.family("blocks_root_unique_bytes", "gauge", "Size of content-defined chunks of files of root with distinct content (within root).")
+		for _, bs := range st.Blocks.Roots {
+			mw.sample("blocks_root_unique_bytes", float64(bs.UniqueBytes), "root", bs.Root)
+		}
+		mw.family("blocks_root_saved_bytes", "gauge", "Bytes that block-level dedup of root alone would save.")
+		for _, bs := range st.Blocks.Roots {
+			mw.sample("blocks_root_saved_bytes", float64(bs.Saved), "root", bs.Root)
+		}
+	}
+	if len(st.Concurrency) > 0 {
+		mw.family("stage_workers", "gauge", "Max number of workers of pipeline stage.")
+		for _, sc := range st.Concurrency {
+			mw.sample("stage_workers", float64(sc.Workers), "stage", sc.Stage)
+		}
+		mw.family("stage_buffer", "gauge", "Capacity of output channel of pipeline stage.")
+		for _, sc := range st.Concurrency {
+			mw.sample("stage_buffer", float64(sc.Buffer), "stage", sc.Stage)
+		}
+	}
+	if len(st.Devices) > 0 {
+		mw.family("device_read_limit", "gauge", "Max number of files read simultaneously from device by hashing.")
+		for _, ds := range st.Devices {
+			mw.sample("device_read_limit", float64(ds.Limit), "device", ds.Device, "rotational", strconv.FormatBool(ds.Rotational))
+		}
+		mw.family("device_reads_running", "gauge", "Files being read from device by hashing.")
+		for _, ds := range st.Devices {
+			mw.sample("device_reads_running", float64(ds.Running), "device", ds.Device, "rotational", strconv.FormatBool(ds.Rotational))
+		}
+		mw.family("device_reads_waiting", "gauge", "Files waiting for device to be read by hashing.")
+		for _, ds := range st.Devices {
+			mw.sample("device_reads_waiting", float64(ds.Waiting), "device", ds.Device, "rotational", strconv.FormatBool(ds.Rotational))
+		}
+		mw.family("device_reads_total", "counter", "Files read from device by hashing.")
+		for _, ds := range st.Devices {
+			mw.sample("device_reads_total", float64(ds.Reads), "device", ds.Device, "rotational", strconv.FormatBool(ds.Rotational))
+		}
+	}
+	if st.Throttle != nil {
+		mw.metric("throttle_read_bytes_per_second", "gauge", "Limit of hashing reads (0 - unlimited).", float64(st.Throttle.ReadRate))
+		mw.metric("throttle_opens_per_second", "gauge", "Limit of files opened by hashing (0 - unlimited).", float64(st.Throttle.OpenRate))
+		mw.metric("throttle_waited_seconds_total", "counter", "Total time hashers have been held back by throttle.", st.Throttle.Waited.Seconds())
+	}
+	if st.ReadFallbacks > 0 {
+		mw.metric("read_fallbacks_total", "counter", "Files hashed in fallback read mode.", float64(st.ReadFallbacks))
+	}
+	if len(st.Retries) > 0 {
+		mw.family("retries_total", "counter", "Retries of operations failed with transient errors.")
+		for _, rs := range st.Retries {
+			mw.sample("retries_total", float64(rs.Retries), "stage", rs.Stage)
+		}
+		mw.family("retries_recovered_total", "counter", "Operations succeeded after retries.")
+		for _, rs := range st.Retries {
+			mw.sample("retries_recovered_total", float64(rs.Recovered), "stage", rs.Stage)
+		}
+		mw.family("retries_failed_total", "counter", "Operations failed with transient errors after all attempts.")
+		for _, rs := range st.Retries {
+			mw.sample("retries_failed_total", float64(rs.Failed), "stage", rs.Stage)
+		}
+	}
+	mw.family("errors_total", "counter", "Errors occurred by severity, kind and operation.")
+	for _, es := range st.Errors {
+		mw.sample("errors_total", float64(es.Count), "severity", es.Severity, "kind", es.Kind, "operation", es.Operations)
+	}
+	if mw.err == nil {
+		mw.err = mw.w.Flush()
+	}
+	return mw.err
+}
+
+// SaveMetrics writes metrics to file (e.g. for node_exporter textfile collector);
+// file is replaced atomically so that collector never reads partially written file
+func SaveMetrics(filePath string, st Stats) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("saving metrics to [%s] failed: %w", filePath, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	if err = WriteMetrics(tmp, st); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("saving metrics to [%s] failed: %w", filePath, err)
+	}
+	if err = tmp.Chmod(0644); err == nil {
+		err = tmp.Close()
+	} else {
+		_ = tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filePath)
+	}
+	if err != nil {
+		return fmt.Errorf("saving metrics to [%s] failed: %w", filePath, err)
+	}
+	return nil
+}
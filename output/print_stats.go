@@ -5,18 +5,11 @@ import (
 	"context"
 	"fmt"
 	cu "github.com/nj-eka/fdups/contexts"
-	"github.com/nj-eka/fdups/errflow"
 	fh "github.com/nj-eka/fdups/fh"
 	"github.com/nj-eka/fdups/logging"
-	"github.com/nj-eka/fdups/registrator"
 	"github.com/nj-eka/fdups/workflow"
-	"github.com/nj-eka/fdups/workflow/filtering"
-	"github.com/nj-eka/fdups/workflow/searching"
-	"github.com/nj-eka/fdups/workflow/validating"
-	"gonum.org/v1/gonum/stat"
+	"io"
 	"os"
-	"runtime"
-	"sort"
 	"time"
 )
 
@@ -24,8 +17,8 @@ const (
 	upLeft     = "\n\033[H\033[2J"
 	colorReset = "\033[0m"
 
-	colorRed   = "\033[31m"
-	colorGreen = "\033[32m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
 	colorYellow = "\033[33m"
 	colorBlue   = "\033[34m"
 	colorPurple = "\033[35m"
@@ -33,93 +26,133 @@ const (
 	colorWhite  = "\033[37m"
 )
 
+// PrintStats prints out statistics of given pipeline stages to os.Stdout (screen is cleared before)
 func PrintStats(ctx context.Context, startTime time.Time, statProducers ...workflow.StatProducer) {
-	ctx = cu.BuildContext(nil, cu.AddContextOperation("print_stats"))
-	bufOut := bufio.NewWriter(os.Stdout)
+	WriteStats(ctx, os.Stdout, CollectStats(startTime, statProducers...))
+}
+
+// WriteStats writes out statistics snapshot in human-readable (colored) form
+func WriteStats(ctx context.Context, w io.Writer, st Stats) {
+	ctx = cu.BuildContext(ctx, cu.AddContextOperation("print_stats"))
+	bufOut := bufio.NewWriter(w)
 	bout := func(s string) {
 		if _, err := bufOut.WriteString(s); err != nil {
-			logging.LogError(ctx, fmt.Sprintf("bufio write string [%s] failed: %w", s, err))
-		}
-	}
-	var (
-		foundPaths, validFileStats, validInodes, errsStats registrator.Encounter
-		dups                                               *filtering.ContentFilterStats
-	)
-	for _, statProducer := range statProducers {
-		switch st := statProducer.Stats().(type) {
-		case searching.SearcherStats:
-			foundPaths = st
-		case *validating.ValidatorStats:
-			validFileStats = st.FileStats
-			validInodes = st.InodeStats
-		case errflow.ErrorStats:
-			errsStats = st
-		case *filtering.ContentFilterStats:
-			dups = st
+			logging.LogError(ctx, fmt.Errorf("bufio write string [%s] failed: %w", s, err))
 		}
 	}
 
 	bout(upLeft)
-	isCompleted := dups.IsCompleted()
-	if !isCompleted {
+	if !st.IsCompleted {
 		bout(fmt.Sprintln("---------- Processing stats --------------"))
 	} else {
 		bout(fmt.Sprintln("==========    Final stats   =============="))
 	}
-	bout(fmt.Sprintln("Time elapsed: ", time.Since(startTime).Round(time.Second)))
+	bout(fmt.Sprintln("Time elapsed: ", st.Elapsed.Round(time.Second)))
 
-	var ms runtime.MemStats
-	runtime.ReadMemStats(&ms)
 	bout(fmt.Sprint(colorCyan, "Runtime mem usage:"))
-	bout(fmt.Sprintf("\tAlloc = %v", fh.BytesToHuman(ms.Alloc)))           // Alloc is bytes of allocated heap objects. HeapAlloc is bytes of allocated heap objects.
-	bout(fmt.Sprintf("\tTotalAlloc = %v", fh.BytesToHuman(ms.TotalAlloc))) // TotalAlloc is cumulative bytes allocated for heap objects.
-	bout(fmt.Sprintf("\tSys = %v", fh.BytesToHuman(ms.Sys)))               // Sys is the total bytes of memory obtained from the OS.
-	bout(fmt.Sprintf("\tMallocs = %v", fh.BytesToHuman(ms.Mallocs)))       // Mallocs is the cumulative count of heap objects allocated.
-	bout(fmt.Sprintf("\tFrees = %v", fh.BytesToHuman(ms.Frees)))           // Frees is the cumulative count of heap objects freed.
-	bout(fmt.Sprintf("\tGCSys = %v", fh.BytesToHuman(ms.GCSys)))           // GCSys is bytes of memory in garbage collection metadata.
-	bout(fmt.Sprintf("\tNumGC = %v\n", ms.NumGC))
+	bout(fmt.Sprintf("\tAlloc = %v", fh.BytesToHuman(st.Mem.Alloc)))           // Alloc is bytes of allocated heap objects. HeapAlloc is bytes of allocated heap objects.
+	bout(fmt.Sprintf("\tTotalAlloc = %v", fh.BytesToHuman(st.Mem.TotalAlloc))) // TotalAlloc is cumulative bytes allocated for heap objects.
+	bout(fmt.Sprintf("\tSys = %v", fh.BytesToHuman(st.Mem.Sys)))               // Sys is the total bytes of memory obtained from the OS.
+	bout(fmt.Sprintf("\tMallocs = %v", fh.BytesToHuman(st.Mem.Mallocs)))       // Mallocs is the cumulative count of heap objects allocated.
+	bout(fmt.Sprintf("\tFrees = %v", fh.BytesToHuman(st.Mem.Frees)))           // Frees is the cumulative count of heap objects freed.
+	bout(fmt.Sprintf("\tGCSys = %v", fh.BytesToHuman(st.Mem.GCSys)))           // GCSys is bytes of memory in garbage collection metadata.
+	bout(fmt.Sprintf("\tNumGC = %v\n", st.Mem.NumGC))
 
 	bout(fmt.Sprint(colorBlue, "Search & validation:"))
-	if foundPaths != nil {
-		bout(fmt.Sprintf("\t%12d/%d files (found/unique)", foundPaths.TotalCount(), foundPaths.KeysCount()))
+	if st.Found != nil {
+		bout(fmt.Sprintf("\t%12d/%d files (found/unique)", st.Found.Total, st.Found.Unique))
+	}
+	if st.Validated != nil {
+		bout(fmt.Sprintf("\t%8d(%v) validated", st.Validated.Unique, fh.BytesToHuman(uint64(st.Validated.Bytes))))
 	}
-	if validFileStats != nil {
-		uniqueSizes, _ := registrator.GetKeySizes(validFileStats.GetScores())
-		bout(fmt.Sprintf("\t%8d(%v) validated", validFileStats.KeysCount(), fh.BytesToHuman(uint64(uniqueSizes))))
+	if st.Inodes != nil {
+		bout(fmt.Sprintf("\t%11d(%v) inodes\n", st.Inodes.Unique, fh.BytesToHuman(uint64(st.Inodes.Bytes))))
 	}
-	if validInodes != nil {
-		uniqueSizes, _ := registrator.GetKeySizes(validInodes.GetScores())
-		bout(fmt.Sprintf("\t%11d(%v) inodes\n", validInodes.KeysCount(), fh.BytesToHuman(uint64(uniqueSizes))))
+	if st.Found != nil && st.Validated != nil {
+		bout(fmt.Sprintf("throughput:\t%12.0f files/s (found)\t%s (validated)\n", st.Found.Rate.FilesPerSec, rateToHuman(st.Validated.Rate)))
 	}
-	if dups != nil {
+	if st.Dups != nil {
 		bout(fmt.Sprintln("sizing (quantiles):"))
-		sizesScore := dups.MetaRegister.GetSizesCounter().GetScores()
-		PrintFilesStat(sizesScore, "\t", bufOut)
+		printSizeBins(st.Sizes, "\t", bufOut)
 
 		bout(fmt.Sprintln(colorGreen, "\nHash filters:"))
-		for stageNumber, stageInodesStat := range dups.StageInodeStats {
-			inodesCount, totalSize := stageInodesStat.GetStats()
-			stageGroupsCount := dups.StageRegisters[stageNumber].GetKeysCounter().KeysCount()
-			bout(fmt.Sprintf("\t[%2d]: %8d(groups) %8d(inodes) %12v(read)\n", stageNumber, stageGroupsCount, inodesCount, fh.BytesToHuman(uint64(totalSize))))
+		for _, stage := range st.Stages {
+			bout(fmt.Sprintf("\t[%2d] %-24s: %8d(groups) %8d(inodes) %12v(read) %s %4d(workers)", stage.Stage, stage.Name, stage.Groups, stage.Inodes, fh.BytesToHuman(uint64(stage.Read)), rateToHuman(stage.Rate), stage.Workers))
+			if stage.Bypassed > 0 {
+				bout(fmt.Sprintf(" %8d(bypassed)", stage.Bypassed))
+			}
+			if stage.Skipped > 0 {
+				bout(fmt.Sprintf(" %8d(skipped)", stage.Skipped))
+			}
+			bout("\n")
+		}
+		for _, hf := range st.Hashing {
+			bout(fmt.Sprintf("\thashing: %5.1f%% of %10v %s\n", hf.Percent, fh.BytesToHuman(uint64(hf.Size)), hf.Path))
+		}
+		if st.Content != nil {
+			bout(fmt.Sprintf("\tcandidates: %d(%v)\tqueued: %v\tETA: %s\n", st.Content.Inodes, fh.BytesToHuman(uint64(st.Content.Bytes)), fh.BytesToHuman(uint64(st.Content.Queued)), etaToHuman(st.Content.ETA, st.IsCompleted)))
 		}
 
 		bout(fmt.Sprintln(colorPurple, "\nDuplicates found:"))
-		keysCounter := dups.ContentRegister.GetKeysCounter()
-		scores := keysCounter.GetScores()
-		uniqueSizes, totalSizes := registrator.GetKeySizes(scores)
-		bout(fmt.Sprintf("\t%14d(groups) %8d(inodes) %12v(unique) %12v(total) %12v(can be freed)\n", keysCounter.KeysCount(), keysCounter.TotalCount(), fh.BytesToHuman(uint64(uniqueSizes)), fh.BytesToHuman(uint64(totalSizes)), fh.BytesToHuman(uint64(totalSizes-uniqueSizes))))
+		bout(fmt.Sprintf("\t%14d(groups) %8d(inodes) %12v(unique) %12v(total) %12v(can be freed)\n", st.Dups.Groups, st.Dups.Inodes, fh.BytesToHuman(uint64(st.Dups.Unique)), fh.BytesToHuman(uint64(st.Dups.Total)), fh.BytesToHuman(uint64(st.Dups.Wasted))))
 		bout(fmt.Sprintln("sizing (quantiles):"))
-		PrintFilesStat(scores, "\t", bufOut)
-	}
-	if errsStats != nil {
-		cp := errsStats.GetCounterPairs()
-		if len(cp) > 0 {
-			bout(fmt.Sprintln(colorRed, "\nErrors:"))
-			sort.Sort(registrator.CounterPairsByKey(cp))
-			for _, cp := range cp {
-				esk := cp.Key.(errflow.ErrStatKey)
-				bout(fmt.Sprintf(" *%-8s: %-48s # %4d - %s\n", esk.Severity, esk.Operations, cp.Count, esk.Kind))
+		printSizeBins(st.Dups.Sizes, "\t", bufOut)
+		if st.Verification != nil {
+			bout(fmt.Sprintf("verified:\t%8d/%d(groups) %8d(split) %8d(modified files excluded)\n", st.Verification.Verified, st.Verification.Groups, st.Verification.Split, st.Verification.Modified))
+		}
+	}
+	if st.Truncation != nil {
+		bout(fmt.Sprintln(colorPurple, "\nTruncated copies:"))
+		bout(fmt.Sprintf("\t%14d/%d(hashed/inodes) %8d(groups) %8d(compared) %8d(skipped groups) %8d(found)\n", st.Truncation.Hashed, st.Truncation.Files, st.Truncation.Groups, st.Truncation.Compared, st.Truncation.Skipped, st.Truncation.Found))
+	}
+	if st.Blocks != nil {
+		bout(fmt.Sprintln(colorPurple, "\nBlock-level dedup (content-defined chunks):"))
+		for _, bs := range append(st.Blocks.Roots, st.Blocks.Total) {
+			root := bs.Root
+			if root == "" {
+				root = "total"
+			}
+			bout(fmt.Sprintf("\t%8d(files) %10d/%-10d(chunks unique/all) %12v/%-12v(unique/all) %12v(can be saved) %s\n", bs.Files, bs.UniqueChunks, bs.Chunks, fh.BytesToHuman(uint64(bs.UniqueBytes)), fh.BytesToHuman(uint64(bs.Bytes)), fh.BytesToHuman(uint64(bs.Saved)), root))
+		}
+		for _, hf := range st.Hashing {
+			bout(fmt.Sprintf("\tchunking: %5.1f%% of %10v %s\n", hf.Percent, fh.BytesToHuman(uint64(hf.Size)), hf.Path))
+		}
+	}
+	if len(st.Concurrency) > 0 {
+		bout(fmt.Sprint(colorReset, "\nworkers/buffer:"))
+		for _, sc := range st.Concurrency {
+			bout(fmt.Sprintf("\t%s %d/%d", sc.Stage, sc.Workers, sc.Buffer))
+		}
+		bout("\n")
+	}
+	if len(st.Devices) > 0 {
+		bout(fmt.Sprintln(colorCyan, "\nDevices (hashing reads):"))
+		for _, ds := range st.Devices {
+			media := "-  "
+			if ds.Rotational {
+				media = "hdd"
 			}
+			bout(fmt.Sprintf("\t%-8s %s %4d/%-4d(running/limit) %8d(waiting) %10d(reads)\n", ds.Device, media, ds.Running, ds.Limit, ds.Waiting, ds.Reads))
+		}
+	}
+	if st.Throttle.IsLimited() || (st.Throttle != nil && st.Throttle.Waited > 0) {
+		bout(fmt.Sprintln(colorYellow, "\nThrottle (hashing):"))
+		bout(fmt.Sprintf("\t%s(read) %s(open) %v(waited by hashers)\n", throttleRateToHuman(st.Throttle.ReadRate, true), throttleRateToHuman(st.Throttle.OpenRate, false), st.Throttle.Waited.Round(time.Millisecond)))
+	}
+	if st.ReadFallbacks > 0 {
+		bout(fmt.Sprintln(colorYellow, "\nRead mode fallbacks:"))
+		bout(fmt.Sprintf("\t%d file(s) hashed in fallback read mode (the first one of each device is reported as warning)\n", st.ReadFallbacks))
+	}
+	if st.RetriesCount() > 0 {
+		bout(fmt.Sprintln(colorYellow, "\nRetries (transient errors):"))
+		for _, rs := range st.Retries {
+			bout(fmt.Sprintf("\t%-12s %8d(retries) %8d(recovered) %8d(failed)\n", rs.Stage, rs.Retries, rs.Recovered, rs.Failed))
+		}
+	}
+	if len(st.Errors) > 0 {
+		bout(fmt.Sprintln(colorRed, "\nErrors:"))
+		for _, es := range st.Errors {
+			bout(fmt.Sprintf(" *%-8s: %-48s # %4d - %s\n", es.Severity, es.Operations, es.Count, es.Kind))
 		}
 	}
 	bout(fmt.Sprint(colorReset))
@@ -128,32 +161,33 @@ func PrintStats(ctx context.Context, startTime time.Time, statProducers ...workf
 	}
 }
 
-func PrintFilesStat(sizesScore map[interface{}]int, tab string, bufout *bufio.Writer) {
-	numSizes := len(sizesScore)
-	if numSizes == 0 {
-		return
-	}
-	sizes, counts := make([]float64, 0, numSizes), make([]float64, 0, numSizes)
-	for size, count := range sizesScore {
-		if ks, ok := size.(registrator.KeySize); ok {
-			size = ks.Size
-		}
-		sizes = append(sizes, float64(size.(int64)))
-		counts = append(counts, float64(count))
-	}
-	sort.SliceStable(counts, func(i, j int) bool { return sizes[i] < sizes[j] })
-	sort.SliceStable(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
-	dividers := []float64{
-		sizes[0],
-		stat.Quantile(0.25, stat.Empirical, sizes, counts),
-		stat.Quantile(0.5, stat.Empirical, sizes, counts),
-		stat.Quantile(0.75, stat.Empirical, sizes, counts),
-		sizes[numSizes-1] + 1,
-	}
-	hist := stat.Histogram(nil, dividers, sizes, counts)
-	for i := 0; i < len(hist); i++ {
-		if hist[i] > 0 {
-			_, _ = bufout.WriteString(fmt.Sprintf("%s%-5.0f:%12.0f-%-12.0f\n", tab, hist[i], dividers[i], dividers[i+1]))
-		}
+func rateToHuman(rate Rate) string {
+	return fmt.Sprintf("%8.0f files/s %10v/s", rate.FilesPerSec, fh.BytesToHuman(uint64(rate.BytesPerSec)))
+}
+
+func throttleRateToHuman(rate int64, inBytes bool) string {
+	switch {
+	case rate <= 0:
+		return "unlimited"
+	case inBytes:
+		return fmt.Sprintf("%v/s", fh.BytesToHuman(uint64(rate)))
+	default:
+		return fmt.Sprintf("%d files/s", rate)
+	}
+}
+
+func etaToHuman(eta time.Duration, isCompleted bool) string {
+	switch {
+	case isCompleted:
+		return "done"
+	case eta <= 0:
+		return "unknown"
+	}
+	return eta.String()
+}
+
+func printSizeBins(bins []SizeBin, tab string, bufout *bufio.Writer) {
+	for _, bin := range bins {
+		_, _ = bufout.WriteString(fmt.Sprintf("%s%-5.0f:%12.0f-%-12.0f\n", tab, bin.Count, bin.From, bin.To))
 	}
 }
@@ -0,0 +1,158 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	cu "github.com/nj-eka/fdups/contexts"
+	fh "github.com/nj-eka/fdups/fh"
+	"github.com/nj-eka/fdups/logging"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProgressMode - how processing stats are printed out
+type ProgressMode string
+
+const (
+	ProgressAuto      ProgressMode = "auto"      // dashboard if output is terminal, line otherwise
+	ProgressDashboard ProgressMode = "dashboard" // screen is cleared and colored stats are printed (see WriteStats)
+	ProgressLine      ProgressMode = "line"      // single plain line per update (see WriteProgressLine)
+	ProgressNone      ProgressMode = "none"      // nothing is printed
+)
+
+// ParseProgressMode parses progress mode (empty = auto)
+func ParseProgressMode(s string) (ProgressMode, error) {
+	switch mode := ProgressMode(strings.ToLower(s)); mode {
+	case "":
+		return ProgressAuto, nil
+	case ProgressAuto, ProgressDashboard, ProgressLine, ProgressNone:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid progress mode [%s]: expected %s, %s, %s or %s", s, ProgressAuto, ProgressDashboard, ProgressLine, ProgressNone)
+}
+
+// Resolve resolves auto mode according to output file type
+func (m ProgressMode) Resolve(f *os.File) ProgressMode {
+	if m != ProgressAuto {
+		return m
+	}
+	if IsTerminal(f) {
+		return ProgressDashboard
+	}
+	return ProgressLine
+}
+
+// IsTerminal - file is character device (terminal), as opposed to pipe or regular file
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// WriteProgress writes out stats snapshot in given (resolved) mode
+func WriteProgress(ctx context.Context, w io.Writer, mode ProgressMode, st Stats) {
+	switch mode {
+	case ProgressDashboard, ProgressAuto:
+		WriteStats(ctx, w, st)
+	case ProgressLine:
+		if err := WriteProgressLine(w, st); err != nil {
+			logging.LogError(cu.BuildContext(ctx, cu.AddContextOperation("print_stats")), fmt.Errorf("writing progress line failed: %w", err))
+		}
+	}
+}
+
+// WriteProgressLine writes out stats snapshot as single line without escape sequences (for logs and non-tty outputs)
+func WriteProgressLine(w io.Writer, st Stats) error {
+	var sb strings.Builder
+	state := "processing"
+	if st.IsCompleted {
+		state = "final"
+	}
+	sb.WriteString(fmt.Sprintf("%s %s [%s]", st.Time.Format(time.RFC3339), state, st.Elapsed.Round(time.Second)))
+	if st.Found != nil {
+		sb.WriteString(fmt.Sprintf(" found=%d/%d", st.Found.Total, st.Found.Unique))
+	}
+	if st.Validated != nil {
+		sb.WriteString(fmt.Sprintf(" validated=%d(%s)@%.0f/s", st.Validated.Unique, fh.BytesToHuman(uint64(st.Validated.Bytes)), st.Validated.Rate.FilesPerSec))
+	}
+	if st.Inodes != nil {
+		sb.WriteString(fmt.Sprintf(" inodes=%d(%s)", st.Inodes.Unique, fh.BytesToHuman(uint64(st.Inodes.Bytes))))
+	}
+	for _, stage := range st.Stages {
+		sb.WriteString(fmt.Sprintf(" stage%d=%dg/%di/%s@%s/s", stage.Stage, stage.Groups, stage.Inodes, fh.BytesToHuman(uint64(stage.Read)), fh.BytesToHuman(uint64(stage.Rate.BytesPerSec))))
+	}
+	if st.Content != nil {
+		sb.WriteString(fmt.Sprintf(" queued=%s eta=%s", fh.BytesToHuman(uint64(st.Content.Queued)), etaToHuman(st.Content.ETA, st.IsCompleted)))
+	}
+	if len(st.Hashing) > 0 { // the longest hashed large file (and number of others)
+		sb.WriteString(fmt.Sprintf(" hashing=%s(%.0f%%)", st.Hashing[0].Path, st.Hashing[0].Percent))
+		if len(st.Hashing) > 1 {
+			sb.WriteString(fmt.Sprintf("+%d", len(st.Hashing)-1))
+		}
+	}
+	if st.Dups != nil {
+		sb.WriteString(fmt.Sprintf(" dups=%dg/%di freeable=%s", st.Dups.Groups, st.Dups.Inodes, fh.BytesToHuman(uint64(st.Dups.Wasted))))
+	}
+	if st.Verification != nil && st.Verification.Groups > 0 {
+		sb.WriteString(fmt.Sprintf(" verified=%d/%dg split=%d modified=%d", st.Verification.Verified, st.Verification.Groups, st.Verification.Split, st.Verification.Modified))
+	}
+	if st.Truncation != nil {
+		sb.WriteString(fmt.Sprintf(" truncated=%d(%d/%di)", st.Truncation.Found, st.Truncation.Hashed, st.Truncation.Files))
+	}
+	if st.Blocks != nil {
+		sb.WriteString(fmt.Sprintf(" blocks=%s/%s saved=%s", fh.BytesToHuman(uint64(st.Blocks.Total.UniqueBytes)), fh.BytesToHuman(uint64(st.Blocks.Total.Bytes)), fh.BytesToHuman(uint64(st.Blocks.Total.Saved))))
+	}
+	if st.Throttle.IsLimited() {
+		sb.WriteString(fmt.Sprintf(" throttle=%s,%s", throttleRateToHuman(st.Throttle.ReadRate, true), throttleRateToHuman(st.Throttle.OpenRate, false)))
+	}
+	if retries := st.RetriesCount(); retries > 0 {
+		sb.WriteString(fmt.Sprintf(" retries=%d", retries))
+	}
+	sb.WriteString(fmt.Sprintf(" errors=%d mem=%s\n", st.ErrorsCount(), fh.BytesToHuman(st.Mem.Alloc)))
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// StatsStream - stream of stats snapshots in JSON lines format (one object per update)
+type StatsStream struct {
+	w   io.WriteCloser
+	enc *json.Encoder
+}
+
+// OpenStatsStream opens stats stream to file (appended) or to already opened file descriptor given as fd:N (e.g. fd:3)
+func OpenStatsStream(target string) (*StatsStream, error) {
+	var w io.WriteCloser
+	if strings.HasPrefix(target, "fd:") {
+		fd, err := strconv.Atoi(strings.TrimPrefix(target, "fd:"))
+		if err != nil || fd < 1 {
+			return nil, fmt.Errorf("invalid stats stream file descriptor [%s]", target)
+		}
+		f := os.NewFile(uintptr(fd), target)
+		if _, err = f.Stat(); err != nil {
+			return nil, fmt.Errorf("stats stream file descriptor [%s] is not available: %w", target, err)
+		}
+		w = f
+	} else {
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("opening stats stream [%s] failed: %w", target, err)
+		}
+		w = f
+	}
+	return &StatsStream{w: w, enc: json.NewEncoder(w)}, nil
+}
+
+// Write writes stats snapshot as single JSON line
+func (s *StatsStream) Write(st Stats) error {
+	if err := s.enc.Encode(st); err != nil {
+		return fmt.Errorf("writing stats stream failed: %w", err)
+	}
+	return nil
+}
+
+func (s *StatsStream) Close() error {
+	return s.w.Close()
+}
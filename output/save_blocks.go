@@ -0,0 +1,53 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nj-eka/fdups/workflow/chunking"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BlocksReport - block-level dedup estimate saved to output dir (see SaveBlocksReport)
+type BlocksReport struct {
+	Time        time.Time `json:"time"`
+	IsCompleted bool      `json:"is_completed"`
+	// ChunkSize - average size of content-defined chunks
+	ChunkSize int          `json:"chunk_size"`
+	Total     BlockStats   `json:"total"`
+	Roots     []BlockStats `json:"roots"`
+}
+
+// NewBlocksReport makes report of chunks of all files (total) and of files of each root (roots)
+func NewBlocksReport(chunkSize int, total chunking.BlockStats, roots []chunking.RootBlockStats, isCompleted bool) BlocksReport {
+	report := BlocksReport{
+		Time:        time.Now(),
+		IsCompleted: isCompleted,
+		ChunkSize:   chunkSize,
+		Total:       newBlockStats("", total),
+		Roots:       make([]BlockStats, 0, len(roots)),
+	}
+	for _, rs := range roots {
+		report.Roots = append(report.Roots, newBlockStats(rs.Root, rs.BlockStats))
+	}
+	return report
+}
+
+// SaveBlocksReport saves report as JSON to file [prefix_(f|p)_blocks_timestamp.json] in output dir
+// (f - final, p - partial as by SaveDupsResults), returns path of saved file
+func SaveBlocksReport(outputDir, outputFilePrefix string, report BlocksReport) (string, error) {
+	state := "p"
+	if report.IsCompleted {
+		state = "f"
+	}
+	filePath := filepath.Join(outputDir, fmt.Sprintf("%s_%s_blocks_%s.json", outputFilePrefix, state, report.Time.Format("20060102_150405")))
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return filePath, fmt.Errorf("saving blocks report to [%s] failed: %w", filePath, err)
+	}
+	if err = os.WriteFile(filePath, append(data, '\n'), 0664); err != nil {
+		return filePath, fmt.Errorf("saving blocks report to [%s] failed: %w", filePath, err)
+	}
+	return filePath, nil
+}
@@ -9,7 +9,6 @@ import (
 	fh "github.com/nj-eka/fdups/fh"
 	"github.com/nj-eka/fdups/logging"
 	"github.com/nj-eka/fdups/registrator"
-	"github.com/nj-eka/fdups/workflow/filtering"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -23,10 +22,12 @@ type SaveDupsReport struct {
 	IndexFrom, DupGroupsCount, FilesCount, Bytes int
 }
 
-func SaveDupsResults(ctx context.Context, outputDir, outputFilePrefix string, maxCountDupsPerOutputFile int, stats *filtering.ContentFilterStats) <-chan SaveDupsReport {
+// SaveDupsResults saves dups into output files by maxWorkers workers (0 = NumCPU*64)
+func SaveDupsResults(ctx context.Context, outputDir, outputFilePrefix string, maxCountDupsPerOutputFile, maxWorkers int, dups registrator.Mcifs, isCompleted bool) <-chan SaveDupsReport {
 	ctx = cou.BuildContext(ctx, cou.SetContextOperation("save results"))
-	var maxWorkers = runtime.NumCPU() * 64
-	dups, isCompleted := stats.GetResult()
+	if maxWorkers <= 0 {
+		maxWorkers = runtime.NumCPU() * 64
+	}
 	if !isCompleted {
 		outputFilePrefix = outputFilePrefix + "_p"
 	} else {
@@ -0,0 +1,59 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nj-eka/fdups/workflow/filtering"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TruncatedReport - truncated copies saved to output dir (see SaveTruncatedReport)
+type TruncatedReport struct {
+	Time        time.Time       `json:"time"`
+	IsCompleted bool            `json:"is_completed"`
+	Pairs       []TruncatedPair `json:"pairs"`
+}
+
+// TruncatedPair - file Truncated is exact prefix of file Full; Missing - bytes of Full missing in Truncated
+type TruncatedPair struct {
+	Truncated ReportFile `json:"truncated"`
+	Full      ReportFile `json:"full"`
+	Missing   int64      `json:"missing"`
+}
+
+// NewTruncatedReport makes report of truncated copies (in order of pairs)
+func NewTruncatedReport(pairs []filtering.TruncatedPair, isCompleted bool) TruncatedReport {
+	report := TruncatedReport{
+		Time:        time.Now(),
+		IsCompleted: isCompleted,
+		Pairs:       make([]TruncatedPair, 0, len(pairs)),
+	}
+	for _, pair := range pairs {
+		report.Pairs = append(report.Pairs, TruncatedPair{
+			Truncated: NewReportFile(pair.Truncated),
+			Full:      NewReportFile(pair.Full),
+			Missing:   pair.Full.Size() - pair.Truncated.Size(),
+		})
+	}
+	return report
+}
+
+// SaveTruncatedReport saves report as JSON to file [prefix_(f|p)_truncated_timestamp.json] in output dir
+// (f - final, p - partial as by SaveDupsResults), returns path of saved file
+func SaveTruncatedReport(outputDir, outputFilePrefix string, report TruncatedReport) (string, error) {
+	state := "p"
+	if report.IsCompleted {
+		state = "f"
+	}
+	filePath := filepath.Join(outputDir, fmt.Sprintf("%s_%s_truncated_%s.json", outputFilePrefix, state, report.Time.Format("20060102_150405")))
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return filePath, fmt.Errorf("saving truncated copies report to [%s] failed: %w", filePath, err)
+	}
+	if err = os.WriteFile(filePath, append(data, '\n'), 0664); err != nil {
+		return filePath, fmt.Errorf("saving truncated copies report to [%s] failed: %w", filePath, err)
+	}
+	return filePath, nil
+}
@@ -0,0 +1,490 @@
+package output
+
+import (
+	"github.com/nj-eka/fdups/errflow"
+	fs "github.com/nj-eka/fdups/filestat"
+	"github.com/nj-eka/fdups/registrator"
+	"github.com/nj-eka/fdups/workflow"
+	"github.com/nj-eka/fdups/workflow/chunking"
+	"github.com/nj-eka/fdups/workflow/filtering"
+	"github.com/nj-eka/fdups/workflow/searching"
+	"github.com/nj-eka/fdups/workflow/validating"
+	"gonum.org/v1/gonum/stat"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stats - snapshot of processing statistics collected from pipeline stages
+// (shared by console output and machine readable outputs)
+type Stats struct {
+	Time        time.Time     `json:"time"`
+	Elapsed     time.Duration `json:"elapsed"`
+	IsCompleted bool          `json:"is_completed"`
+	Mem         MemStats      `json:"mem"`
+	// Found - paths found by search patterns (nil if searcher stats are not available)
+	Found *CountStats `json:"found,omitempty"`
+	// Validated - files passed validation
+	Validated *CountStats `json:"validated,omitempty"`
+	// Inodes - unique inodes of validated files
+	Inodes *CountStats `json:"inodes,omitempty"`
+	// Sizes - distribution of sizes of files registered by meta filter
+	Sizes []SizeBin `json:"sizes,omitempty"`
+	// Stages - hash filters stats in order of applying
+	Stages []StageStats `json:"stages,omitempty"`
+	// Content - progress of content filter
+	Content *ContentStats `json:"content,omitempty"`
+	// Dups - duplicates found so far
+	Dups *DupsStats `json:"dups,omitempty"`
+	// Verification - progress of byte-by-byte verification of found groups (nil if verification is disabled)
+	Verification *VerificationStats `json:"verification,omitempty"`
+	// Truncation - progress of truncated copies detection (nil if it is disabled)
+	Truncation *TruncationStats `json:"truncation,omitempty"`
+	// Blocks - content-defined chunks of files counted by block-level dedup estimate (nil if it is not running)
+	Blocks *BlocksStats `json:"blocks,omitempty"`
+	// Concurrency - effective workers and buffers of pipeline stages (in pipeline order)
+	Concurrency []StageConcurrency `json:"concurrency,omitempty"`
+	// Devices - queues of hashing reads per device (if device scheduling is enabled)
+	Devices []DeviceStats `json:"devices,omitempty"`
+	// Hashing - large files being hashed (in order of start)
+	Hashing []HashingFileStats `json:"hashing,omitempty"`
+	// ReadFallbacks - files hashed in fallback read mode (e.g. O_DIRECT is not supported by file system)
+	ReadFallbacks int64 `json:"read_fallbacks,omitempty"`
+	// Throttle - limits of hashing reads / opens (nil if throttle is not available)
+	Throttle *ThrottleStats `json:"throttle,omitempty"`
+	// Retries - retries of operations failed with transient errors by stage
+	Retries []RetryStats `json:"retries,omitempty"`
+	// Errors - errors counted by severity, operations and kind
+	Errors []ErrorStats `json:"errors,omitempty"`
+}
+
+type MemStats struct {
+	Alloc      uint64 `json:"alloc"`
+	TotalAlloc uint64 `json:"total_alloc"`
+	Sys        uint64 `json:"sys"`
+	Mallocs    uint64 `json:"mallocs"`
+	Frees      uint64 `json:"frees"`
+	GCSys      uint64 `json:"gc_sys"`
+	NumGC      uint32 `json:"num_gc"`
+}
+
+// CountStats - number of registered items: total (including repeats) / unique and size of unique items (if applicable)
+type CountStats struct {
+	Total  int   `json:"total"`
+	Unique int   `json:"unique"`
+	Bytes  int64 `json:"bytes,omitempty"`
+	Rate   Rate  `json:"rate"`
+}
+
+// Rate - throughput of unique items (and their bytes)
+type Rate struct {
+	FilesPerSec float64 `json:"files_per_sec"`
+	BytesPerSec float64 `json:"bytes_per_sec,omitempty"`
+}
+
+// SizeBin - number of files with size in range [From, To)
+type SizeBin struct {
+	Count float64 `json:"count"`
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+}
+
+type StageStats struct {
+	Stage int `json:"stage"`
+	// Name - stage type and settings as configured (e.g. "head xxh64;4096")
+	Name   string `json:"name"`
+	Groups int    `json:"groups"`
+	Inodes int    `json:"inodes"`
+	Read   int64  `json:"read"`
+	// Rate - hashed inodes (files) and read bytes per second
+	Rate Rate `json:"rate"`
+	// Workers - current max number of workers (may be adjusted by tuner)
+	Workers int `json:"workers"`
+	// Bypassed - files passed by without hashing as prefilter doesn't pay off for them (see filtering.Tuner)
+	Bypassed int64 `json:"bypassed,omitempty"`
+	// Skipped - files passed by without hashing as stage doesn't apply to them (smaller than its min size)
+	Skipped int64 `json:"skipped,omitempty"`
+}
+
+// ContentStats - progress of content filter
+type ContentStats struct {
+	// Inodes, Bytes - candidates (inodes of meta groups with more than one inode) passed to content filter
+	Inodes int   `json:"inodes"`
+	Bytes  int64 `json:"bytes"`
+	// Queued - bytes of candidates not hashed by final stage yet;
+	// it is upper bound as candidates dropped by prefilters are not read by final stage
+	Queued int64 `json:"queued"`
+	// ETA - estimated time to hash queued bytes at current final stage rate (0 - unknown or completed)
+	ETA time.Duration `json:"eta,omitempty"`
+}
+
+type DupsStats struct {
+	Groups int   `json:"groups"`
+	Inodes int   `json:"inodes"`
+	Unique int64 `json:"unique"`
+	Total  int64 `json:"total"`
+	// Wasted - bytes that can be freed
+	Wasted int64     `json:"wasted"`
+	Sizes  []SizeBin `json:"sizes,omitempty"`
+}
+
+type StageConcurrency struct {
+	Stage string `json:"stage"`
+	workflow.Concurrency
+}
+
+// stagesOrder - order of pipeline stages (as they are named by workflow.ConcurrencyReporter)
+var stagesOrder = map[string]int{"search": 1, "validation": 2, "truncation": 3, "metafilter": 4, "hashing": 5, "chunking": 6}
+
+// DeviceStats - queue of hashing reads of device (see filtering.DeviceScheduler):
+// Running / Waiting files at the moment, Limit of running ones and Reads granted so far
+type DeviceStats struct {
+	Device     string `json:"device"`
+	Rotational bool   `json:"rotational"`
+	Limit      int    `json:"limit"`
+	Running    int    `json:"running"`
+	Waiting    int    `json:"waiting"`
+	Reads      int64  `json:"reads"`
+}
+
+// HashingFileStats - progress of large file being hashed (see filestat.HashTracker)
+type HashingFileStats struct {
+	Path    string  `json:"path"`
+	Size    int64   `json:"size"`
+	Read    int64   `json:"read"`
+	Percent float64 `json:"percent"`
+}
+
+// ThrottleStats - limits of hashing reads (bytes/s) and opens (files/s), 0 = unlimited,
+// and total time hashers have been held back by them (see filestat.Throttle)
+type ThrottleStats struct {
+	ReadRate int64         `json:"read_rate"`
+	OpenRate int64         `json:"open_rate"`
+	Waited   time.Duration `json:"waited"`
+}
+
+// IsLimited - whether any limit is set
+func (ts *ThrottleStats) IsLimited() bool {
+	return ts != nil && (ts.ReadRate > 0 || ts.OpenRate > 0)
+}
+
+// VerificationStats - groups verified byte by byte (see filtering.VerificationStats): Groups to verify, Verified so far,
+// Split - groups split on hash collisions, Modified - files excluded from groups as they were modified meanwhile
+type VerificationStats struct {
+	Groups   int64 `json:"groups"`
+	Verified int64 `json:"verified"`
+	Split    int64 `json:"split"`
+	Modified int64 `json:"modified"`
+}
+
+// TruncationStats - truncated copies detection (see filtering.TruncationStats): Files (inodes) registered, Hashed by head,
+// Groups - groups of the same head checksum and different sizes, Compared pairs of files, Skipped (too large) groups
+// and truncated copies Found
+type TruncationStats struct {
+	Files    int64 `json:"files"`
+	Hashed   int64 `json:"hashed"`
+	Groups   int64 `json:"groups"`
+	Compared int64 `json:"compared"`
+	Skipped  int64 `json:"skipped"`
+	Found    int   `json:"found"`
+}
+
+// BlocksStats - block-level dedup estimate (see chunking.BlockDedupStats): chunks of all files (Total)
+// and of files of each root (Roots)
+type BlocksStats struct {
+	Total BlockStats   `json:"total"`
+	Roots []BlockStats `json:"roots"`
+}
+
+// BlockStats - content-defined chunks of files (of Root if set): all Chunks and their Bytes, unique ones and
+// bytes that block-level dedup would save
+type BlockStats struct {
+	Root         string `json:"root,omitempty"`
+	Files        int64  `json:"files"`
+	Chunks       int64  `json:"chunks"`
+	Bytes        int64  `json:"bytes"`
+	UniqueChunks int64  `json:"unique_chunks"`
+	UniqueBytes  int64  `json:"unique_bytes"`
+	Saved        int64  `json:"saved"`
+}
+
+func newBlockStats(root string, bs chunking.BlockStats) BlockStats {
+	return BlockStats{
+		Root:         root,
+		Files:        bs.Files,
+		Chunks:       bs.Chunks,
+		Bytes:        bs.Bytes,
+		UniqueChunks: bs.UniqueChunks,
+		UniqueBytes:  bs.UniqueBytes,
+		Saved:        bs.Saved(),
+	}
+}
+
+// RetryStats - retries made by stage: operations Recovered after retries and Failed after all attempts
+type RetryStats struct {
+	Stage     string `json:"stage"`
+	Retries   int64  `json:"retries"`
+	Recovered int64  `json:"recovered"`
+	Failed    int64  `json:"failed"`
+}
+
+func newRetryStats(stage string, rs *workflow.RetryStats) RetryStats {
+	return RetryStats{Stage: stage, Retries: rs.Retries(), Recovered: rs.Recovered(), Failed: rs.Failed()}
+}
+
+type ErrorStats struct {
+	Severity   string `json:"severity"`
+	Kind       string `json:"kind"`
+	Operations string `json:"operations"`
+	Count      int    `json:"count"`
+}
+
+// CollectStats makes snapshot of statistics of given pipeline stages
+func CollectStats(startTime time.Time, statProducers ...workflow.StatProducer) Stats {
+	st := Stats{
+		Time:    time.Now(),
+		Elapsed: time.Since(startTime),
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	st.Mem = MemStats{
+		Alloc:      ms.Alloc,
+		TotalAlloc: ms.TotalAlloc,
+		Sys:        ms.Sys,
+		Mallocs:    ms.Mallocs,
+		Frees:      ms.Frees,
+		GCSys:      ms.GCSys,
+		NumGC:      ms.NumGC,
+	}
+	truncationCompleted := true
+	for _, statProducer := range statProducers {
+		if cr, ok := statProducer.(workflow.ConcurrencyReporter); ok {
+			stage, concurrency := cr.Concurrency()
+			st.Concurrency = append(st.Concurrency, StageConcurrency{stage, concurrency})
+		}
+		switch s := statProducer.Stats().(type) {
+		case searching.SearcherStats:
+			st.Found = &CountStats{Total: s.TotalCount(), Unique: s.KeysCount()}
+		case *validating.ValidatorStats:
+			uniqueSizes, _ := registrator.GetKeySizes(s.FileStats.GetScores())
+			st.Validated = &CountStats{Total: s.FileStats.TotalCount(), Unique: s.FileStats.KeysCount(), Bytes: uniqueSizes}
+			uniqueSizes, _ = registrator.GetKeySizes(s.InodeStats.GetScores())
+			st.Inodes = &CountStats{Total: s.InodeStats.TotalCount(), Unique: s.InodeStats.KeysCount(), Bytes: uniqueSizes}
+			st.Retries = append(st.Retries, newRetryStats("validation", s.Retries))
+		case errflow.ErrorStats:
+			cps := s.GetCounterPairs()
+			sort.Sort(registrator.CounterPairsByKey(cps))
+			for _, cp := range cps {
+				esk := cp.Key.(errflow.ErrStatKey)
+				st.Errors = append(st.Errors, ErrorStats{
+					Severity:   esk.Severity.String(),
+					Kind:       esk.Kind.String(),
+					Operations: esk.Operations,
+					Count:      cp.Count,
+				})
+			}
+		case *filtering.TruncationStats:
+			truncationCompleted = s.IsCompleted()
+			counters := s.Counters.Snapshot()
+			st.Truncation = &TruncationStats{Files: counters.Files, Hashed: counters.Hashed, Groups: counters.Groups, Compared: counters.Compared, Skipped: counters.Skipped, Found: s.Found()}
+			st.Retries = append(st.Retries, newRetryStats("truncation", s.Retries))
+		case *chunking.BlockDedupStats:
+			st.IsCompleted = s.IsCompleted()
+			st.Blocks = &BlocksStats{Total: newBlockStats("", s.Total())}
+			for _, rs := range s.Roots() {
+				st.Blocks.Roots = append(st.Blocks.Roots, newBlockStats(rs.Root, rs.BlockStats))
+			}
+			st.Retries = append(st.Retries, newRetryStats("chunking", s.Retries))
+		case fs.HashingStats:
+			for _, hf := range s {
+				st.Hashing = append(st.Hashing, HashingFileStats{Path: hf.Path, Size: hf.Size, Read: hf.Read, Percent: float64(hf.Read) * 100 / float64(hf.Size)})
+			}
+		case fs.ThrottleStats:
+			st.Throttle = &ThrottleStats{ReadRate: s.ReadRate, OpenRate: s.OpenRate, Waited: s.Waited}
+		case *filtering.ContentFilterStats:
+			st.IsCompleted = s.IsCompleted()
+			uniqueSizes, _ := registrator.GetKeySizes(s.InputInodeStats.GetScores())
+			st.Content = &ContentStats{Inodes: s.InputInodeStats.KeysCount(), Bytes: uniqueSizes}
+			st.Sizes = SizeBins(s.MetaRegister.GetSizesCounter().GetScores())
+			st.Retries = append(st.Retries, newRetryStats("hashing", s.Retries))
+			for stageNumber, stageInodesStat := range s.StageInodeStats {
+				inodesCount, totalSize := stageInodesStat.GetStats()
+				stage := StageStats{
+					Stage:   stageNumber,
+					Name:    s.StageNames[stageNumber],
+					Skipped: s.Skipped(stageNumber),
+					Groups:  s.StageRegisters[stageNumber].GetKeysCounter().KeysCount(),
+					Inodes:  inodesCount,
+					Read:    totalSize,
+					Workers: s.StageLimiters[stageNumber].Limit(),
+				}
+				if s.Tuner != nil {
+					stage.Bypassed = s.Tuner.Bypassed(stageNumber)
+				}
+				st.Stages = append(st.Stages, stage)
+			}
+			if s.Scheduler != nil {
+				for _, ds := range s.Scheduler.Stats() {
+					st.Devices = append(st.Devices, DeviceStats(ds))
+				}
+			}
+			st.ReadFallbacks = s.ReadFallbacks.Count()
+			if s.Verification != nil {
+				vs := VerificationStats(s.Verification.Snapshot())
+				st.Verification = &vs
+			}
+			keysCounter := s.ContentRegister.GetKeysCounter()
+			scores := keysCounter.GetScores()
+			uniqueSizes, totalSizes := registrator.GetKeySizes(scores)
+			st.Dups = &DupsStats{
+				Groups: keysCounter.KeysCount(),
+				Inodes: keysCounter.TotalCount(),
+				Unique: uniqueSizes,
+				Total:  totalSizes,
+				Wasted: totalSizes - uniqueSizes,
+				Sizes:  SizeBins(scores),
+			}
+		}
+	}
+	st.IsCompleted = st.IsCompleted && truncationCompleted // detection of truncated copies can take longer
+	sort.SliceStable(st.Concurrency, func(i, j int) bool {
+		return stagesOrder[st.Concurrency[i].Stage] < stagesOrder[st.Concurrency[j].Stage]
+	})
+	// rates are averaged since start (see StatsCollector for current rates)
+	st.setRates(Stats{Time: startTime})
+	return st
+}
+
+// setRates calculates rates (and ETA) by difference with previous snapshot
+func (st *Stats) setRates(prev Stats) {
+	seconds := st.Time.Sub(prev.Time).Seconds()
+	if seconds <= 0 {
+		return
+	}
+	rate := func(cur, prev int64) float64 {
+		return float64(cur-prev) / seconds
+	}
+	countRate := func(cur, prev *CountStats) Rate {
+		if prev == nil {
+			prev = &CountStats{}
+		}
+		return Rate{FilesPerSec: rate(int64(cur.Unique), int64(prev.Unique)), BytesPerSec: rate(cur.Bytes, prev.Bytes)}
+	}
+	if st.Found != nil {
+		st.Found.Rate = countRate(st.Found, prev.Found)
+	}
+	if st.Validated != nil {
+		st.Validated.Rate = countRate(st.Validated, prev.Validated)
+	}
+	if st.Inodes != nil {
+		st.Inodes.Rate = countRate(st.Inodes, prev.Inodes)
+	}
+	for i := range st.Stages {
+		var prevStage StageStats
+		if i < len(prev.Stages) {
+			prevStage = prev.Stages[i]
+		}
+		st.Stages[i].Rate = Rate{
+			FilesPerSec: rate(int64(st.Stages[i].Inodes), int64(prevStage.Inodes)),
+			BytesPerSec: rate(st.Stages[i].Read, prevStage.Read),
+		}
+	}
+	if st.Content != nil && len(st.Stages) > 0 {
+		final := st.Stages[len(st.Stages)-1]
+		st.Content.Queued, st.Content.ETA = 0, 0
+		if !st.IsCompleted && st.Content.Bytes > final.Read {
+			st.Content.Queued = st.Content.Bytes - final.Read
+			bytesPerSec := final.Rate.BytesPerSec
+			if bytesPerSec <= 0 && st.Elapsed > 0 { // stalled for now - use average rate
+				bytesPerSec = float64(final.Read) / st.Elapsed.Seconds()
+			}
+			if bytesPerSec > 0 {
+				// rounded up (to 100ms) so that small ETA is not taken as unknown
+				st.Content.ETA = time.Duration(math.Ceil(float64(st.Content.Queued)/bytesPerSec*10)) * 100 * time.Millisecond
+				if st.Content.ETA >= time.Second {
+					st.Content.ETA = st.Content.ETA.Round(time.Second)
+				}
+			}
+		}
+	}
+}
+
+// StatsCollector collects stats snapshots with current rates (calculated between consecutive snapshots)
+type StatsCollector struct {
+	sync.Mutex
+	startTime time.Time
+	prev      *Stats
+}
+
+func NewStatsCollector(startTime time.Time) *StatsCollector {
+	return &StatsCollector{startTime: startTime}
+}
+
+// Collect makes snapshot of statistics of given pipeline stages
+func (c *StatsCollector) Collect(statProducers ...workflow.StatProducer) Stats {
+	st := CollectStats(c.startTime, statProducers...)
+	c.Lock()
+	defer c.Unlock()
+	if c.prev != nil {
+		st.setRates(*c.prev)
+	}
+	prev := st
+	c.prev = &prev
+	return st
+}
+
+// ErrorsCount - total number of errors
+func (st Stats) ErrorsCount() (count int) {
+	for _, es := range st.Errors {
+		count += es.Count
+	}
+	return
+}
+
+// RetriesCount - total number of retries
+func (st Stats) RetriesCount() (count int64) {
+	for _, rs := range st.Retries {
+		count += rs.Retries
+	}
+	return
+}
+
+// SizeBins splits sizes (given as map size -> count) by quantiles (0.25, 0.5, 0.75) and counts files in each range;
+// empty ranges are omitted
+func SizeBins(sizesScore map[interface{}]int) []SizeBin {
+	numSizes := len(sizesScore)
+	if numSizes == 0 {
+		return nil
+	}
+	type sizeCount struct{ size, count float64 }
+	scs := make([]sizeCount, 0, numSizes)
+	for size, count := range sizesScore {
+		if ks, ok := size.(registrator.KeySize); ok {
+			size = ks.Size
+		}
+		scs = append(scs, sizeCount{float64(size.(int64)), float64(count)})
+	}
+	// sizes and their counts must be sorted together (weights have to stay with their values)
+	sort.Slice(scs, func(i, j int) bool { return scs[i].size < scs[j].size })
+	sizes, counts := make([]float64, numSizes), make([]float64, numSizes)
+	for i, sc := range scs {
+		sizes[i], counts[i] = sc.size, sc.count
+	}
+	dividers := []float64{
+		sizes[0],
+		stat.Quantile(0.25, stat.Empirical, sizes, counts),
+		stat.Quantile(0.5, stat.Empirical, sizes, counts),
+		stat.Quantile(0.75, stat.Empirical, sizes, counts),
+		sizes[numSizes-1] + 1,
+	}
+	hist := stat.Histogram(nil, dividers, sizes, counts)
+	bins := make([]SizeBin, 0, len(hist))
+	for i := 0; i < len(hist); i++ {
+		if hist[i] > 0 {
+			bins = append(bins, SizeBin{Count: hist[i], From: dividers[i], To: dividers[i+1]})
+		}
+	}
+	return bins
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nj-eka/fdups/output"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 1000
+)
+
+// StatusResponse - response of /api/status
+type StatusResponse struct {
+	State   State         `json:"state"`
+	Roots   []string      `json:"roots"`
+	Updated time.Time     `json:"updated"`
+	Stats   *output.Stats `json:"stats,omitempty"`
+}
+
+// GroupsResponse - response of /api/groups
+type GroupsResponse struct {
+	State State `json:"state"`
+	// Total - number of groups matched filter
+	Total int `json:"total"`
+	// Wasted - bytes that can be freed in all groups matched filter
+	Wasted int64       `json:"wasted"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+	Groups []GroupView `json:"groups"`
+}
+
+// GroupView - group of duplicates as it is served
+type GroupView struct {
+	Key    string     `json:"key"`
+	Size   int64      `json:"size"`
+	Inodes int        `json:"inodes"`
+	Wasted int64      `json:"wasted"`
+	Files  []FileView `json:"files"`
+}
+
+// FileView - file of group as it is served
+type FileView struct {
+	output.ReportFile
+	// Matched - file matches filter (root / prefix)
+	Matched bool `json:"matched"`
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.RLock()
+	resp := StatusResponse{
+		State:   s.state,
+		Roots:   s.roots,
+		Updated: s.updated,
+		Stats:   s.stats,
+	}
+	s.RUnlock()
+	writeJSON(w, resp)
+}
+
+// groupsFilter - files filter by root and path prefix (group matches if any of its files matches)
+type groupsFilter struct {
+	root, prefix string
+}
+
+func (f groupsFilter) match(path string) bool {
+	if f.root != "" && path != f.root && !strings.HasPrefix(path, strings.TrimSuffix(f.root, string(filepath.Separator))+string(filepath.Separator)) {
+		return false
+	}
+	return strings.HasPrefix(path, f.prefix)
+}
+
+func (s *Server) handleGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	filter := groupsFilter{root: query.Get("root"), prefix: query.Get("prefix")}
+	offset, err := intParam(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		http.Error(w, fmt.Sprintf("invalid offset [%s]", query.Get("offset")), http.StatusBadRequest)
+		return
+	}
+	limit, err := intParam(query.Get("limit"), DefaultPageSize)
+	if err != nil || limit <= 0 || limit > MaxPageSize {
+		http.Error(w, fmt.Sprintf("invalid limit [%s]: expected 1..%d", query.Get("limit"), MaxPageSize), http.StatusBadRequest)
+		return
+	}
+	var less func(a, b GroupView) bool
+	switch query.Get("sort") {
+	case "", "wasted":
+		less = func(a, b GroupView) bool { return a.Wasted > b.Wasted }
+	case "size":
+		less = func(a, b GroupView) bool { return a.Size > b.Size }
+	case "files":
+		less = func(a, b GroupView) bool { return len(a.Files) > len(b.Files) }
+	default:
+		http.Error(w, fmt.Sprintf("invalid sort [%s]: expected wasted, size or files", query.Get("sort")), http.StatusBadRequest)
+		return
+	}
+
+	resp := GroupsResponse{Offset: offset, Limit: limit}
+	var views []GroupView
+	s.RLock()
+	resp.State = s.state
+	for _, g := range s.groups {
+		view := GroupView{Key: g.Key, Size: g.Size(), Inodes: len(g.inodes), Wasted: g.Wasted(), Files: make([]FileView, len(g.Files))}
+		matched := false
+		for i, rf := range g.Files {
+			view.Files[i] = FileView{ReportFile: rf, Matched: filter.match(rf.Path)}
+			matched = matched || view.Files[i].Matched
+		}
+		if matched {
+			views = append(views, view)
+			resp.Wasted += view.Wasted
+		}
+	}
+	s.RUnlock()
+
+	sort.SliceStable(views, func(i, j int) bool { return less(views[i], views[j]) })
+	resp.Total = len(views)
+	if offset > len(views) {
+		offset = len(views)
+	}
+	end := offset + limit
+	if end > len(views) {
+		end = len(views)
+	}
+	resp.Groups = views[offset:end]
+	if resp.Groups == nil {
+		resp.Groups = []GroupView{}
+	}
+	writeJSON(w, resp)
+}
+
+func intParam(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
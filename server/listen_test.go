@@ -0,0 +1,30 @@
+package server
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnixSocket(t *testing.T) {
+	addr := UnixSocketPrefix + filepath.Join(t.TempDir(), "fdups.sock")
+	ln, err := Listen(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen(addr); err == nil {
+		t.Fatal("socket of running instance must not be taken over")
+	}
+	conn, err := net.Dial("unix", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("socket of running instance is removed: %v", err)
+	}
+	_ = conn.Close()
+	// socket file is left by stopped instance
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = ln.Close()
+	if ln, err = Listen(addr); err != nil {
+		t.Fatalf("stale socket must be replaced: %v", err)
+	}
+	_ = ln.Close()
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"bytes"
+	"github.com/nj-eka/fdups/output"
+	"net/http"
+)
+
+const (
+	MetricsPath        = "/metrics"
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// MetricsHandler returns http handler of latest processing stats in Prometheus text exposition format
+func (s *Server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.RLock()
+		var stats output.Stats
+		if s.stats != nil {
+			stats = *s.stats
+		}
+		s.RUnlock()
+		var buf bytes.Buffer
+		if err := output.WriteMetrics(&buf, stats); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", metricsContentType)
+		_, _ = w.Write(buf.Bytes())
+	})
+}
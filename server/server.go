@@ -0,0 +1,252 @@
+// Package server implements local web UI and JSON API for browsing found duplicates
+// (live while scanning or loaded from saved results)
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nj-eka/fdups/output"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultListenAddr - web UI is available only on localhost by default
+	DefaultListenAddr = "127.0.0.1:8020"
+	// UnixSocketPrefix - prefix of listen address to serve on unix socket (unix:/path/to/socket)
+	UnixSocketPrefix = "unix:"
+
+	shutdownTimeout = 5 * time.Second
+	// dialTimeout - timeout of checking whether unix socket is in use
+	dialTimeout = time.Second
+)
+
+// State - state of results served
+type State string
+
+const (
+	StateScanning    State = "scanning"    // scanning is in progress, results are partial
+	StateCompleted   State = "completed"   // scanning is completed
+	StateInterrupted State = "interrupted" // scanning is interrupted, results are partial
+	StateLoaded      State = "loaded"      // results are loaded from saved files
+)
+
+// Server keeps results (and processing stats) and serves them over http
+type Server struct {
+	sync.RWMutex
+	roots  []string
+	state  State
+	stats  *output.Stats
+	groups []*group
+	// index of groups by key (to add files of live groups)
+	index   map[string]*group
+	updated time.Time
+	// throttler - limits of hashing controlled by ThrottleHandler (nil if not scanning)
+	throttler Throttler
+}
+
+type group struct {
+	output.ReportGroup
+	inodes map[uint64]struct{}
+}
+
+func (g *group) addFiles(files ...output.ReportFile) {
+	for _, rf := range files {
+		g.Files = append(g.Files, rf)
+		if rf.Target == "" {
+			g.inodes[rf.Inode] = struct{}{}
+		}
+	}
+}
+
+// Size - content size of one file in group
+func (g *group) Size() int64 {
+	if len(g.Files) == 0 {
+		return 0
+	}
+	return g.Files[0].Size
+}
+
+// Wasted - bytes that can be freed by keeping only one inode of group (symlinks don't occupy content space)
+func (g *group) Wasted() int64 {
+	if len(g.inodes) < 2 {
+		return 0
+	}
+	return g.Size() * int64(len(g.inodes)-1)
+}
+
+// New makes server of results found in roots
+func New(roots []string, state State) *Server {
+	return &Server{
+		roots:   roots,
+		state:   state,
+		index:   make(map[string]*group),
+		updated: time.Now(),
+	}
+}
+
+// SetState sets state of results served
+func (s *Server) SetState(state State) {
+	s.Lock()
+	defer s.Unlock()
+	s.state, s.updated = state, time.Now()
+}
+
+// SetStats sets latest processing stats
+func (s *Server) SetStats(stats output.Stats) {
+	s.Lock()
+	defer s.Unlock()
+	s.stats, s.updated = &stats, time.Now()
+}
+
+// SetGroups replaces all groups served (e.g. by final results)
+func (s *Server) SetGroups(reportGroups []output.ReportGroup) {
+	s.Lock()
+	defer s.Unlock()
+	s.groups = make([]*group, 0, len(reportGroups))
+	s.index = make(map[string]*group, len(reportGroups))
+	for _, rg := range reportGroups {
+		g := s.getOrAddGroup(rg.Key)
+		g.addFiles(rg.Files...)
+	}
+	s.updated = time.Now()
+}
+
+// AddFiles adds files to group with given key (group is created if it doesn't exist yet) -
+// used to show groups as soon as they are confirmed while scanning
+func (s *Server) AddFiles(key string, files ...output.ReportFile) {
+	s.Lock()
+	defer s.Unlock()
+	s.getOrAddGroup(key).addFiles(files...)
+	s.updated = time.Now()
+}
+
+// ReplaceFiles replaces files of group with given key (group is created if it doesn't exist yet) -
+// used when group is split by verification while scanning
+func (s *Server) ReplaceFiles(key string, files ...output.ReportFile) {
+	s.Lock()
+	defer s.Unlock()
+	g := s.getOrAddGroup(key)
+	g.Files, g.inodes = nil, make(map[uint64]struct{})
+	g.addFiles(files...)
+	s.updated = time.Now()
+}
+
+// RemoveGroup removes group with given key (if any) - used when group is dropped by verification while scanning
+func (s *Server) RemoveGroup(key string) {
+	s.Lock()
+	defer s.Unlock()
+	g, ok := s.index[key]
+	if !ok {
+		return
+	}
+	delete(s.index, key)
+	for i := range s.groups {
+		if s.groups[i] == g {
+			s.groups = append(s.groups[:i], s.groups[i+1:]...)
+			break
+		}
+	}
+	s.updated = time.Now()
+}
+
+func (s *Server) getOrAddGroup(key string) *group {
+	g, ok := s.index[key]
+	if !ok {
+		g = &group{ReportGroup: output.ReportGroup{Key: key}, inodes: make(map[uint64]struct{})}
+		s.index[key] = g
+		s.groups = append(s.groups, g)
+	}
+	return g
+}
+
+// Handler returns http handler of web UI and JSON API:
+//
+//	GET /             - web UI
+//	GET /api/status   - state, roots and latest processing stats (see output.Stats)
+//	GET /api/groups   - groups of duplicates: ?root=&prefix=&sort=wasted|size|files&offset=&limit=
+//	GET /metrics      - latest processing stats in Prometheus text format (see MetricsHandler)
+//	GET|POST /api/throttle - limits of hashing reads / opens (see ThrottleHandler)
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(staticFS)))
+	mux.HandleFunc("/api/status", s.handleStatus)
+	mux.HandleFunc("/api/groups", s.handleGroups)
+	mux.Handle(MetricsPath, s.MetricsHandler())
+	mux.Handle(ThrottlePath, s.ThrottleHandler())
+	return mux
+}
+
+// Listen listens on tcp address (host:port) or unix socket (unix:/path/to/socket);
+// stale unix socket file (nobody listens on it) is removed before listening, socket of running instance is left intact
+func Listen(addr string) (net.Listener, error) {
+	if addr == "" {
+		addr = DefaultListenAddr
+	}
+	if strings.HasPrefix(addr, UnixSocketPrefix) {
+		path := strings.TrimPrefix(addr, UnixSocketPrefix)
+		if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			conn, err := net.DialTimeout("unix", path, dialTimeout)
+			if err == nil {
+				_ = conn.Close()
+				return nil, fmt.Errorf("unix socket [%s] is in use by another process", path)
+			}
+			if !errors.Is(err, syscall.ECONNREFUSED) {
+				return nil, fmt.Errorf("checking unix socket [%s] failed: %w", path, err)
+			}
+			if err = os.Remove(path); err != nil {
+				return nil, fmt.Errorf("removing stale socket [%s] failed: %w", path, err)
+			}
+		}
+		ln, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("listening on unix socket [%s] failed: %w", path, err)
+		}
+		return ln, nil
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listening on [%s] failed: %w", addr, err)
+	}
+	return ln, nil
+}
+
+// URL returns address of http server on ln
+func URL(ln net.Listener) string {
+	if ln.Addr().Network() == "unix" {
+		return UnixSocketPrefix + ln.Addr().String()
+	}
+	return "http://" + ln.Addr().String()
+}
+
+// Serve serves web UI on ln until ctx is done
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	return ServeHandler(ctx, ln, s.Handler())
+}
+
+// ServeHandler serves handler on ln until ctx is done
+func ServeHandler(ctx context.Context, ln net.Listener, handler http.Handler) error {
+	httpServer := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+	if err := httpServer.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving on [%s] failed: %w", ln.Addr(), err)
+	}
+	<-shutdownDone
+	return nil
+}
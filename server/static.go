@@ -0,0 +1,12 @@
+package server
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed static
+var staticFiles embed.FS
+
+// staticFS - web UI files (index.html, app.js, style.css)
+var staticFS, _ = fs.Sub(staticFiles, "static")
@@ -0,0 +1,182 @@
+"use strict";
+
+const refreshRate = 3000;
+const state = {offset: 0, limit: 50, expanded: new Set(), status: null};
+
+const $ = (id) => document.getElementById(id);
+
+function bytes(n) {
+  const units = ["B", "KiB", "MiB", "GiB", "TiB", "PiB"];
+  let i = 0;
+  while (n >= 1024 && i < units.length - 1) {
+    n /= 1024;
+    i++;
+  }
+  return (i === 0 ? n : n.toFixed(1)) + " " + units[i];
+}
+
+function duration(ns) {
+  let s = Math.ceil(ns / 1e9);
+  const h = Math.floor(s / 3600), m = Math.floor(s % 3600 / 60);
+  s = s % 60;
+  return (h ? h + "h" : "") + (h || m ? m + "m" : "") + s + "s";
+}
+
+function el(tag, attrs, ...children) {
+  const e = document.createElement(tag);
+  Object.entries(attrs || {}).forEach(([k, v]) => e.setAttribute(k, v));
+  children.forEach((c) => e.append(c));
+  return e;
+}
+
+function stat(title, value, cls) {
+  return el("div", cls ? {class: cls} : null, title, el("b", null, value));
+}
+
+async function getJSON(url) {
+  const resp = await fetch(url);
+  if (!resp.ok) {
+    throw new Error(url + ": " + resp.status + " " + (await resp.text()));
+  }
+  return resp.json();
+}
+
+function renderStatus(status) {
+  $("state").textContent = status.state;
+  $("state").className = "state " + status.state;
+  const roots = $("root");
+  if (roots.options.length === 1) {
+    status.roots.forEach((root) => roots.append(el("option", {value: root}, root)));
+  }
+  const st = status.stats;
+  const stats = $("stats");
+  stats.replaceChildren();
+  if (!st) {
+    return;
+  }
+  $("elapsed").textContent = "elapsed " + duration(st.elapsed);
+  if (st.found) {
+    stats.append(stat("found/unique", st.found.total + "/" + st.found.unique));
+  }
+  if (st.validated) {
+    stats.append(stat("validated", st.validated.unique + " (" + bytes(st.validated.bytes) + ")"));
+  }
+  if (st.inodes) {
+    stats.append(stat("inodes", st.inodes.unique + " (" + bytes(st.inodes.bytes) + ")"));
+  }
+  (st.stages || []).forEach((s) => stats.append(
+    stat("hash filter [" + s.stage + "] " + (s.name || ""), s.groups + " groups / " + s.inodes + " inodes / " + bytes(s.read) + " read" +
+      " @ " + bytes(s.rate.bytes_per_sec || 0) + "/s" + (s.skipped ? " / " + s.skipped + " skipped" : ""))));
+  if (st.content) {
+    stats.append(stat("queued", bytes(st.content.queued) + " of " + bytes(st.content.bytes) +
+      (st.is_completed ? "" : ", ETA " + (st.content.eta ? duration(st.content.eta) : "unknown"))));
+  }
+  for (const f of st.hashing || []) {
+    stats.append(stat("hashing", f.percent.toFixed(1) + "% of " + bytes(f.size) + " " + f.path));
+  }
+  if (st.dups) {
+    stats.append(stat("duplicates", st.dups.groups + " groups / " + st.dups.inodes + " inodes"));
+    stats.append(stat("can be freed", bytes(st.dups.wasted)));
+  }
+  if (st.verification) {
+    const v = st.verification;
+    stats.append(stat("verified", v.verified + " of " + v.groups + " groups / " + v.split + " split / " + v.modified + " modified", v.split || v.modified ? "errors" : ""));
+  }
+  if (st.truncation) {
+    const t = st.truncation;
+    stats.append(stat("truncated copies", t.found + " found / " + t.compared + " compared / " + t.hashed + " of " + t.files + " inodes hashed"));
+  }
+  if (st.concurrency) {
+    stats.append(stat("workers/buffer", st.concurrency.map((c) => c.stage + " " + c.workers + "/" + c.buffer).join(", ")));
+  }
+  if (st.devices) {
+    stats.append(stat("devices", st.devices.map((d) => d.device + (d.rotational ? " (hdd)" : "") + " " + d.running + "/" + d.limit + " +" + d.waiting).join(", ")));
+  }
+  const retries = (st.retries || []).reduce((sum, r) => sum + r.retries, 0);
+  if (retries) {
+    stats.append(stat("retries", String(retries)));
+  }
+  const errors = (st.errors || []).reduce((sum, e) => sum + e.count, 0);
+  stats.append(stat("errors", String(errors), errors ? "errors" : ""));
+}
+
+function renderGroups(resp) {
+  const tbody = $("groups").querySelector("tbody");
+  tbody.replaceChildren();
+  resp.groups.forEach((g) => {
+    const expanded = state.expanded.has(g.key);
+    const row = el("tr", {class: "group"},
+      el("td", null, expanded ? "▾" : "▸"),
+      el("td", null, g.key),
+      el("td", {class: "num"}, bytes(g.size)),
+      el("td", {class: "num"}, String(g.files.length)),
+      el("td", {class: "num"}, String(g.inodes)),
+      el("td", {class: "num"}, bytes(g.wasted)));
+    row.addEventListener("click", () => {
+      expanded ? state.expanded.delete(g.key) : state.expanded.add(g.key);
+      loadGroups();
+    });
+    tbody.append(row);
+    if (expanded) {
+      g.files.forEach((f) => tbody.append(el("tr", {class: "file" + (f.matched ? " matched" : "")},
+        el("td"),
+        el("td", {class: "path"}, f.path + (f.target ? " -> " + f.target : "")),
+        el("td", {class: "num"}, f.perm),
+        el("td", {class: "num"}, f.owner),
+        el("td", {class: "num"}, String(f.inode) + "(" + f.nlink + ")"),
+        el("td", {class: "num"}, f.mod_time))));
+    }
+  });
+  $("summary").textContent = resp.total + " group(s), " + bytes(resp.wasted) + " can be freed";
+  const pages = Math.max(1, Math.ceil(resp.total / resp.limit));
+  $("page").textContent = "page " + (Math.floor(resp.offset / resp.limit) + 1) + " of " + pages;
+  $("prev").disabled = resp.offset === 0;
+  $("next").disabled = resp.offset + resp.limit >= resp.total;
+}
+
+async function loadStatus() {
+  state.status = await getJSON("api/status");
+  renderStatus(state.status);
+}
+
+async function loadGroups() {
+  const params = new URLSearchParams({
+    root: $("root").value,
+    prefix: $("prefix").value,
+    sort: $("sort").value,
+    offset: state.offset,
+    limit: state.limit,
+  });
+  renderGroups(await getJSON("api/groups?" + params));
+}
+
+async function refresh() {
+  try {
+    await loadStatus();
+    await loadGroups();
+  } catch (e) {
+    $("summary").textContent = e.message;
+  }
+  if (!state.status || state.status.state === "scanning") {
+    setTimeout(refresh, refreshRate);
+  }
+}
+
+["root", "sort"].forEach((id) => $(id).addEventListener("change", () => {
+  state.offset = 0;
+  loadGroups();
+}));
+$("prefix").addEventListener("input", () => {
+  state.offset = 0;
+  loadGroups();
+});
+$("prev").addEventListener("click", () => {
+  state.offset = Math.max(0, state.offset - state.limit);
+  loadGroups();
+});
+$("next").addEventListener("click", () => {
+  state.offset += state.limit;
+  loadGroups();
+});
+
+refresh();
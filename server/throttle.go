@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+)
+
+const ThrottlePath = "/api/throttle"
+
+// Throttler - limits of hashing reads (bytes/s) and opens (files/s) changeable while scanning (see filestat.Throttle)
+type Throttler interface {
+	Limits() (readRate, openRate int64)
+	SetLimits(readRate, openRate int64)
+}
+
+// ThrottleResponse - response of /api/throttle (0 = unlimited)
+type ThrottleResponse struct {
+	ReadRate int64 `json:"read_rate"`
+	OpenRate int64 `json:"open_rate"`
+}
+
+// ThrottleRequest - JSON body of POST /api/throttle: limits to set (bytes/s, files/s; 0 = unlimited), omitted ones are kept
+type ThrottleRequest struct {
+	ReadRate *int64 `json:"read_rate"`
+	OpenRate *int64 `json:"open_rate"`
+}
+
+// maxThrottleRequestSize - max size of body of POST /api/throttle
+const maxThrottleRequestSize = 4096
+
+// SetThrottler sets limits controlled by ThrottleHandler
+func (s *Server) SetThrottler(throttler Throttler) {
+	s.Lock()
+	defer s.Unlock()
+	s.throttler = throttler
+}
+
+// ThrottleHandler returns http handler of hashing limits:
+//
+//	GET  /api/throttle                                        - current limits
+//	POST /api/throttle {"read_rate": N, "open_rate": N}       - sets given limits, others are kept
+//
+// Limits are changed only by JSON request (Content-Type: application/json) without foreign Origin,
+// so that they can't be changed by cross-site requests of browser (plain form posts don't pass, others need CORS preflight).
+func (s *Server) ThrottleHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.RLock()
+		throttler := s.throttler
+		s.RUnlock()
+		if throttler == nil {
+			http.Error(w, "throttle is not available", http.StatusNotFound)
+			return
+		}
+		readRate, openRate := throttler.Limits()
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost, http.MethodPut:
+			if !sameOrigin(r) {
+				http.Error(w, fmt.Sprintf("cross-origin request from [%s] is forbidden", r.Header.Get("Origin")), http.StatusForbidden)
+				return
+			}
+			if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+				http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+				return
+			}
+			var req ThrottleRequest
+			decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxThrottleRequestSize))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&req); err != nil {
+				http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+				return
+			}
+			if req.ReadRate != nil {
+				if *req.ReadRate < 0 {
+					http.Error(w, fmt.Sprintf("invalid read rate [%d]: expected bytes/s (0 = unlimited)", *req.ReadRate), http.StatusBadRequest)
+					return
+				}
+				readRate = *req.ReadRate
+			}
+			if req.OpenRate != nil {
+				if *req.OpenRate < 0 {
+					http.Error(w, fmt.Sprintf("invalid open rate [%d]: expected files/s (0 = unlimited)", *req.OpenRate), http.StatusBadRequest)
+					return
+				}
+				openRate = *req.OpenRate
+			}
+			throttler.SetLimits(readRate, openRate)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, ThrottleResponse{ReadRate: readRate, OpenRate: openRate})
+	})
+}
+
+// sameOrigin - request has no Origin (e.g. it's not sent by browser) or Origin host is host request is sent to
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && u.Host == r.Host
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testThrottler struct {
+	readRate, openRate int64
+}
+
+func (t *testThrottler) Limits() (int64, int64) { return t.readRate, t.openRate }
+
+func (t *testThrottler) SetLimits(readRate, openRate int64) {
+	t.readRate, t.openRate = readRate, openRate
+}
+
+func TestThrottleHandler(t *testing.T) {
+	throttler := &testThrottler{readRate: 100, openRate: 10}
+	s := New(nil, StateScanning)
+	s.SetThrottler(throttler)
+	handler := s.ThrottleHandler()
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		origin      string
+		body        string
+		status      int
+		expected    ThrottleResponse
+	}{
+		{name: "form post", contentType: "application/x-www-form-urlencoded", body: "read_rate=0", status: http.StatusUnsupportedMediaType},
+		{name: "plain text post", contentType: "text/plain", body: `{"read_rate":0}`, status: http.StatusUnsupportedMediaType},
+		{name: "foreign origin", contentType: "application/json", origin: "http://evil.example", body: `{"read_rate":0}`, status: http.StatusForbidden},
+		{name: "null origin", contentType: "application/json", origin: "null", body: `{"read_rate":0}`, status: http.StatusForbidden},
+		{name: "negative rate", contentType: "application/json", body: `{"open_rate":-1}`, status: http.StatusBadRequest},
+		{name: "unknown field", contentType: "application/json", body: `{"read":0}`, status: http.StatusBadRequest},
+		{name: "same origin", contentType: "application/json; charset=utf-8", origin: "http://fdups", body: `{"read_rate":0}`, status: http.StatusOK, expected: ThrottleResponse{ReadRate: 0, OpenRate: 10}},
+		{name: "no origin", contentType: "application/json", body: `{"open_rate":200}`, status: http.StatusOK, expected: ThrottleResponse{ReadRate: 0, OpenRate: 200}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "http://fdups"+ThrottlePath+"?read=1", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			before := *throttler
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tc.status {
+				t.Fatalf("expected status %d, got %d: %s", tc.status, rec.Code, rec.Body.String())
+			}
+			if tc.status != http.StatusOK {
+				if *throttler != before {
+					t.Fatalf("limits are changed by rejected request: %+v", *throttler)
+				}
+				return
+			}
+			var resp ThrottleResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp != tc.expected || throttler.readRate != tc.expected.ReadRate || throttler.openRate != tc.expected.OpenRate {
+				t.Fatalf("expected limits %+v, got %+v (throttler %+v)", tc.expected, resp, *throttler)
+			}
+		})
+	}
+}
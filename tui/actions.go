@@ -0,0 +1,331 @@
+package tui
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	fs "github.com/nj-eka/fdups/filestat"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// compareChunkSize - size of chunk read from each file at once when marked file is compared with kept one
+const compareChunkSize = 64 * 1024
+
+// ActionsReport - summary of marks applied (or exported)
+type ActionsReport struct {
+	Deleted, Linked int
+	FreedBytes      int64
+	Errs            []error
+}
+
+// CountActions counts files marked to delete / link
+func CountActions(groups []*Group) (toDelete, toLink int) {
+	for _, group := range groups {
+		for _, f := range group.Files {
+			switch f.Mark {
+			case MarkDelete:
+				toDelete++
+			case MarkLink:
+				toLink++
+			}
+		}
+	}
+	return
+}
+
+// checkKept checks that group has regular file to keep, it's still in place (as it was found)
+// and marks of other files don't remove it (so the last regular inode of group remains)
+func checkKept(group *Group) (*File, error) {
+	kept := group.Kept()
+	if kept == nil {
+		return nil, fmt.Errorf("group %s: no file marked to keep - skipped", group.Key)
+	}
+	fi, err := os.Lstat(kept.Path)
+	if err != nil {
+		return nil, fmt.Errorf("group %s: kept file is not available - skipped: %w", group.Key, err)
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("group %s: kept file [%s] is not regular file (%s) - skipped", group.Key, kept.Path, fi.Mode().Type())
+	}
+	if err = checkUnchanged(kept, fi); err != nil {
+		return nil, fmt.Errorf("group %s: kept %w - skipped", group.Key, err)
+	}
+	if err = checkMarks(group, kept); err != nil {
+		return nil, err
+	}
+	return kept, nil
+}
+
+// checkUnchanged checks that inode, size and modification time of regular file are the same as they were found
+func checkUnchanged(f *File, fi os.FileInfo) error {
+	if inode, ok := fs.InodeOf(fi); ok && f.Inode != 0 && uint64(inode) != f.Inode {
+		return fmt.Errorf("file [%s] inode changed %d -> %d", f.Path, f.Inode, inode)
+	}
+	if fi.Size() != f.Size {
+		return fmt.Errorf("file [%s] size changed %d -> %d", f.Path, f.Size, fi.Size())
+	}
+	if modTime := fi.ModTime().Format(time.RFC1123); f.ModTime != "" && modTime != f.ModTime {
+		return fmt.Errorf("file [%s] modification time changed %s -> %s", f.Path, f.ModTime, modTime)
+	}
+	return nil
+}
+
+// checkMarks checks that marks of group files don't remove kept file and don't leave symlinks of group dangling
+func checkMarks(group *Group, kept *File) error {
+	for _, f := range group.Files {
+		switch f.Mark {
+		case MarkDelete, MarkLink:
+			if !f.IsLink() && samePath(f.Path, kept.Path) {
+				return fmt.Errorf("group %s: kept file [%s] is marked to %s too - skipped", group.Key, kept.Path, actionName(f.Mark))
+			}
+		default:
+			if f.IsLink() && group.isDeleted(f.Target) {
+				return fmt.Errorf("group %s: symlink [%s] would be left dangling as [%s] is marked to delete - mark symlink to link (re-point to kept file) or delete - skipped", group.Key, f.Path, f.Target)
+			}
+		}
+	}
+	return nil
+}
+
+// checkMarked checks that file marked to delete / link is still in place as it was found and,
+// if it is regular file, it is duplicate of kept file: hard link of it (but not the same directory entry
+// reached by another path) or file of the same content (compared byte by byte)
+func checkMarked(kept, f *File) error {
+	fi, err := os.Lstat(f.Path)
+	if err != nil {
+		return fmt.Errorf("file [%s] is not available: %w", f.Path, err)
+	}
+	if f.IsLink() {
+		if fi.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("symlink [%s] is replaced (%s)", f.Path, fi.Mode().Type())
+		}
+		return nil
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("file [%s] is not regular file (%s)", f.Path, fi.Mode().Type())
+	}
+	if err = checkUnchanged(f, fi); err != nil {
+		return err
+	}
+	keptInfo, err := os.Lstat(kept.Path)
+	if err != nil {
+		return fmt.Errorf("kept file [%s] is not available: %w", kept.Path, err)
+	}
+	if os.SameFile(fi, keptInfo) {
+		if nlink, ok := fs.NlinkOf(fi); !ok || nlink < 2 {
+			return fmt.Errorf("file [%s] is kept file [%s] itself", f.Path, kept.Path)
+		}
+		return nil
+	}
+	same, err := sameContent(kept.Path, f.Path)
+	if err != nil {
+		return err
+	}
+	if !same {
+		return fmt.Errorf("file [%s] content differs from kept file [%s]", f.Path, kept.Path)
+	}
+	return nil
+}
+
+// sameContent compares contents of files byte by byte
+func sameContent(path1, path2 string) (bool, error) {
+	file1, err := os.Open(path1)
+	if err != nil {
+		return false, err
+	}
+	defer file1.Close()
+	file2, err := os.Open(path2)
+	if err != nil {
+		return false, err
+	}
+	defer file2.Close()
+	buf1, buf2 := make([]byte, compareChunkSize), make([]byte, compareChunkSize)
+	for {
+		n1, err1 := io.ReadFull(file1, buf1)
+		n2, err2 := io.ReadFull(file2, buf2)
+		if !bytes.Equal(buf1[:n1], buf2[:n2]) {
+			return false, nil
+		}
+		if err1 == io.EOF || err1 == io.ErrUnexpectedEOF {
+			return err2 == io.EOF || err2 == io.ErrUnexpectedEOF, nil
+		}
+		if err1 != nil {
+			return false, fmt.Errorf("reading [%s] failed: %w", path1, err1)
+		}
+		if err2 != nil {
+			if err2 == io.EOF || err2 == io.ErrUnexpectedEOF {
+				return false, nil
+			}
+			return false, fmt.Errorf("reading [%s] failed: %w", path2, err2)
+		}
+	}
+}
+
+func actionName(mark Mark) string {
+	if mark == MarkLink {
+		return "link"
+	}
+	return "delete"
+}
+
+// ApplyMarks deletes files marked to delete and replaces files marked to link with hard links to kept file of group
+// (symlinks marked to link are re-pointed to kept file).
+// Groups without regular file marked to keep (or whose marks would remove it) are skipped;
+// each marked file is checked before it is acted upon (see checkMarked), changed ones are skipped.
+func ApplyMarks(groups []*Group) (report ActionsReport) {
+	for _, group := range groups {
+		toDelete, toLink := CountActions([]*Group{group})
+		if toDelete+toLink == 0 {
+			continue
+		}
+		kept, err := checkKept(group)
+		if err != nil {
+			report.Errs = append(report.Errs, err)
+			continue
+		}
+		for _, f := range group.Files {
+			if f.Mark != MarkDelete && f.Mark != MarkLink {
+				continue
+			}
+			if err := checkMarked(kept, f); err != nil {
+				report.Errs = append(report.Errs, fmt.Errorf("group %s: %w - %s skipped", group.Key, err, actionName(f.Mark)))
+				continue
+			}
+			switch f.Mark {
+			case MarkDelete:
+				if err := os.Remove(f.Path); err != nil {
+					report.Errs = append(report.Errs, fmt.Errorf("deleting [%s] failed: %w", f.Path, err))
+					continue
+				}
+				report.Deleted++
+				if !f.IsLink() && f.Inode != kept.Inode {
+					report.FreedBytes += f.Size
+				}
+				f.Mark = MarkNone
+			case MarkLink:
+				if f.IsLink() {
+					if err := replaceWithSymlink(kept.Path, f.Path); err != nil {
+						report.Errs = append(report.Errs, fmt.Errorf("re-pointing symlink [%s] to [%s] failed: %w", f.Path, kept.Path, err))
+						continue
+					}
+					report.Linked++
+					f.Target, f.Inode, f.Mark = kept.Path, kept.Inode, MarkNone
+					continue
+				}
+				if err := replaceWithLink(kept.Path, f.Path); err != nil {
+					report.Errs = append(report.Errs, fmt.Errorf("linking [%s] to [%s] failed: %w", f.Path, kept.Path, err))
+					continue
+				}
+				report.Linked++
+				if f.Inode != kept.Inode {
+					report.FreedBytes += f.Size
+				}
+				f.Inode, f.Target, f.Mark = kept.Inode, "", MarkKeep
+			}
+		}
+	}
+	return
+}
+
+// replaceWithLink atomically replaces path with hard link to target (they must be on the same device)
+func replaceWithLink(target, path string) error {
+	tmpPath := tmpPathOf(path)
+	if err := os.Link(target, tmpPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// replaceWithSymlink atomically replaces path with symlink to absolute path of target
+func replaceWithSymlink(target, path string) error {
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpPathOf(path)
+	if err := os.Symlink(target, tmpPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+func tmpPathOf(path string) string {
+	return filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.fdups.%d.tmp", filepath.Base(path), time.Now().UnixNano()))
+}
+
+// ExportScript writes marks as shell script (rm / ln commands) to apply them later;
+// marked files are checked as by ApplyMarks and script commands check again that regular files are of kept content (cmp)
+func ExportScript(w io.Writer, groups []*Group) (report ActionsReport, err error) {
+	bw := bufio.NewWriter(w)
+	out := func(format string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(bw, format, args...)
+		}
+	}
+	out("#!/bin/sh\n# generated by fdups at %s\nset -u\n", time.Now().Format(time.RFC1123))
+	for _, group := range groups {
+		toDelete, toLink := CountActions([]*Group{group})
+		if toDelete+toLink == 0 {
+			continue
+		}
+		kept, keptErr := checkKept(group)
+		if keptErr != nil {
+			report.Errs = append(report.Errs, keptErr)
+			continue
+		}
+		keptPath := kept.Path
+		if absPath, err := filepath.Abs(keptPath); err == nil {
+			keptPath = absPath
+		}
+		out("\n# %s\n# keep: %s\n", group.Key, shellQuote(kept.Path))
+		for _, f := range group.Files {
+			if f.Mark != MarkDelete && f.Mark != MarkLink {
+				continue
+			}
+			if err := checkMarked(kept, f); err != nil {
+				report.Errs = append(report.Errs, fmt.Errorf("group %s: %w - %s skipped", group.Key, err, actionName(f.Mark)))
+				continue
+			}
+			// script acts upon regular files only if they are still of the same content as kept file
+			switch {
+			case f.Mark == MarkDelete && f.IsLink():
+				out("[ -L %s ] && rm -f -- %s\n", shellQuote(f.Path), shellQuote(f.Path))
+				report.Deleted++
+			case f.Mark == MarkDelete:
+				out("cmp -s -- %s %s && rm -f -- %s\n", shellQuote(kept.Path), shellQuote(f.Path), shellQuote(f.Path))
+				report.Deleted++
+			case f.Mark == MarkLink && f.IsLink():
+				out("[ -L %s ] && ln -sfn -- %s %s\n", shellQuote(f.Path), shellQuote(keptPath), shellQuote(f.Path))
+				report.Linked++
+			case f.Mark == MarkLink:
+				out("cmp -s -- %s %s && ln -f -- %s %s\n", shellQuote(kept.Path), shellQuote(f.Path), shellQuote(kept.Path), shellQuote(f.Path))
+				report.Linked++
+			default:
+				continue
+			}
+			if !f.IsLink() && f.Inode != kept.Inode {
+				report.FreedBytes += f.Size
+			}
+		}
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	return report, err
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,245 @@
+package tui
+
+import (
+	fs "github.com/nj-eka/fdups/filestat"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testContent = []byte("duplicated content")
+
+func writeTestFile(t *testing.T, path string) {
+	t.Helper()
+	if err := os.WriteFile(path, testContent, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testFile describes file at path as it would be found (symlink is described by its target)
+func testFile(t *testing.T, path string, mark Mark) *File {
+	t.Helper()
+	f := File{Path: path, Size: int64(len(testContent)), Mark: mark}
+	fi, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.ModTime = fi.ModTime().Format(time.RFC1123)
+	if fi.Mode()&os.ModeSymlink != 0 {
+		if f.Target, err = filepath.EvalSymlinks(path); err != nil {
+			t.Fatal(err)
+		}
+		if fi, err = os.Stat(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inode, ok := fs.InodeOf(fi)
+	if !ok {
+		t.Skip("inodes are not supported on this platform")
+	}
+	f.Inode = uint64(inode)
+	return &f
+}
+
+func assertExists(t *testing.T, path string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("file [%s] is lost: %v", path, err)
+	}
+	if string(data) != string(testContent) {
+		t.Fatalf("file [%s] content is changed", path)
+	}
+}
+
+func TestApplyMarksRefusesKeptSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target, link := filepath.Join(dir, "target"), filepath.Join(dir, "link")
+	writeTestFile(t, target)
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	group := &Group{Key: "g", Files: []*File{testFile(t, link, MarkKeep), testFile(t, target, MarkDelete)}}
+	report := ApplyMarks([]*Group{group})
+	if report.Deleted != 0 || len(report.Errs) != 1 {
+		t.Fatalf("group with kept symlink must be skipped: %+v", report)
+	}
+	assertExists(t, target)
+}
+
+func TestApplyMarksRefusesKeptReplacedWithSymlink(t *testing.T) {
+	dir := t.TempDir()
+	kept, other := filepath.Join(dir, "kept"), filepath.Join(dir, "other")
+	writeTestFile(t, kept)
+	writeTestFile(t, other)
+	group := &Group{Key: "g", Files: []*File{testFile(t, kept, MarkKeep), testFile(t, other, MarkLink)}}
+	// kept file is replaced with symlink to other file after it was found
+	if err := os.Remove(kept); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(other, kept); err != nil {
+		t.Fatal(err)
+	}
+	report := ApplyMarks([]*Group{group})
+	if report.Linked != 0 || len(report.Errs) != 1 {
+		t.Fatalf("group with kept file replaced by symlink must be skipped: %+v", report)
+	}
+	assertExists(t, other)
+	if fi, err := os.Lstat(other); err != nil || !fi.Mode().IsRegular() {
+		t.Fatalf("file [%s] must remain regular file", other)
+	}
+}
+
+func TestApplyMarksRefusesRemovingKept(t *testing.T) {
+	dir := t.TempDir()
+	kept := filepath.Join(dir, "kept")
+	writeTestFile(t, kept)
+	alias := testFile(t, dir+"/./kept", MarkDelete)
+	group := &Group{Key: "g", Files: []*File{testFile(t, kept, MarkKeep), alias}}
+	report := ApplyMarks([]*Group{group})
+	if report.Deleted != 0 || len(report.Errs) != 1 {
+		t.Fatalf("group whose marks remove kept file must be skipped: %+v", report)
+	}
+	assertExists(t, kept)
+}
+
+func TestApplyMarksHardLinks(t *testing.T) {
+	dir := t.TempDir()
+	kept, hardLink, copied, link := filepath.Join(dir, "kept"), filepath.Join(dir, "hard"), filepath.Join(dir, "copy"), filepath.Join(dir, "link")
+	writeTestFile(t, kept)
+	if err := os.Link(kept, hardLink); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, copied)
+	if err := os.Symlink(copied, link); err != nil {
+		t.Fatal(err)
+	}
+	group := &Group{Key: "g", Files: []*File{
+		testFile(t, kept, MarkKeep),
+		testFile(t, hardLink, MarkDelete),
+		testFile(t, copied, MarkLink),
+		testFile(t, link, MarkDelete),
+	}}
+	report := ApplyMarks([]*Group{group})
+	if len(report.Errs) != 0 {
+		t.Fatalf("unexpected errors: %v", report.Errs)
+	}
+	if report.Deleted != 2 || report.Linked != 1 {
+		t.Fatalf("expected 2 deleted and 1 linked, got %+v", report)
+	}
+	// only copy occupied its own content space (hard link shares inode of kept file, symlink has no content)
+	if report.FreedBytes != int64(len(testContent)) {
+		t.Fatalf("expected %d freed bytes, got %d", len(testContent), report.FreedBytes)
+	}
+	assertExists(t, kept)
+	assertExists(t, copied)
+	keptInfo, _ := os.Lstat(kept)
+	copiedInfo, _ := os.Lstat(copied)
+	if !os.SameFile(keptInfo, copiedInfo) {
+		t.Fatalf("file [%s] must be replaced with hard link to [%s]", copied, kept)
+	}
+	for _, path := range []string{hardLink, link} {
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Fatalf("file [%s] must be deleted", path)
+		}
+	}
+}
+
+func TestSetKept(t *testing.T) {
+	kept := &File{Path: "a", Inode: 1, Mark: MarkKeep}
+	hardLink := &File{Path: "b", Inode: 1, Mark: MarkKeep}
+	other := &File{Path: "c", Inode: 2, Mark: MarkDelete}
+	symlink := &File{Path: "d", Target: "a", Inode: 1}
+	group := &Group{Files: []*File{kept, hardLink, other, symlink}}
+	if group.SetKept(symlink) {
+		t.Fatal("symlink must not be kept")
+	}
+	if !group.SetKept(other) {
+		t.Fatal("regular file must be kept")
+	}
+	if kept.Mark != MarkNone || hardLink.Mark != MarkNone || other.Mark != MarkKeep || group.Kept() != other {
+		t.Fatalf("previously kept files must be unmarked: %v %v %v", kept.Mark, hardLink.Mark, other.Mark)
+	}
+	if wasted := (&Group{Files: []*File{symlink}}).Wasted(); wasted != 0 {
+		t.Fatalf("group without regular files wastes nothing, got %d", wasted)
+	}
+}
+
+func TestApplyMarksRefusesChangedFile(t *testing.T) {
+	dir := t.TempDir()
+	kept, changed := filepath.Join(dir, "kept"), filepath.Join(dir, "changed")
+	writeTestFile(t, kept)
+	writeTestFile(t, changed)
+	group := &Group{Key: "g", Files: []*File{testFile(t, kept, MarkKeep), testFile(t, changed, MarkDelete)}}
+	// content is changed after file was found (size is the same)
+	if err := os.WriteFile(changed, []byte("DUPLICATED CONTENT"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report := ApplyMarks([]*Group{group})
+	if report.Deleted != 0 || len(report.Errs) != 1 {
+		t.Fatalf("changed file must not be deleted: %+v", report)
+	}
+	if _, err := os.Lstat(changed); err != nil {
+		t.Fatalf("changed file is deleted: %v", err)
+	}
+}
+
+func TestApplyMarksRefusesKeptReachedByOtherPath(t *testing.T) {
+	dir := t.TempDir()
+	realDir, dirLink := filepath.Join(dir, "real"), filepath.Join(dir, "link")
+	if err := os.Mkdir(realDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(realDir, dirLink); err != nil {
+		t.Fatal(err)
+	}
+	kept := filepath.Join(realDir, "kept")
+	writeTestFile(t, kept)
+	group := &Group{Key: "g", Files: []*File{testFile(t, kept, MarkKeep), testFile(t, filepath.Join(dirLink, "kept"), MarkDelete)}}
+	report := ApplyMarks([]*Group{group})
+	if report.Deleted != 0 || len(report.Errs) != 1 {
+		t.Fatalf("kept file reached by other path must not be deleted: %+v", report)
+	}
+	assertExists(t, kept)
+}
+
+func TestDefaultMarksRepointSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	kept, deleted, link := filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "link")
+	writeTestFile(t, kept)
+	writeTestFile(t, deleted)
+	if err := os.Symlink(deleted, link); err != nil {
+		t.Fatal(err)
+	}
+	linkFile := testFile(t, link, MarkNone)
+	group := &Group{Key: "g", Files: []*File{testFile(t, kept, MarkNone), testFile(t, deleted, MarkNone), linkFile}}
+	group.SetDefaultMarks()
+	if linkFile.Mark != MarkLink {
+		t.Fatalf("symlink to deleted file must be marked to link, got %v", linkFile.Mark)
+	}
+	report := ApplyMarks([]*Group{group})
+	if len(report.Errs) != 0 || report.Deleted != 1 || report.Linked != 1 {
+		t.Fatalf("expected 1 deleted and 1 linked, got %+v", report)
+	}
+	assertExists(t, link)
+	if target, err := filepath.EvalSymlinks(link); err != nil || target != kept {
+		t.Fatalf("symlink must be re-pointed to [%s], got [%s]: %v", kept, target, err)
+	}
+}
+
+func TestApplyMarksRefusesDanglingSymlink(t *testing.T) {
+	dir := t.TempDir()
+	kept, deleted, link := filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "link")
+	writeTestFile(t, kept)
+	writeTestFile(t, deleted)
+	if err := os.Symlink(deleted, link); err != nil {
+		t.Fatal(err)
+	}
+	group := &Group{Key: "g", Files: []*File{testFile(t, kept, MarkKeep), testFile(t, deleted, MarkDelete), testFile(t, link, MarkNone)}}
+	report := ApplyMarks([]*Group{group})
+	if report.Deleted != 0 || len(report.Errs) != 1 {
+		t.Fatalf("group whose marks leave symlink dangling must be skipped: %+v", report)
+	}
+	assertExists(t, link)
+}
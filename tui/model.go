@@ -0,0 +1,227 @@
+// Package tui implements interactive terminal UI for reviewing found duplicates
+// and marking them to keep / delete / replace with hard link
+package tui
+
+import (
+	fs "github.com/nj-eka/fdups/filestat"
+	"github.com/nj-eka/fdups/output"
+	"github.com/nj-eka/fdups/registrator"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type Mark int
+
+const (
+	MarkNone   Mark = iota // file is left as is
+	MarkKeep               // file is kept (source for links)
+	MarkDelete             // file is deleted
+	MarkLink               // file is replaced with hard link to kept file of group (symlink is re-pointed to it)
+)
+
+func (m Mark) String() string {
+	switch m {
+	case MarkKeep:
+		return "K"
+	case MarkDelete:
+		return "D"
+	case MarkLink:
+		return "L"
+	}
+	return " "
+}
+
+// File - file of group under review
+type File struct {
+	// Path - path of file (or symlink itself)
+	Path string
+	// Target - resolved path if file is symlink, empty otherwise
+	Target string
+	Inode  uint64
+	Size   int64
+	// ModTime - modification time as it is saved in results (RFC1123, empty if unknown)
+	ModTime string
+	// Line - file description (see filestat.FileStat.String)
+	Line string
+	// Prior - priority of root file belongs to (empty if unknown)
+	Prior string
+	Mark  Mark
+}
+
+// IsLink - file is symlink
+func (f *File) IsLink() bool {
+	return f.Target != ""
+}
+
+// Group - group of duplicates under review
+type Group struct {
+	Key   string
+	Files []*File
+	// Expanded - group files are shown
+	Expanded bool
+}
+
+// Size - content size of one file in group
+func (g *Group) Size() int64 {
+	if len(g.Files) == 0 {
+		return 0
+	}
+	return g.Files[0].Size
+}
+
+// Inodes - number of unique inodes in group (symlinks don't occupy content space, so they are not counted)
+func (g *Group) Inodes() int {
+	inodes := make(map[uint64]struct{}, len(g.Files))
+	for _, f := range g.Files {
+		if !f.IsLink() {
+			inodes[f.Inode] = struct{}{}
+		}
+	}
+	return len(inodes)
+}
+
+// Wasted - bytes that can be freed by keeping only one inode of group
+func (g *Group) Wasted() int64 {
+	inodes := g.Inodes()
+	if inodes < 2 {
+		return 0
+	}
+	return g.Size() * int64(inodes-1)
+}
+
+// SetKept marks file to keep instead of previously kept one: other files marked to keep are unmarked
+// except hard links of file (they are kept anyway). Only regular file (not symlink) can be kept.
+func (g *Group) SetKept(file *File) bool {
+	if file.IsLink() {
+		return false
+	}
+	for _, f := range g.Files {
+		if f.Mark == MarkKeep && (f.IsLink() || f.Inode != file.Inode) {
+			f.Mark = MarkNone
+		}
+	}
+	file.Mark = MarkKeep
+	return true
+}
+
+// Kept - first regular file marked to keep (nil if none)
+func (g *Group) Kept() *File {
+	for _, f := range g.Files {
+		if f.Mark == MarkKeep && !f.IsLink() {
+			return f
+		}
+	}
+	return nil
+}
+
+// SetDefaultMarks marks files according to their priority:
+// the first regular file (files are sorted by root priority first - see filestat.FileStat.Prior / SortingKey)
+// and its hard links are kept,
+// other regular files are marked to delete, symlinks to deleted files are marked to link (re-point to kept file),
+// other symlinks are left as is.
+func (g *Group) SetDefaultMarks() {
+	if len(g.Files) == 0 {
+		return
+	}
+	kept := g.Files[0]
+	for _, f := range g.Files {
+		if !f.IsLink() {
+			kept = f
+			break
+		}
+	}
+	for _, f := range g.Files {
+		switch {
+		case f.Inode == kept.Inode && !f.IsLink():
+			f.Mark = MarkKeep
+		case f.IsLink():
+			f.Mark = MarkNone
+		default:
+			f.Mark = MarkDelete
+		}
+	}
+	for _, f := range g.Files {
+		if f.IsLink() && g.isDeleted(f.Target) {
+			f.Mark = MarkLink
+		}
+	}
+}
+
+// isDeleted - regular file at path is marked to delete
+func (g *Group) isDeleted(path string) bool {
+	for _, f := range g.Files {
+		if f.Mark == MarkDelete && !f.IsLink() && samePath(f.Path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// samePath - paths are equal when cleaned (or made absolute)
+func samePath(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// NewGroupsFromResult makes groups for review from in-memory result of content filtering
+func NewGroupsFromResult(dups registrator.Mcifs) []*Group {
+	groups := make([]*Group, 0, len(dups))
+	for _, mckey := range dups.GetKeysSortedByMid() {
+		group := Group{Key: mckey.String()}
+		for _, fileStat := range registrator.Inofs(dups[mckey]).GetFileStatSorted() {
+			group.Files = append(group.Files, newFile(fileStat))
+		}
+		group.SetDefaultMarks()
+		groups = append(groups, &group)
+	}
+	sortByWasted(groups)
+	return groups
+}
+
+func newFile(fileStat fs.FileStat) *File {
+	f := File{
+		Path:    fileStat.Path(),
+		Inode:   uint64(fileStat.Inode()),
+		Size:    fileStat.Size(),
+		ModTime: fileStat.ModTime().Format(time.RFC1123),
+		Line:    fileStat.String(),
+		Prior:   fileStat.Prior(),
+	}
+	if symlink := fileStat.Symlink(); symlink != nil {
+		f.Path, f.Target = symlink.Path(), fileStat.Path()
+	}
+	return &f
+}
+
+// NewGroupsFromReport makes groups for review from saved results (see output.LoadDupsResults)
+func NewGroupsFromReport(reportGroups []output.ReportGroup) []*Group {
+	groups := make([]*Group, 0, len(reportGroups))
+	for _, rg := range reportGroups {
+		group := Group{Key: rg.Key}
+		for _, rf := range rg.Files {
+			group.Files = append(group.Files, &File{
+				Path:    rf.Path,
+				Target:  rf.Target,
+				Inode:   rf.Inode,
+				Size:    rf.Size,
+				ModTime: rf.ModTime,
+				Line:    rf.Line,
+			})
+		}
+		group.SetDefaultMarks()
+		groups = append(groups, &group)
+	}
+	sortByWasted(groups)
+	return groups
+}
+
+func sortByWasted(groups []*Group) {
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].Wasted() > groups[j].Wasted()
+	})
+}
@@ -0,0 +1,15 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package tui
+
+import "errors"
+
+type termState struct{}
+
+var errNotSupported = errors.New("terminal UI is not supported on this platform")
+
+func makeRaw(int) (*termState, error) { return nil, errNotSupported }
+
+func restore(int, *termState) error { return errNotSupported }
+
+func termSize(int) (int, int, error) { return 0, 0, errNotSupported }
@@ -0,0 +1,46 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package tui
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+)
+
+type termState struct {
+	termios unix.Termios
+}
+
+// makeRaw puts terminal fd into raw mode (keys are read as is, without echo and signals) and returns previous state
+func makeRaw(fd int) (*termState, error) {
+	termios, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return nil, fmt.Errorf("not a terminal: %w", err)
+	}
+	oldState := termState{termios: *termios}
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlWriteTermios, termios); err != nil {
+		return nil, fmt.Errorf("setting terminal raw mode failed: %w", err)
+	}
+	return &oldState, nil
+}
+
+// restore restores terminal fd state saved by makeRaw
+func restore(fd int, state *termState) error {
+	return unix.IoctlSetTermios(fd, ioctlWriteTermios, &state.termios)
+}
+
+// termSize returns terminal fd size (width, height)
+func termSize(fd int) (int, int, error) {
+	ws, err := unix.IoctlGetWinsize(fd, unix.TIOCGWINSZ)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(ws.Col), int(ws.Row), nil
+}
@@ -0,0 +1,442 @@
+package tui
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/nj-eka/fdups/fh"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	DefaultPreviewBytes = 4 * 1024
+
+	clearScreen  = "\033[H\033[2J"
+	colorReset   = "\033[0m"
+	colorReverse = "\033[7m"
+	colorRed     = "\033[31m"
+	colorGreen   = "\033[32m"
+	colorYellow  = "\033[33m"
+	colorCyan    = "\033[36m"
+
+	helpLine = "arrows move | enter expand | k keep d delete l link u unmark r reset | p preview | a apply e export | q quit"
+)
+
+type key int
+
+const (
+	keyOther key = iota
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyPgUp
+	keyPgDn
+	keyHome
+	keyEnd
+	keyEnter
+	keyQuit
+)
+
+// Options - terminal UI settings
+type Options struct {
+	// ScriptPath - file to export marks to as shell script
+	ScriptPath string
+	// PreviewBytes - max size of file head shown in preview
+	PreviewBytes int
+}
+
+type row struct {
+	group *Group
+	file  *File // nil for group row
+}
+
+type ui struct {
+	opts   Options
+	groups []*Group
+	rows   []row
+	cursor int
+	offset int
+	status string
+	width  int
+	height int
+	out    *bufio.Writer
+	keys   <-chan keyPress
+	report ActionsReport
+}
+
+type keyPress struct {
+	key  key
+	char byte
+}
+
+// Run runs terminal UI for groups review until user quits or ctx is done.
+// Returns summary of applied marks (if any).
+func Run(ctx context.Context, groups []*Group, opts Options) (ActionsReport, error) {
+	if opts.PreviewBytes <= 0 {
+		opts.PreviewBytes = DefaultPreviewBytes
+	}
+	fd := int(os.Stdin.Fd())
+	state, err := makeRaw(fd)
+	if err != nil {
+		return ActionsReport{}, err
+	}
+	defer func() {
+		_ = restore(fd, state)
+		fmt.Print(clearScreen)
+	}()
+	u := ui{
+		opts:   opts,
+		groups: groups,
+		out:    bufio.NewWriter(os.Stdout),
+		keys:   readKeys(os.Stdin),
+	}
+	u.rebuildRows()
+	for {
+		u.render()
+		select {
+		case <-ctx.Done():
+			return u.report, ctx.Err()
+		case kp, more := <-u.keys:
+			if !more || kp.key == keyQuit {
+				return u.report, nil
+			}
+			u.handle(ctx, kp)
+		}
+	}
+}
+
+// readKeys reads and decodes key presses from terminal in raw mode
+func readKeys(in io.Reader) <-chan keyPress {
+	keys := make(chan keyPress)
+	go func() {
+		defer close(keys)
+		buf := make([]byte, 16)
+		for {
+			n, err := in.Read(buf)
+			if err != nil {
+				return
+			}
+			keys <- decodeKey(buf[:n])
+		}
+	}()
+	return keys
+}
+
+func decodeKey(b []byte) keyPress {
+	switch string(b) {
+	case "\x1b[A", "\x1bOA":
+		return keyPress{key: keyUp}
+	case "\x1b[B", "\x1bOB":
+		return keyPress{key: keyDown}
+	case "\x1b[C", "\x1bOC":
+		return keyPress{key: keyRight}
+	case "\x1b[D", "\x1bOD":
+		return keyPress{key: keyLeft}
+	case "\x1b[5~":
+		return keyPress{key: keyPgUp}
+	case "\x1b[6~":
+		return keyPress{key: keyPgDn}
+	case "\x1b[H", "\x1b[1~", "\x1bOH":
+		return keyPress{key: keyHome}
+	case "\x1b[F", "\x1b[4~", "\x1bOF":
+		return keyPress{key: keyEnd}
+	case "\r", "\n", " ":
+		return keyPress{key: keyEnter}
+	case "q", "\x03":
+		return keyPress{key: keyQuit}
+	}
+	if len(b) == 1 {
+		return keyPress{key: keyOther, char: b[0]}
+	}
+	return keyPress{key: keyOther}
+}
+
+func (u *ui) rebuildRows() {
+	u.rows = u.rows[:0]
+	for _, group := range u.groups {
+		u.rows = append(u.rows, row{group: group})
+		if group.Expanded {
+			for _, f := range group.Files {
+				u.rows = append(u.rows, row{group: group, file: f})
+			}
+		}
+	}
+	if u.cursor >= len(u.rows) {
+		u.cursor = len(u.rows) - 1
+	}
+	if u.cursor < 0 {
+		u.cursor = 0
+	}
+}
+
+func (u *ui) pageSize() int {
+	if size := u.height - 3; size > 0 {
+		return size
+	}
+	return 1
+}
+
+func (u *ui) moveCursor(delta int) {
+	u.cursor += delta
+	if u.cursor >= len(u.rows) {
+		u.cursor = len(u.rows) - 1
+	}
+	if u.cursor < 0 {
+		u.cursor = 0
+	}
+}
+
+func (u *ui) handle(ctx context.Context, kp keyPress) {
+	u.status = ""
+	switch kp.key {
+	case keyUp:
+		u.moveCursor(-1)
+	case keyDown:
+		u.moveCursor(1)
+	case keyPgUp:
+		u.moveCursor(-u.pageSize())
+	case keyPgDn:
+		u.moveCursor(u.pageSize())
+	case keyHome:
+		u.moveCursor(-len(u.rows))
+	case keyEnd:
+		u.moveCursor(len(u.rows))
+	case keyEnter, keyRight, keyLeft:
+		if len(u.rows) == 0 {
+			return
+		}
+		r := u.rows[u.cursor]
+		r.group.Expanded = kp.key == keyRight || (kp.key == keyEnter && !r.group.Expanded)
+		// keep cursor on group row
+		for i := u.cursor; i >= 0; i-- {
+			if u.rows[i].group == r.group && u.rows[i].file == nil {
+				u.cursor = i
+				break
+			}
+		}
+		u.rebuildRows()
+	case keyOther:
+		if len(u.rows) == 0 {
+			return
+		}
+		r := u.rows[u.cursor]
+		switch kp.char {
+		case 'k':
+			u.mark(r, MarkKeep)
+		case 'd':
+			u.mark(r, MarkDelete)
+		case 'l':
+			u.mark(r, MarkLink)
+		case 'u':
+			u.mark(r, MarkNone)
+		case 'r':
+			r.group.SetDefaultMarks()
+		case 'p':
+			if r.file != nil {
+				u.preview(ctx, r.file)
+			}
+		case 'a':
+			u.apply()
+		case 'e':
+			u.export()
+		}
+	}
+}
+
+// mark sets mark on file row or on all not kept files of group row
+func (u *ui) mark(r row, mark Mark) {
+	if r.file != nil {
+		if mark == MarkKeep {
+			if !r.group.SetKept(r.file) {
+				u.status = "symlink can't be kept - select regular file to keep"
+			}
+			return
+		}
+		r.file.Mark = mark
+		return
+	}
+	if mark == MarkKeep {
+		u.status = "select file to keep"
+		return
+	}
+	for _, f := range r.group.Files {
+		if f.Mark != MarkKeep || mark == MarkNone {
+			f.Mark = mark
+		}
+	}
+}
+
+func (u *ui) confirm(question string) bool {
+	u.status = question + " [y/N]"
+	u.render()
+	kp, more := <-u.keys
+	return more && kp.key == keyOther && (kp.char == 'y' || kp.char == 'Y')
+}
+
+func (u *ui) apply() {
+	toDelete, toLink := CountActions(u.groups)
+	if toDelete+toLink == 0 {
+		u.status = "nothing to apply"
+		return
+	}
+	if !u.confirm(fmt.Sprintf("Delete %d file(s) and link %d file(s) to kept ones (hard links, symlinks are re-pointed)?", toDelete, toLink)) {
+		u.status = "canceled"
+		return
+	}
+	report := ApplyMarks(u.groups)
+	u.report.Deleted += report.Deleted
+	u.report.Linked += report.Linked
+	u.report.FreedBytes += report.FreedBytes
+	u.report.Errs = append(u.report.Errs, report.Errs...)
+	u.status = fmt.Sprintf("deleted %d, linked %d, freed %s, errors %d", report.Deleted, report.Linked, fh.BytesToHuman(uint64(report.FreedBytes)), len(report.Errs))
+	if len(report.Errs) > 0 {
+		u.status += fmt.Sprintf(" (first: %v)", report.Errs[0])
+	}
+}
+
+func (u *ui) export() {
+	if u.opts.ScriptPath == "" {
+		u.status = "script path is not set"
+		return
+	}
+	file, err := os.OpenFile(u.opts.ScriptPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		u.status = fmt.Sprintf("export failed: %v", err)
+		return
+	}
+	report, err := ExportScript(file, u.groups)
+	if e := file.Close(); e != nil && err == nil {
+		err = e
+	}
+	if err != nil {
+		u.status = fmt.Sprintf("export failed: %v", err)
+		return
+	}
+	u.status = fmt.Sprintf("exported to [%s]: %d rm, %d ln (%s to free), %d group(s) skipped", u.opts.ScriptPath, report.Deleted, report.Linked, fh.BytesToHuman(uint64(report.FreedBytes)), len(report.Errs))
+}
+
+func (u *ui) preview(ctx context.Context, f *File) {
+	var sb strings.Builder
+	sb.WriteString(clearScreen)
+	sb.WriteString(fmt.Sprintf("%s%s%s\r\n", colorCyan, truncate(f.Path, u.width), colorReset))
+	head, err := readHead(f.Path, u.opts.PreviewBytes)
+	switch {
+	case err != nil:
+		sb.WriteString(fmt.Sprintf("%s%v%s\r\n", colorRed, err, colorReset))
+	case !utf8.Valid(head) || strings.ContainsRune(string(head), 0):
+		sb.WriteString("(binary content)\r\n")
+	default:
+		lines := strings.Split(string(head), "\n")
+		if max := u.height - 3; len(lines) > max && max > 0 {
+			lines = lines[:max]
+		}
+		for _, line := range lines {
+			sb.WriteString(truncate(strings.ReplaceAll(line, "\t", "    "), u.width))
+			sb.WriteString("\r\n")
+		}
+	}
+	sb.WriteString(colorReverse + "press any key to return" + colorReset)
+	_, _ = u.out.WriteString(sb.String())
+	_ = u.out.Flush()
+	select {
+	case <-ctx.Done():
+	case <-u.keys:
+	}
+}
+
+func readHead(path string, size int) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	head := make([]byte, size)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return head[:n], nil
+}
+
+func (u *ui) render() {
+	if w, h, err := termSize(int(os.Stdout.Fd())); err == nil && w > 0 && h > 0 {
+		u.width, u.height = w, h
+	} else {
+		u.width, u.height = 80, 24
+	}
+	pageSize := u.pageSize()
+	if u.cursor < u.offset {
+		u.offset = u.cursor
+	}
+	if u.cursor >= u.offset+pageSize {
+		u.offset = u.cursor - pageSize + 1
+	}
+
+	var wasted int64
+	for _, group := range u.groups {
+		wasted += group.Wasted()
+	}
+	toDelete, toLink := CountActions(u.groups)
+	var sb strings.Builder
+	sb.WriteString(clearScreen)
+	sb.WriteString(colorCyan)
+	sb.WriteString(truncate(fmt.Sprintf("fdups review: %d groups, %s can be freed | marked: %d delete, %d link", len(u.groups), fh.BytesToHuman(uint64(wasted)), toDelete, toLink), u.width))
+	sb.WriteString(colorReset + "\r\n")
+	for i := u.offset; i < len(u.rows) && i < u.offset+pageSize; i++ {
+		line := u.rowLine(u.rows[i])
+		if i == u.cursor {
+			sb.WriteString(colorReverse + truncate(line, u.width) + colorReset)
+		} else {
+			sb.WriteString(colorize(u.rows[i], truncate(line, u.width)))
+		}
+		sb.WriteString("\r\n")
+	}
+	for i := len(u.rows) - u.offset; i < pageSize; i++ {
+		sb.WriteString("\r\n")
+	}
+	sb.WriteString(truncate(u.status, u.width) + "\r\n")
+	sb.WriteString(colorReverse + truncate(helpLine, u.width) + colorReset)
+	_, _ = u.out.WriteString(sb.String())
+	_ = u.out.Flush()
+}
+
+func (u *ui) rowLine(r row) string {
+	if r.file == nil {
+		sign := "+"
+		if r.group.Expanded {
+			sign = "-"
+		}
+		return fmt.Sprintf("[%s] %3d files %3d inodes %10s each %10s wasted  %s", sign, len(r.group.Files), r.group.Inodes(), fh.BytesToHuman(uint64(r.group.Size())), fh.BytesToHuman(uint64(r.group.Wasted())), r.group.Key)
+	}
+	path := r.file.Path
+	if r.file.IsLink() {
+		path = fmt.Sprintf("%s -> %s", r.file.Path, r.file.Target)
+	}
+	return fmt.Sprintf("    [%s] %10d %s", r.file.Mark, r.file.Inode, path)
+}
+
+func colorize(r row, line string) string {
+	if r.file == nil {
+		return line
+	}
+	switch r.file.Mark {
+	case MarkKeep:
+		return colorGreen + line + colorReset
+	case MarkDelete:
+		return colorRed + line + colorReset
+	case MarkLink:
+		return colorYellow + line + colorReset
+	}
+	return line
+}
+
+func truncate(s string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width])
+}
@@ -0,0 +1,240 @@
+// Package chunking estimates savings of block-level dedup: validated files are split into content-defined chunks
+// (see filestat.GetChunkFileFunc) and unique chunks are counted per root and overall
+package chunking
+
+import (
+	"context"
+	"fmt"
+	cou "github.com/nj-eka/fdups/contexts"
+	"github.com/nj-eka/fdups/errs"
+	. "github.com/nj-eka/fdups/filestat"
+	"github.com/nj-eka/fdups/workflow"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// BlockStats - chunks of files: Files (unique inodes) chunked, all Chunks and their Bytes,
+// UniqueChunks and UniqueBytes - chunks with distinct content (that block-level dedup would store)
+type BlockStats struct {
+	Files        int64
+	Chunks       int64
+	Bytes        int64
+	UniqueChunks int64
+	UniqueBytes  int64
+}
+
+// Saved - bytes that block-level dedup would save
+func (bs BlockStats) Saved() int64 {
+	return bs.Bytes - bs.UniqueBytes
+}
+
+// RootBlockStats - chunks of files of root (files are counted in the root of the highest priority they are found in)
+type RootBlockStats struct {
+	Root string
+	BlockStats
+}
+
+// chunkIndex - chunks registered so far with their stats
+type chunkIndex struct {
+	BlockStats
+	chunks map[Chunk]struct{}
+}
+
+func newChunkIndex() *chunkIndex {
+	return &chunkIndex{chunks: make(map[Chunk]struct{})}
+}
+
+func (ci *chunkIndex) add(chunks []Chunk) {
+	ci.Files++
+	for _, chunk := range chunks {
+		ci.Chunks++
+		ci.Bytes += int64(chunk.Size)
+		if _, ok := ci.chunks[chunk]; !ok {
+			ci.chunks[chunk] = struct{}{}
+			ci.UniqueChunks++
+			ci.UniqueBytes += int64(chunk.Size)
+		}
+	}
+}
+
+// BlockDedupStats - chunks registered per root and overall
+type BlockDedupStats struct {
+	sync.RWMutex
+	roots       []string
+	perRoot     []*chunkIndex
+	total       *chunkIndex
+	isCompleted bool
+	// Retries - retries of chunking failed with transient errors
+	Retries *workflow.RetryStats
+}
+
+// Total - chunks of all files
+func (s *BlockDedupStats) Total() BlockStats {
+	s.RLock()
+	defer s.RUnlock()
+	return s.total.BlockStats
+}
+
+// Roots - chunks of files per root (in order of roots); chunks are unique within root
+func (s *BlockDedupStats) Roots() []RootBlockStats {
+	s.RLock()
+	defer s.RUnlock()
+	result := make([]RootBlockStats, 0, len(s.roots))
+	for i, root := range s.roots {
+		result = append(result, RootBlockStats{Root: root, BlockStats: s.perRoot[i].BlockStats})
+	}
+	return result
+}
+
+// IsCompleted - all validated files are chunked
+func (s *BlockDedupStats) IsCompleted() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.isCompleted
+}
+
+func (s *BlockDedupStats) register(root int, chunks []Chunk) {
+	s.Lock()
+	defer s.Unlock()
+	s.perRoot[root].add(chunks)
+	s.total.add(chunks)
+}
+
+type Chunker interface {
+	ErrCh() <-chan errs.Error
+	Run(ctx context.Context) <-chan struct{}
+	Stats() interface{}
+}
+
+type inodeKey struct {
+	dev   uint64
+	inode Inode
+}
+
+type chunker struct {
+	inputCh <-chan FileStat
+	errCh   chan errs.Error
+	stats   BlockDedupStats
+
+	inodes        sync.Map // inodeKey -> struct{} (hard links are chunked once)
+	chunkFileFunc ChunkFileFunc
+	retryPolicy   workflow.RetryPolicy
+	concurrency   workflow.Concurrency
+}
+
+// NewChunker - chunking stage of validated files found in roots (root of file is taken from its priority - see NewPriorFunc)
+func NewChunker(ctx context.Context,
+	inputCh <-chan FileStat,
+	roots []string,
+	chunkFileFunc ChunkFileFunc,
+	retryPolicy workflow.RetryPolicy,
+	concurrency workflow.Concurrency) Chunker {
+	ctx = cou.BuildContext(ctx, cou.SetContextOperation("3.0.chunking_init"))
+	concurrency = concurrency.WithDefaults(runtime.NumCPU(), 0)
+	c := chunker{
+		inputCh: inputCh,
+		errCh:   make(chan errs.Error, concurrency.Workers*2),
+		stats: BlockDedupStats{
+			roots:   roots,
+			perRoot: make([]*chunkIndex, len(roots)),
+			total:   newChunkIndex(),
+			Retries: &workflow.RetryStats{},
+		},
+		chunkFileFunc: chunkFileFunc,
+		retryPolicy:   retryPolicy,
+		concurrency:   concurrency,
+	}
+	for i := range roots {
+		c.stats.perRoot[i] = newChunkIndex()
+	}
+	return &c
+}
+
+func (r *chunker) Run(ctx context.Context) <-chan struct{} {
+	ctx = cou.BuildContext(ctx, cou.SetContextOperation("3.chunking"))
+	done := make(chan struct{})
+
+	go func() {
+		ctx = cou.BuildContext(ctx, cou.AddContextOperation("workers"))
+		var (
+			wg    sync.WaitGroup
+			wPool = make(chan struct{}, r.concurrency.Workers)
+		)
+		defer workflow.OnExit(ctx, r.errCh, "workers", func() {
+			wg.Wait()
+			close(wPool)
+			close(r.errCh)
+			close(done)
+		})
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case fs, more := <-r.inputCh:
+				if !more {
+					wg.Wait()
+					if ctx.Err() == nil {
+						r.stats.Lock()
+						r.stats.isCompleted = true
+						r.stats.Unlock()
+					}
+					return
+				}
+				if _, loaded := r.inodes.LoadOrStore(inodeKey{fs.Dev(), fs.Inode()}, struct{}{}); loaded {
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case wPool <- struct{}{}:
+					wg.Add(1)
+
+					go func(fs FileStat) {
+						defer wg.Done()
+						defer func() { <-wPool }()
+						var chunks []Chunk
+						err := workflow.Retry(ctx, r.retryPolicy, r.stats.Retries, func() (err error) {
+							chunks = chunks[:0] // chunks of failed attempt are dropped
+							_, err = r.chunkFileFunc(ctx, fs, func(chunk Chunk) {
+								chunks = append(chunks, chunk)
+							})
+							return
+						})
+						if err != nil {
+							if ctx.Err() == nil {
+								r.errCh <- errs.E(ctx, errs.KindIO, errs.Path(fs.Path()), fmt.Errorf("chunking of [%s] failed: %w", fs.Path(), err))
+							}
+							return
+						}
+						r.stats.register(r.rootIndex(fs), chunks)
+					}(fs)
+
+				}
+			}
+		}
+	}()
+	return done
+}
+
+// rootIndex - index of root of file by its priority (files out of roots are counted in the last one)
+func (r *chunker) rootIndex(fs FileStat) int {
+	index, err := strconv.Atoi(strings.TrimSpace(fs.Prior()))
+	if err != nil || index < 0 || index >= len(r.stats.roots) {
+		return len(r.stats.roots) - 1
+	}
+	return index
+}
+
+func (r *chunker) ErrCh() <-chan errs.Error {
+	return r.errCh
+}
+
+func (r *chunker) Stats() interface{} {
+	return &r.stats
+}
+
+func (r *chunker) Concurrency() (string, workflow.Concurrency) {
+	return "chunking", r.concurrency
+}
@@ -0,0 +1,35 @@
+package workflow
+
+import (
+	"fmt"
+)
+
+// Concurrency - number of workers and capacity of output channel (buffer) of pipeline stage; 0 = default of stage
+type Concurrency struct {
+	Workers int `json:"workers"`
+	Buffer  int `json:"buffer"`
+}
+
+// Validate checks that settings are not negative
+func (c Concurrency) Validate(stage string) error {
+	if c.Workers < 0 || c.Buffer < 0 {
+		return fmt.Errorf("invalid concurrency settings of stage [%s]: workers (%d) and buffer (%d) must not be negative", stage, c.Workers, c.Buffer)
+	}
+	return nil
+}
+
+// WithDefaults replaces zero values with defaults
+func (c Concurrency) WithDefaults(workers, buffer int) Concurrency {
+	if c.Workers == 0 {
+		c.Workers = workers
+	}
+	if c.Buffer == 0 {
+		c.Buffer = buffer
+	}
+	return c
+}
+
+// ConcurrencyReporter - pipeline stage reporting its effective concurrency settings
+type ConcurrencyReporter interface {
+	Concurrency() (stage string, c Concurrency)
+}
@@ -13,8 +13,18 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// HashStage - hash filter stage: files are grouped by checksums of Hash (appended to checksums of previous stages);
+// files Skip (optional) returns true for pass stage by without hashing (e.g. files too small for prefilter)
+type HashStage struct {
+	Name string
+	Hash HashFileFunc
+	Skip FileSizeLesserFunc
+}
+
 type ContentFilter interface {
 	ErrCh() <-chan errs.Error
 	Run(ctx context.Context) <-chan struct{}
@@ -26,36 +36,69 @@ type contentFilter struct {
 	errCh   chan errs.Error
 	stats   ContentFilterStats
 
-	hashFilterFuncs           []HashFileFunc
-	skipPrefiltersMaxSizeFunc FileSizeLesserFunc
-	contentIds                []chan ContentId
-	maxWorkersPerStage        int
+	stages            []HashStage
+	verifyFunc        VerifyFunc
+	groupEventHandler GroupEventHandler
+	contentIds        []chan ContentId
+	retryPolicy       workflow.RetryPolicy
+	concurrency       workflow.Concurrency
 }
 
-func NewContentFilter(ctx context.Context, inputCh <-chan ContentId, metaRegister registrator.MifsRegister, hashFilterFuncs []HashFileFunc, skipPrefiltersMaxSizeFunc FileSizeLesserFunc, initCap int) ContentFilter {
+// scheduledFilesPerWorker - files in flight per worker of stage with device scheduling
+const scheduledFilesPerWorker = 8
+
+// NewContentFilter - groupEventHandler (optional) is called on each confirmed group of duplicates as soon as it happens;
+// concurrency is given per hashing stage (NumCPU workers and buffer of twice as many by default);
+// with device scheduling files wait for their devices before they take worker slot of stage
+// (up to scheduledFilesPerWorker files per worker are in flight);
+// verifyFunc (optional) compares members of final groups byte by byte before filtering is completed (see VerifyFunc)
+func NewContentFilter(ctx context.Context, inputCh <-chan ContentId, metaRegister registrator.MifsRegister, stages []HashStage, verifyFunc VerifyFunc, groupEventHandler GroupEventHandler, retryPolicy workflow.RetryPolicy, concurrency workflow.Concurrency, tuning TunerSettings, scheduling DeviceSchedulerSettings, initCap int) ContentFilter {
 	ctx = cou.BuildContext(ctx, cou.SetContextOperation("4.0.contentfilter_init"))
 	maxStageWorkers := runtime.NumCPU()
-	contentIds := make([]chan ContentId, 0, len(hashFilterFuncs))
-	stageRegisters := make([]registrator.McifsRegister, 0, len(hashFilterFuncs))
-	stageInodeStats := make([]registrator.InodeChecksums, 0, len(hashFilterFuncs))
-	for range hashFilterFuncs {
-		contentIds = append(contentIds, make(chan ContentId, maxStageWorkers*2))
+	if concurrency.Workers > 0 {
+		maxStageWorkers = concurrency.Workers
+	}
+	concurrency = concurrency.WithDefaults(maxStageWorkers, maxStageWorkers*2)
+	contentIds := make([]chan ContentId, 0, len(stages))
+	stageRegisters := make([]registrator.McifsRegister, 0, len(stages))
+	stageInodeStats := make([]registrator.InodeChecksums, 0, len(stages))
+	stageLimiters := make([]*workflow.Limiter, 0, len(stages))
+	stageNames := make([]string, 0, len(stages))
+	for _, stage := range stages {
+		stageNames = append(stageNames, stage.Name)
+		stageLimiters = append(stageLimiters, workflow.NewLimiter(concurrency.Workers))
+		contentIds = append(contentIds, make(chan ContentId, concurrency.Buffer))
 		stageRegisters = append(stageRegisters, registrator.NewMcifsRegister(initCap))
 		stageInodeStats = append(stageInodeStats, registrator.NewInodeChecksums(initCap))
 	}
+	var verification *VerificationStats
+	if verifyFunc != nil {
+		verification = &VerificationStats{}
+	}
 	return &contentFilter{
 		inputCh: inputCh,
-		errCh:   make(chan errs.Error, maxStageWorkers*len(hashFilterFuncs)*2),
+		errCh:   make(chan errs.Error, concurrency.Workers*len(stages)*2),
 		stats: ContentFilterStats{
 			MetaRegister:    metaRegister,
+			InputInodeStats: registrator.NewEncounter(initCap),
+			StageNames:      stageNames,
 			StageRegisters:  stageRegisters,
+			stageSkipped:    make([]int64, len(stages)),
 			StageInodeStats: stageInodeStats,
 			ContentRegister: registrator.NewMcifsRegister(initCap),
+			Retries:         &workflow.RetryStats{},
+			StageLimiters:   stageLimiters,
+			Tuner:           NewTuner(tuning, stageLimiters),
+			Scheduler:       NewDeviceScheduler(scheduling),
+			ReadFallbacks:   &ReadFallbacks{},
+			Verification:    verification,
 		},
-		hashFilterFuncs:           hashFilterFuncs,
-		skipPrefiltersMaxSizeFunc: skipPrefiltersMaxSizeFunc,
-		contentIds:                contentIds,
-		maxWorkersPerStage:        maxStageWorkers,
+		stages:            stages,
+		verifyFunc:        verifyFunc,
+		groupEventHandler: groupEventHandler,
+		contentIds:        contentIds,
+		retryPolicy:       retryPolicy,
+		concurrency:       concurrency,
 	}
 }
 
@@ -63,12 +106,28 @@ func (r *contentFilter) Run(ctx context.Context) <-chan struct{} {
 	ctx = cou.BuildContext(ctx, cou.SetContextOperation("4.contentfilter_run"))
 	done := make(chan struct{})
 
-	lastIndex := len(r.hashFilterFuncs) - 1
+	lastIndex := len(r.stages) - 1
 	finalCidsStream := r.contentIds[lastIndex]
 
+	if r.stats.Tuner != nil {
+		go r.stats.Tuner.Run(ctx, &r.stats)
+	}
+
 	// start hash cropping
 	go func(ctx context.Context) {
 		ctx = cou.BuildContext(ctx, cou.AddContextOperation("stages"))
+		// files read in fallback mode (e.g. O_DIRECT is not supported) are hashed as usual,
+		// the first fallback of each device (and mode) is reported as warning, the rest are only counted
+		ctx = WithReadFallbackHandler(ctx, func(err *ReadFallbackError) {
+			if !r.stats.ReadFallbacks.Check(err) {
+				return
+			}
+			select {
+			case <-ctx.Done():
+			case r.errCh <- errs.E(ctx, errs.KindReadFallback, errs.SeverityWarning, errs.Path(err.Path),
+				fmt.Errorf("%w (further fallbacks of device [%s] are only counted)", err, DeviceName(err.Dev))):
+			}
+		})
 		var wgStages sync.WaitGroup
 		defer func() {
 			wgStages.Wait()
@@ -76,7 +135,7 @@ func (r *contentFilter) Run(ctx context.Context) <-chan struct{} {
 		}()
 		inputStream := r.inputCh
 
-		for i := range r.hashFilterFuncs {
+		for i := range r.stages {
 			if i > 0 {
 				inputStream = r.contentIds[i-1]
 			}
@@ -86,15 +145,16 @@ func (r *contentFilter) Run(ctx context.Context) <-chan struct{} {
 				ctx = cou.BuildContext(ctx, cou.AddContextOperation(cou.Operation(fmt.Sprintf("stage_[%d]", index))))
 				var (
 					outputStream   = r.contentIds[index]
-					hashFilterFunc = r.hashFilterFuncs[index]
+					stage          = r.stages[index]
 					register       = r.stats.StageRegisters[index]
 					iS             = r.stats.StageInodeStats[index]
 					wgStageWorkers sync.WaitGroup
-					wpStageWorkers = make(chan struct{}, r.maxWorkersPerStage)
+					limiter        = r.stats.StageLimiters[index]
+					// inFlight - files waiting for their devices or being hashed (with device scheduling only)
+					inFlight = workflow.NewLimiter(r.concurrency.Workers * scheduledFilesPerWorker)
 				)
 				defer workflow.OnExit(ctx, r.errCh, fmt.Sprintf("stage_[%d]", index), func() {
 					wgStageWorkers.Wait()
-					close(wpStageWorkers)
 					close(outputStream)
 					wgStages.Done()
 				})
@@ -104,68 +164,121 @@ func (r *contentFilter) Run(ctx context.Context) <-chan struct{} {
 						return
 					case cid, more := <-inputStream:
 						if more {
-							// if file's size is relative small, skip prefilters
-							if (index < lastIndex) && r.skipPrefiltersMaxSizeFunc(cid.fileStat) {
-								r.contentIds[lastIndex-1] <- cid // bypass all prehashing stages
-							} else {
-								select {
+							if index == 0 {
+								r.stats.InputInodeStats.CheckIn(registrator.KeySize{Key: cid.fileStat.Inode(), Size: cid.fileStat.Size()})
+							}
+							if stage.Skip != nil && stage.Skip(cid.fileStat) {
+								atomic.AddInt64(&r.stats.stageSkipped[index], 1)
+								select { // stage doesn't apply to file (e.g. it's too small for prefilter) - bypass it
+								case <-ctx.Done():
+									return
+								case outputStream <- cid:
+								}
+							} else if r.stats.Tuner != nil && r.stats.Tuner.Skip(index, cid.fileStat) {
+								select { // prefilter doesn't pay off for this meta group - bypass it
 								case <-ctx.Done():
 									return
-								case wpStageWorkers <- struct{}{}:
-									wgStageWorkers.Add(1)
-
-									go func(cid ContentId, wg *sync.WaitGroup) {
-										defer wg.Done()
-										defer func() { <-wpStageWorkers }()
-										var (
-											err          error
-											written      int64
-											checksums    string
-											exist, valid bool
-										)
-										checksums, exist, valid, pending := iS.CheckIn(cid.fileStat)
-										if !exist {
-											if pending == nil { // first time checksum calculation
-												checksums, written, err = hashFilterFunc(cid.fileStat, strconv.Itoa(index))
-												if err == nil {
-													checksums = strings.Join([]string{cid.checksums, checksums}, "&")
-													iS.Update(cid.fileStat, checksums, written)
-													valid = true
-												} else {
+								case outputStream <- cid:
+								}
+							} else {
+								// with device scheduling worker slot is taken as soon as device is granted (see below)
+								slots := limiter
+								if r.stats.Scheduler != nil {
+									slots = inFlight
+								}
+								if !slots.Acquire(ctx) {
+									return
+								}
+								wgStageWorkers.Add(1)
+
+								go func(cid ContentId, wg *sync.WaitGroup) {
+									defer wg.Done()
+									defer slots.Release()
+									var (
+										err          error
+										written      int64
+										checksums    string
+										exist, valid bool
+									)
+									checksums, exist, valid, pending := iS.CheckIn(cid.fileStat)
+									if !exist {
+										if pending == nil { // first time checksum calculation
+											release, hashCtx := func() {}, ctx
+											if r.stats.Scheduler != nil {
+												// chunks of large file (tree hashing) are read no more concurrently than files of its device
+												hashCtx = WithTreeWorkers(ctx, r.stats.Scheduler.Limit(cid.fileStat))
+												// files waiting for busy device don't hold worker slots needed by files of other devices
+												releaseDevice := r.stats.Scheduler.Acquire(ctx, cid.fileStat)
+												if releaseDevice == nil {
 													iS.Delete(cid.fileStat)
-													r.errCh <- errs.E(ctx, errs.KindIO, fmt.Errorf("content hashing stage [%d] with processing file [%s] failed: %w", index, cid.fileStat, err))
 													return
 												}
-											} else { // checksum pending
-												<-pending
-												checksums, _, valid, _ = iS.CheckIn(cid.fileStat)
+												if !limiter.Acquire(ctx) {
+													releaseDevice()
+													iS.Delete(cid.fileStat)
+													return
+												}
+												release = func() {
+													limiter.Release()
+													releaseDevice()
+												}
 											}
+											started := time.Now()
+											err = workflow.Retry(ctx, r.retryPolicy, r.stats.Retries, func() (err error) {
+												checksums, written, err = stage.Hash(hashCtx, cid.fileStat, strconv.Itoa(index))
+												return
+											})
+											release()
+											if err == nil {
+												if r.stats.Tuner != nil {
+													r.stats.Tuner.Hashed(ctx, index, cid.fileStat, time.Since(started))
+												}
+												checksums = strings.Join([]string{cid.checksums, checksums}, "&")
+												iS.Update(cid.fileStat, checksums, written)
+												valid = true
+											} else {
+												iS.Delete(cid.fileStat)
+												if ctx.Err() != nil { // hashing is stopped
+													return
+												}
+												r.errCh <- errs.E(ctx, errs.KindIO, errs.Path(cid.fileStat.Path()), fmt.Errorf("content hashing stage [%d] with processing file [%s] failed: %w", index, cid.fileStat, err))
+												return
+											}
+										} else { // checksum pending
+											<-pending
+											checksums, _, valid, _ = iS.CheckIn(cid.fileStat)
 										}
-										if !valid {
-											r.errCh <- errs.E(ctx, errs.KindIO, fmt.Sprintf("content hashing stage [%d] with processing file [%s]: invalid checksum", index, cid.fileStat))
-											return
-										}
-										// filtering duplicates based on meta key and checksums
-										if inodes := register.CheckIn(cid.fileStat, checksums); len(inodes) > 1 {
-											if len(inodes) == 2 {
-												for inode, fss := range inodes {
-													if inode != cid.fileStat.Inode() {
-														select {
-														case <-ctx.Done():
-															return
-														case outputStream <- ContentId{checksums, fss[0]}:
+									}
+									if !valid {
+										r.errCh <- errs.E(ctx, errs.KindIO, errs.Path(cid.fileStat.Path()), fmt.Sprintf("content hashing stage [%d] with processing file [%s]: invalid checksum", index, cid.fileStat))
+										return
+									}
+									// filtering duplicates based on meta key and checksums
+									if inodes := register.CheckIn(cid.fileStat, checksums); len(inodes) > 1 {
+										if len(inodes) == 2 {
+											for inode, fss := range inodes {
+												if inode != cid.fileStat.Inode() {
+													select {
+													case <-ctx.Done():
+														return
+													case outputStream <- ContentId{checksums, fss[0]}:
+														if r.stats.Tuner != nil {
+															r.stats.Tuner.Passed(index, fss[0])
 														}
 													}
 												}
 											}
-											select {
-											case <-ctx.Done():
-												return
-											case outputStream <- ContentId{checksums, cid.fileStat}:
+										}
+										select {
+										case <-ctx.Done():
+											return
+										case outputStream <- ContentId{checksums, cid.fileStat}:
+											if r.stats.Tuner != nil {
+												r.stats.Tuner.Passed(index, cid.fileStat)
 											}
 										}
-									}(cid, &wgStageWorkers)
-								}
+									}
+								}(cid, &wgStageWorkers)
 							}
 						} else {
 							return
@@ -190,13 +303,24 @@ func (r *contentFilter) Run(ctx context.Context) <-chan struct{} {
 				return
 			case cid, more := <-finalCidsStream:
 				if more {
-					r.stats.ContentRegister.CheckIn(cid.fileStat, cid.checksums)
+					inodes := r.stats.ContentRegister.CheckIn(cid.fileStat, cid.checksums)
+					if r.groupEventHandler != nil {
+						if event := newGroupEvent(registrator.MCKey{Mid: cid.fileStat.MetaKey(), Cid: cid.checksums}, cid.fileStat, inodes); event != nil {
+							r.groupEventHandler(*event)
+						}
+					}
 				} else {
 					break finalLoop
 				}
 			}
 		}
-		r.stats.setCompleted()
+		result := mergeRegisters(&r.stats, true)
+		if r.verifyFunc != nil {
+			if result = r.verifyGroups(ctx, result); result == nil { // verification is interrupted - result is incomplete and unverified (see IsVerified)
+				return
+			}
+		}
+		r.stats.setCompleted(result)
 	}(ctx)
 
 	return done
@@ -209,3 +333,7 @@ func (r *contentFilter) ErrCh() <-chan errs.Error {
 func (r *contentFilter) Stats() interface{} {
 	return &r.stats
 }
+
+func (r *contentFilter) Concurrency() (string, workflow.Concurrency) {
+	return "hashing", r.concurrency
+}
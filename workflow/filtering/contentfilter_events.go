@@ -0,0 +1,93 @@
+package filtering
+
+import (
+	. "github.com/nj-eka/fdups/filestat"
+	"github.com/nj-eka/fdups/registrator"
+	"strconv"
+)
+
+type GroupEventType int
+
+const (
+	// GroupConfirmed - group of duplicates reached two members (inodes)
+	GroupConfirmed GroupEventType = iota
+	// GroupMemberAdded - new file added to already confirmed group
+	GroupMemberAdded
+	// GroupSplit - members of group turned out to differ by verification (see VerifyFunc):
+	// group keeps only Files, others are moved to new groups (GroupConfirmed) or excluded
+	GroupSplit
+	// GroupRemoved - group turned out not to be group of duplicates by verification (or it can't be verified)
+	GroupRemoved
+)
+
+func (t GroupEventType) String() string {
+	switch t {
+	case GroupConfirmed:
+		return "confirmed"
+	case GroupMemberAdded:
+		return "member_added"
+	case GroupSplit:
+		return "split"
+	case GroupRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// GroupEvent - event of confirmed group of duplicates emitted by content filter as soon as it happens
+type GroupEvent struct {
+	Type GroupEventType
+	Key  registrator.MCKey
+	// Files - files added to group: two first members for GroupConfirmed (all members if group is split off by verification),
+	// new one for GroupMemberAdded, remaining members for GroupSplit, none for GroupRemoved
+	// Note: hard links of members are not passed through content filter (see ContentFilterStats.GetResult)
+	Files []FileStat
+}
+
+// GroupEventHandler - handler of group events,
+// it is called sequentially from final content filter stage (and then from verification of groups, if it's enabled),
+// so long running handler slows down filtering
+type GroupEventHandler func(GroupEvent)
+
+// newGroupEvent makes event on registration of fileStat in final group inodes (nil - if group is not confirmed yet)
+func newGroupEvent(mcKey registrator.MCKey, fileStat FileStat, inodes map[Inode][]FileStat) *GroupEvent {
+	if len(inodes) < 2 {
+		return nil
+	}
+	if len(inodes) == 2 && len(inodes[fileStat.Inode()]) == 1 {
+		event := GroupEvent{Type: GroupConfirmed, Key: mcKey, Files: make([]FileStat, 0, 2)}
+		for inode, fss := range inodes {
+			if inode != fileStat.Inode() {
+				event.Files = append(event.Files, fss[0])
+			}
+		}
+		event.Files = append(event.Files, fileStat)
+		return &event
+	}
+	return &GroupEvent{Type: GroupMemberAdded, Key: mcKey, Files: []FileStat{fileStat}}
+}
+
+// newVerifiedGroupEvents makes events on verification of group files (one per inode): none if group is verified as is,
+// GroupRemoved if no classes of equal content are left, otherwise GroupSplit of group (keeping the first class)
+// and GroupConfirmed of each other class (see verifiedKey)
+func newVerifiedGroupEvents(mcKey registrator.MCKey, files []FileStat, classes [][]FileStat) []GroupEvent {
+	if len(classes) == 0 {
+		return []GroupEvent{{Type: GroupRemoved, Key: mcKey}}
+	}
+	if len(classes) == 1 && len(classes[0]) == len(files) {
+		return nil
+	}
+	events := []GroupEvent{{Type: GroupSplit, Key: mcKey, Files: classes[0]}}
+	for i, class := range classes[1:] {
+		events = append(events, GroupEvent{Type: GroupConfirmed, Key: verifiedKey(mcKey, i+1), Files: class})
+	}
+	return events
+}
+
+// verifiedKey - key of i-th class of group split by verification (the first one keeps key of group)
+func verifiedKey(mcKey registrator.MCKey, i int) registrator.MCKey {
+	if i > 0 {
+		mcKey.Cid += "&v" + strconv.Itoa(i)
+	}
+	return mcKey
+}
@@ -0,0 +1,70 @@
+package filtering
+
+import (
+	. "github.com/nj-eka/fdups/filestat"
+	"github.com/nj-eka/fdups/registrator"
+	"testing"
+	"testing/fstest"
+)
+
+func testFileStats(t *testing.T, names ...string) []FileStat {
+	t.Helper()
+	mapFS := fstest.MapFS{}
+	for _, name := range names {
+		mapFS[name] = &fstest.MapFile{Data: []byte("content")}
+	}
+	fsys := NewIOFS(mapFS)
+	files := make([]FileStat, 0, len(names))
+	for _, name := range names {
+		fileStat, err := GetFileStat(fsys, name, nil, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, fileStat)
+	}
+	return files
+}
+
+func TestNewGroupEvent(t *testing.T) {
+	files := testFileStats(t, "a", "b", "c")
+	key := registrator.MCKey{Mid: "m", Cid: "c"}
+	inodes := make(map[Inode][]FileStat)
+	var events []*GroupEvent
+	for _, fileStat := range append(files, files[2]) { // the last one is hard link of registered inode
+		inodes[fileStat.Inode()] = append(inodes[fileStat.Inode()], fileStat)
+		events = append(events, newGroupEvent(key, fileStat, inodes))
+	}
+	if events[0] != nil {
+		t.Fatalf("group of single inode must not be confirmed: %+v", events[0])
+	}
+	if e := events[1]; e == nil || e.Type != GroupConfirmed || len(e.Files) != 2 || e.Files[0] != files[0] || e.Files[1] != files[1] {
+		t.Fatalf("expected group confirmed with files a, b; got %+v", e)
+	}
+	for _, e := range events[2:] {
+		if e == nil || e.Type != GroupMemberAdded || len(e.Files) != 1 || e.Files[0] != files[2] || e.Key != key {
+			t.Fatalf("expected member c added, got %+v", e)
+		}
+	}
+}
+
+func TestNewVerifiedGroupEvents(t *testing.T) {
+	files := testFileStats(t, "a", "b", "c", "d", "e")
+	key := registrator.MCKey{Mid: "m", Cid: "c"}
+	if events := newVerifiedGroupEvents(key, files, [][]FileStat{files}); len(events) != 0 {
+		t.Fatalf("verified group must not be changed, got %+v", events)
+	}
+	if events := newVerifiedGroupEvents(key, files, nil); len(events) != 1 || events[0].Type != GroupRemoved || events[0].Key != key {
+		t.Fatalf("expected group removed, got %+v", events)
+	}
+	// e is excluded (unique content or modified)
+	events := newVerifiedGroupEvents(key, files, [][]FileStat{files[:2], files[2:4]})
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", events)
+	}
+	if e := events[0]; e.Type != GroupSplit || e.Key != key || len(e.Files) != 2 || e.Files[0] != files[0] {
+		t.Fatalf("expected group split keeping a, b; got %+v", e)
+	}
+	if e := events[1]; e.Type != GroupConfirmed || e.Key != (registrator.MCKey{Mid: "m", Cid: "c&v1"}) || len(e.Files) != 2 || e.Files[0] != files[2] {
+		t.Fatalf("expected group c, d confirmed with key suffixed &v1; got %+v", e)
+	}
+}
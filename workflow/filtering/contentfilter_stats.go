@@ -3,17 +3,42 @@ package filtering
 import (
 	. "github.com/nj-eka/fdups/filestat"
 	"github.com/nj-eka/fdups/registrator"
+	"github.com/nj-eka/fdups/workflow"
 	"sync"
+	"sync/atomic"
 )
 
 type ContentFilterStats struct {
 	sync.RWMutex
-	isCompleted     bool
-	MetaRegister    registrator.MifsRegister
+	isCompleted  bool
+	MetaRegister registrator.MifsRegister
+	// StageNames - names of hash filter stages (see HashStage)
+	StageNames      []string
 	StageRegisters  []registrator.McifsRegister
 	StageInodeStats []registrator.InodeChecksums
 	ContentRegister registrator.McifsRegister
-	result          registrator.Mcifs
+	// InputInodeStats - inodes (with sizes) passed to content filter as candidates for duplicates
+	InputInodeStats registrator.Encounter
+	// Retries - retries of hashing failed with transient errors (all stages)
+	Retries *workflow.RetryStats
+	// StageLimiters - limiters of workers of stages (adjusted by Tuner if it's set)
+	StageLimiters []*workflow.Limiter
+	// stageSkipped - files passed by stages without hashing (see HashStage.Skip)
+	stageSkipped []int64
+	// Tuner - adaptive controller of stages (nil if tuning is disabled)
+	Tuner *Tuner
+	// Scheduler - per device scheduler of hashing reads (nil if scheduling is disabled)
+	Scheduler *DeviceScheduler
+	// ReadFallbacks - files hashed in fallback read mode (see ReadFallbackError)
+	ReadFallbacks *ReadFallbacks
+	// Verification - progress of byte-by-byte verification of final groups (nil if verification is disabled)
+	Verification *VerificationStats
+	result       registrator.Mcifs
+}
+
+// Skipped returns number of files passed by stage without hashing as stage doesn't apply to them (see HashStage.Skip)
+func (r *ContentFilterStats) Skipped(stage int) int64 {
+	return atomic.LoadInt64(&r.stageSkipped[stage])
 }
 
 func (r *ContentFilterStats) IsCompleted() bool {
@@ -22,11 +47,20 @@ func (r *ContentFilterStats) IsCompleted() bool {
 	return r.isCompleted
 }
 
-func (r *ContentFilterStats) setCompleted() {
+// setCompleted sets final result (merged registers, verified if verification is enabled)
+func (r *ContentFilterStats) setCompleted(result registrator.Mcifs) {
 	r.Lock()
 	defer r.Unlock()
 	r.isCompleted = true
-	r.result = mergeRegisters(r, true)
+	r.result = result
+}
+
+// IsVerified - final groups are verified byte by byte (verification is enabled and completed);
+// result of interrupted verification consists of unverified groups
+func (r *ContentFilterStats) IsVerified() bool {
+	r.RLock()
+	defer r.RUnlock()
+	return r.isCompleted && r.Verification != nil
 }
 
 func (r *ContentFilterStats) GetResult() (registrator.Mcifs, bool) {
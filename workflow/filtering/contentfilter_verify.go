@@ -0,0 +1,138 @@
+package filtering
+
+import (
+	"context"
+	"fmt"
+	cou "github.com/nj-eka/fdups/contexts"
+	"github.com/nj-eka/fdups/errs"
+	. "github.com/nj-eka/fdups/filestat"
+	"github.com/nj-eka/fdups/logging"
+	"github.com/nj-eka/fdups/registrator"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// VerificationStats - progress of byte-by-byte verification of final groups (see VerifyFunc):
+// Groups to verify, Verified so far, Split - groups members of which turned out to differ (hash collision),
+// Modified - files excluded from groups as they were modified meanwhile
+type VerificationStats struct {
+	Groups, Verified, Split, Modified int64
+}
+
+// Snapshot returns current values of counters
+func (vs *VerificationStats) Snapshot() VerificationStats {
+	return VerificationStats{
+		Groups:   atomic.LoadInt64(&vs.Groups),
+		Verified: atomic.LoadInt64(&vs.Verified),
+		Split:    atomic.LoadInt64(&vs.Split),
+		Modified: atomic.LoadInt64(&vs.Modified),
+	}
+}
+
+// verifyGroups compares members (one file per inode) of each group of result byte by byte:
+// group is split into groups of equal content (new ones get cid suffix &v<n>), files modified meanwhile are excluded,
+// groups that can't be verified (I/O errors) are dropped; each such event is reported to errCh
+// and to group event handler (see newVerifiedGroupEvents).
+// Returns nil if ctx is done.
+func (r *contentFilter) verifyGroups(ctx context.Context, result registrator.Mcifs) registrator.Mcifs {
+	ctx = cou.BuildContext(ctx, cou.AddContextOperation("verification"))
+	stats := r.stats.Verification
+	atomic.StoreInt64(&stats.Groups, int64(len(result)))
+	// each worker keeps open up to VerifyMaxOpenFiles files
+	workers := runtime.NumCPU()
+	if limit := OpenFilesLimit() / VerifyMaxOpenFiles; workers > limit {
+		workers = limit
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		mu       sync.Mutex
+		verified = make(registrator.Mcifs, len(result))
+		keys     = make(chan registrator.MCKey)
+		wg       sync.WaitGroup
+	)
+	report := func(err errs.Error) {
+		select {
+		case <-ctx.Done():
+		case r.errCh <- err:
+		}
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for mcKey := range keys {
+				inodes := result[mcKey]
+				files := make([]FileStat, 0, len(inodes))
+				for _, fss := range inodes {
+					files = append(files, fss[0])
+				}
+				sort.Slice(files, func(i, j int) bool { return files[i].Path() < files[j].Path() })
+				classes, modified, err := r.verifyFunc(ctx, files)
+				if err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					report(errs.E(ctx, errs.KindIO, errs.Path(files[0].Path()), fmt.Errorf("group [%s] of %d files is dropped as it can't be verified: %w", mcKey, len(files), err)))
+					mu.Lock()
+					r.emitGroupEvents(newVerifiedGroupEvents(mcKey, files, nil))
+					mu.Unlock()
+					atomic.AddInt64(&stats.Verified, 1)
+					continue
+				}
+				for _, fileStat := range modified {
+					report(errs.E(ctx, errs.KindVerifyMismatch, errs.Path(fileStat.Path()), fmt.Sprintf("file [%s] is modified while group [%s] was verified - it is excluded from group", fileStat.Path(), mcKey)))
+				}
+				atomic.AddInt64(&stats.Modified, int64(len(modified)))
+				unique := len(files) - len(modified)
+				for _, class := range classes {
+					unique -= len(class)
+				}
+				if len(classes) > 1 || unique > 0 {
+					report(errs.E(ctx, errs.KindVerifyMismatch, errs.Path(files[0].Path()), fmt.Sprintf("group [%s] of %d files is split by byte-by-byte verification into %d groups (%d files with unique content are excluded) - hash collision", mcKey, len(files), len(classes), unique)))
+					atomic.AddInt64(&stats.Split, 1)
+				}
+				mu.Lock()
+				for i, class := range classes {
+					key := verifiedKey(mcKey, i)
+					verified[key] = make(map[Inode][]FileStat, len(class))
+					for _, fileStat := range class {
+						verified[key][fileStat.Inode()] = inodes[fileStat.Inode()]
+					}
+				}
+				r.emitGroupEvents(newVerifiedGroupEvents(mcKey, files, classes))
+				mu.Unlock()
+				atomic.AddInt64(&stats.Verified, 1)
+			}
+		}()
+	}
+feed:
+	for mcKey := range result {
+		select {
+		case <-ctx.Done():
+			break feed
+		case keys <- mcKey:
+		}
+	}
+	close(keys)
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	vs := stats.Snapshot()
+	logging.LogMsg(ctx).Infof("%d groups verified: %d split, %d modified files excluded", vs.Verified, vs.Split, vs.Modified)
+	return verified
+}
+
+// emitGroupEvents passes events to group event handler (if any); calls are serialized by caller
+func (r *contentFilter) emitGroupEvents(events []GroupEvent) {
+	if r.groupEventHandler == nil {
+		return
+	}
+	for _, event := range events {
+		r.groupEventHandler(event)
+	}
+}
@@ -0,0 +1,201 @@
+package filtering
+
+import (
+	"context"
+	. "github.com/nj-eka/fdups/filestat"
+	"sort"
+	"sync"
+)
+
+// DeviceSchedulerSettings - settings of per device scheduling of hashing reads (see DeviceScheduler)
+type DeviceSchedulerSettings struct {
+	// Enabled - scheduling is on
+	Enabled bool
+	// Reads - max number of files read simultaneously from device (SSD, NVMe, network or unknown media)
+	Reads int
+	// RotationalReads - max number of files read simultaneously from rotating device (HDD)
+	RotationalReads int
+	// Ordered - files waiting for rotating device are read in order of their physical offsets (see PhysicalOffset)
+	Ordered bool
+}
+
+var DefaultDeviceSchedulerSettings = DeviceSchedulerSettings{
+	Reads:           4,
+	RotationalReads: 1,
+	Ordered:         true,
+}
+
+// DeviceScheduler limits number of files read simultaneously from each device (by FileStat.Dev),
+// so that devices are read in parallel but none of them is thrashed;
+// files waiting for rotating device are served in one direction of physical offsets (C-SCAN elevator)
+type DeviceScheduler struct {
+	sync.Mutex
+	settings DeviceSchedulerSettings
+	devices  map[uint64]*device
+}
+
+type device struct {
+	name       string
+	rotational bool
+	ordered    bool
+	limit      int
+	running    int
+	waiting    []*readRequest
+	// head - physical offset of the last granted read
+	head  uint64
+	reads int64
+}
+
+type readRequest struct {
+	offset  uint64
+	granted chan struct{}
+}
+
+// DeviceStats - state of device queue
+type DeviceStats struct {
+	Device     string
+	Rotational bool
+	Limit      int
+	Running    int
+	Waiting    int
+	Reads      int64
+}
+
+// NewDeviceScheduler returns nil if scheduling is disabled
+func NewDeviceScheduler(settings DeviceSchedulerSettings) *DeviceScheduler {
+	if !settings.Enabled {
+		return nil
+	}
+	if settings.Reads <= 0 {
+		settings.Reads = DefaultDeviceSchedulerSettings.Reads
+	}
+	if settings.RotationalReads <= 0 {
+		settings.RotationalReads = DefaultDeviceSchedulerSettings.RotationalReads
+	}
+	return &DeviceScheduler{settings: settings, devices: make(map[uint64]*device)}
+}
+
+func (s *DeviceScheduler) device(dev uint64) *device {
+	d, ok := s.devices[dev]
+	if !ok {
+		rotational, _ := IsRotational(dev)
+		d = &device{name: DeviceName(dev), rotational: rotational, limit: s.settings.Reads}
+		if rotational {
+			d.limit, d.ordered = s.settings.RotationalReads, s.settings.Ordered
+		}
+		s.devices[dev] = d
+	}
+	return d
+}
+
+// Limit - max number of files read simultaneously from device of file
+func (s *DeviceScheduler) Limit(fileStat FileStat) int {
+	s.Lock()
+	defer s.Unlock()
+	return s.device(fileStat.Dev()).limit
+}
+
+// Acquire waits until file can be read from its device;
+// returns function to be called when reading is done (nil if ctx is done before)
+func (s *DeviceScheduler) Acquire(ctx context.Context, fileStat FileStat) (release func()) {
+	s.Lock()
+	d := s.device(fileStat.Dev())
+	if d.running < d.limit && len(d.waiting) == 0 {
+		s.grant(d, -1)
+		s.Unlock()
+		return func() { s.release(d) }
+	}
+	ordered := d.ordered
+	s.Unlock()
+	req := &readRequest{granted: make(chan struct{})}
+	if ordered {
+		req.offset, _ = PhysicalOffset(ctx, fileStat.Path())
+	}
+	s.Lock()
+	d.waiting = append(d.waiting, req)
+	if d.running < d.limit { // slot was released while offset was being got
+		s.grant(d, s.next(d))
+	}
+	s.Unlock()
+	select {
+	case <-req.granted:
+		return func() { s.release(d) }
+	case <-ctx.Done():
+		s.Lock()
+		defer s.Unlock()
+		select {
+		case <-req.granted: // granted meanwhile - slot is passed on
+			s.releaseLocked(d)
+		default:
+			for i, wr := range d.waiting {
+				if wr == req {
+					d.waiting = append(d.waiting[:i], d.waiting[i+1:]...)
+					break
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// next - index of waiting request to be granted: the nearest one at or after head position,
+// otherwise the lowest one (elevator goes back to start); requests with equal offsets (unordered) are taken in FIFO order
+func (s *DeviceScheduler) next(d *device) int {
+	next, lowest := -1, 0
+	for i, req := range d.waiting {
+		if req.offset >= d.head && (next < 0 || req.offset < d.waiting[next].offset) {
+			next = i
+		}
+		if req.offset < d.waiting[lowest].offset {
+			lowest = i
+		}
+	}
+	if next < 0 {
+		next = lowest
+	}
+	return next
+}
+
+// grant - takes slot of device for waiting request [index] (if index < 0 - for caller)
+func (s *DeviceScheduler) grant(d *device, index int) {
+	d.running++
+	d.reads++
+	if index >= 0 {
+		req := d.waiting[index]
+		d.waiting = append(d.waiting[:index], d.waiting[index+1:]...)
+		d.head = req.offset
+		close(req.granted)
+	}
+}
+
+func (s *DeviceScheduler) release(d *device) {
+	s.Lock()
+	defer s.Unlock()
+	s.releaseLocked(d)
+}
+
+func (s *DeviceScheduler) releaseLocked(d *device) {
+	d.running--
+	if len(d.waiting) > 0 && d.running < d.limit {
+		s.grant(d, s.next(d))
+	}
+}
+
+// Stats returns state of device queues (sorted by device)
+func (s *DeviceScheduler) Stats() []DeviceStats {
+	s.Lock()
+	defer s.Unlock()
+	result := make([]DeviceStats, 0, len(s.devices))
+	for _, d := range s.devices {
+		result = append(result, DeviceStats{
+			Device:     d.name,
+			Rotational: d.rotational,
+			Limit:      d.limit,
+			Running:    d.running,
+			Waiting:    len(d.waiting),
+			Reads:      d.reads,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Device < result[j].Device })
+	return result
+}
@@ -0,0 +1,63 @@
+package filtering
+
+import (
+	"context"
+	. "github.com/nj-eka/fdups/filestat"
+	"sync"
+)
+
+// HeadChecksums - head checksums of inodes shared by truncation filter and head prefilter stage of content filter,
+// so that head of each file is read once: whichever of them hashes inode first computes its checksum,
+// the other one reuses it (or waits for it while it is being computed)
+type HeadChecksums struct {
+	headHash HashFileFunc
+	mu       sync.Mutex
+	m        map[inodeKey]*headChecksum
+}
+
+type headChecksum struct {
+	done     chan struct{}
+	checksum string // without prefix
+	err      error
+}
+
+// NewHeadChecksums - headHash is hasher of head prefilter (see filestat.GetHashFileFunc)
+func NewHeadChecksums(headHash HashFileFunc) *HeadChecksums {
+	return &HeadChecksums{
+		headHash: headHash,
+		m:        make(map[inodeKey]*headChecksum),
+	}
+}
+
+// Hash is HashFileFunc of head prefilter hashing each inode once: reused checksum is returned with written = 0;
+// failed hashing is not kept, so the next call (e.g. retry) hashes inode again
+func (hc *HeadChecksums) Hash(ctx context.Context, fs FileStat, prefix string) (string, int64, error) {
+	key := inodeKey{fs.Dev(), fs.Inode()}
+	hc.mu.Lock()
+	hcs, ok := hc.m[key]
+	if !ok {
+		hcs = &headChecksum{done: make(chan struct{})}
+		hc.m[key] = hcs
+		hc.mu.Unlock()
+		var written int64
+		// checksum is prefixed as "<prefix>:<size>:<algo>:<hex>", so that it is hashed without prefix once
+		hcs.checksum, written, hcs.err = hc.headHash(ctx, fs, "")
+		if hcs.err != nil {
+			hc.mu.Lock()
+			delete(hc.m, key)
+			hc.mu.Unlock()
+		}
+		close(hcs.done)
+		return prefix + hcs.checksum, written, hcs.err
+	}
+	hc.mu.Unlock()
+	select {
+	case <-ctx.Done():
+		return "", 0, ctx.Err()
+	case <-hcs.done:
+	}
+	if hcs.err != nil {
+		return hc.Hash(ctx, fs, prefix)
+	}
+	return prefix + hcs.checksum, 0, nil
+}
@@ -25,20 +25,26 @@ type MetaFilter interface {
 }
 
 type metaFilter struct {
-	inputCh <-chan FileStat
-	resCh   chan ContentId
-	errCh   chan errs.Error
-	stats   MetaFilterStats
+	inputCh     <-chan FileStat
+	resCh       chan ContentId
+	errCh       chan errs.Error
+	stats       MetaFilterStats
+	concurrency workflow.Concurrency
 }
 
-func NewMetaFilter(ctx context.Context, inputCh <-chan FileStat, initCapacity int) MetaFilter {
+// NewMetaFilter - files are registered by single worker (order of registration defines candidates passed on),
+// so concurrency.Workers is ignored
+func NewMetaFilter(ctx context.Context, inputCh <-chan FileStat, concurrency workflow.Concurrency, initCapacity int) MetaFilter {
 	ctx = cou.BuildContext(ctx, cou.SetContextOperation("3.0.metafilter_init"))
 	maxWorkers := runtime.NumCPU() * 2
+	concurrency.Workers = 0
+	concurrency = concurrency.WithDefaults(1, maxWorkers) // buffer = number of hash filter workers
 	return &metaFilter{
-		inputCh: inputCh,
-		resCh:   make(chan ContentId, maxWorkers),    // = number of hash filter workers
-		errCh:   make(chan errs.Error, maxWorkers*2), // = cap(resCh) * 2
-		stats:   registrator.NewMifsRegister(initCapacity),
+		inputCh:     inputCh,
+		resCh:       make(chan ContentId, concurrency.Buffer),
+		errCh:       make(chan errs.Error, concurrency.Buffer*2), // = cap(resCh) * 2
+		stats:       registrator.NewMifsRegister(initCapacity),
+		concurrency: concurrency,
 	}
 }
 
@@ -96,3 +102,7 @@ func (r *metaFilter) ErrCh() <-chan errs.Error {
 func (r *metaFilter) Stats() interface{} {
 	return r.stats
 }
+
+func (r *metaFilter) Concurrency() (string, workflow.Concurrency) {
+	return "metafilter", r.concurrency
+}
@@ -0,0 +1,327 @@
+package filtering
+
+import (
+	"context"
+	"fmt"
+	cou "github.com/nj-eka/fdups/contexts"
+	"github.com/nj-eka/fdups/errs"
+	. "github.com/nj-eka/fdups/filestat"
+	"github.com/nj-eka/fdups/workflow"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// TruncatedPair - file Truncated is exact prefix of (larger) file Full - e.g. left by interrupted download or copy
+type TruncatedPair struct {
+	Truncated, Full FileStat
+}
+
+// MaxTruncationGroupSize - max number of files of the same head checksum compared with each other
+// (comparing is quadratic in group size, larger groups are skipped and counted as Skipped)
+const MaxTruncationGroupSize = 1000
+
+// TruncationCounters - progress of truncated copies detection: Files - inodes registered, Hashed - inodes head hashed,
+// Groups - groups of inodes with the same head checksum and different sizes, Compared - pairs of files compared so far,
+// Skipped - groups not compared as larger than MaxTruncationGroupSize
+type TruncationCounters struct {
+	Files, Hashed, Groups, Compared, Skipped int64
+}
+
+// Snapshot returns current values of counters
+func (tc *TruncationCounters) Snapshot() TruncationCounters {
+	return TruncationCounters{
+		Files:    atomic.LoadInt64(&tc.Files),
+		Hashed:   atomic.LoadInt64(&tc.Hashed),
+		Groups:   atomic.LoadInt64(&tc.Groups),
+		Compared: atomic.LoadInt64(&tc.Compared),
+		Skipped:  atomic.LoadInt64(&tc.Skipped),
+	}
+}
+
+// TruncationStats - truncated copies found so far (see TruncationFilter)
+type TruncationStats struct {
+	Counters TruncationCounters
+	sync.RWMutex
+	pairs       []TruncatedPair
+	isCompleted bool
+	// Retries - retries of head hashing failed with transient errors
+	Retries *workflow.RetryStats
+}
+
+// Found - number of truncated copies found so far
+func (s *TruncationStats) Found() int {
+	s.RLock()
+	defer s.RUnlock()
+	return len(s.pairs)
+}
+
+// GetResult returns truncated copies found (sorted by path of full file, then of truncated one) and whether detection is completed
+func (s *TruncationStats) GetResult() ([]TruncatedPair, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	pairs := append([]TruncatedPair(nil), s.pairs...)
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Full.Path() != pairs[j].Full.Path() {
+			return pairs[i].Full.Path() < pairs[j].Full.Path()
+		}
+		return pairs[i].Truncated.Path() < pairs[j].Truncated.Path()
+	})
+	return pairs, s.isCompleted
+}
+
+// IsCompleted - all registered files are checked
+func (s *TruncationStats) IsCompleted() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.isCompleted
+}
+
+type TruncationFilter interface {
+	OutputCh() <-chan FileStat
+	ErrCh() <-chan errs.Error
+	Run(ctx context.Context) <-chan struct{}
+	Stats() interface{}
+}
+
+type truncationFilter struct {
+	inputCh <-chan FileStat
+	resCh   chan FileStat
+	errCh   chan errs.Error
+	stats   TruncationStats
+
+	headHash    HashFileFunc
+	headSkip    FileSizeLesserFunc
+	prefixFunc  PrefixFunc
+	retryPolicy workflow.RetryPolicy
+	concurrency workflow.Concurrency
+
+	mu    sync.Mutex
+	heads map[string][]FileStat // head checksum -> files (one per inode)
+	seen  map[inodeKey]struct{}
+}
+
+type inodeKey struct {
+	dev   uint64
+	inode Inode
+}
+
+// NewTruncationFilter - files are passed on as they come (to meta filter), meanwhile files not smaller than head
+// (see headSkip) are hashed by headHash of head prefilter; as soon as all files are passed, files with the same
+// head checksum and different sizes are checked by prefixFunc whether smaller one is prefix of larger one
+// (each truncated file is paired with the largest file it is prefix of)
+func NewTruncationFilter(ctx context.Context,
+	inputCh <-chan FileStat,
+	headHash HashFileFunc,
+	headSkip FileSizeLesserFunc,
+	prefixFunc PrefixFunc,
+	retryPolicy workflow.RetryPolicy,
+	concurrency workflow.Concurrency) TruncationFilter {
+	ctx = cou.BuildContext(ctx, cou.SetContextOperation("3.0.truncation_init"))
+	concurrency = concurrency.WithDefaults(runtime.NumCPU(), cap(inputCh))
+	return &truncationFilter{
+		inputCh:     inputCh,
+		resCh:       make(chan FileStat, concurrency.Buffer),
+		errCh:       make(chan errs.Error, concurrency.Workers*2),
+		stats:       TruncationStats{Retries: &workflow.RetryStats{}},
+		headHash:    headHash,
+		headSkip:    headSkip,
+		prefixFunc:  prefixFunc,
+		retryPolicy: retryPolicy,
+		concurrency: concurrency,
+		heads:       make(map[string][]FileStat),
+		seen:        make(map[inodeKey]struct{}),
+	}
+}
+
+func (r *truncationFilter) Run(ctx context.Context) <-chan struct{} {
+	ctx = cou.BuildContext(ctx, cou.SetContextOperation("3.truncation"))
+	done := make(chan struct{})
+
+	go func() {
+		ctx = cou.BuildContext(ctx, cou.AddContextOperation("workers"))
+		var (
+			wg    sync.WaitGroup
+			wPool = make(chan struct{}, r.concurrency.Workers)
+		)
+		defer workflow.OnExit(ctx, r.errCh, "workers", func() {
+			wg.Wait()
+			close(wPool)
+			close(r.errCh)
+			close(done)
+		})
+		// workers are run by pool as long as ctx is not done
+		spawn := func(work func()) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case wPool <- struct{}{}:
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-wPool }()
+					work()
+				}()
+				return true
+			}
+		}
+	passing:
+		for {
+			select {
+			case <-ctx.Done():
+				close(r.resCh)
+				return
+			case fs, more := <-r.inputCh:
+				if !more {
+					break passing
+				}
+				select {
+				case <-ctx.Done():
+					close(r.resCh)
+					return
+				case r.resCh <- fs:
+				}
+				if r.headSkip(fs) || !r.checkIn(fs) {
+					continue
+				}
+				if !spawn(func() { r.hashHead(ctx, fs) }) {
+					close(r.resCh)
+					return
+				}
+			}
+		}
+		close(r.resCh) // meta filter is not blocked by comparing
+		wg.Wait()
+		for _, group := range r.candidateGroups() {
+			atomic.AddInt64(&r.stats.Counters.Groups, 1)
+			if len(group) > MaxTruncationGroupSize {
+				atomic.AddInt64(&r.stats.Counters.Skipped, 1)
+				r.report(ctx, errs.E(ctx, errs.KindOther, errs.SeverityWarning, errs.Path(group[0].Path()),
+					fmt.Errorf("%d files with the same head as [%s] are not compared for truncated copies (more than %d)", len(group), group[0].Path(), MaxTruncationGroupSize)))
+				continue
+			}
+			group := group
+			if !spawn(func() { r.compare(ctx, group) }) {
+				return
+			}
+		}
+		wg.Wait()
+		if ctx.Err() == nil {
+			r.stats.Lock()
+			r.stats.isCompleted = true
+			r.stats.Unlock()
+		}
+	}()
+	return done
+}
+
+// checkIn registers inode of file, returns false if it is already registered (hard links are checked once)
+func (r *truncationFilter) checkIn(fs FileStat) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := inodeKey{fs.Dev(), fs.Inode()}
+	if _, ok := r.seen[key]; ok {
+		return false
+	}
+	r.seen[key] = struct{}{}
+	atomic.AddInt64(&r.stats.Counters.Files, 1)
+	return true
+}
+
+func (r *truncationFilter) hashHead(ctx context.Context, fs FileStat) {
+	var checksum string
+	err := workflow.Retry(ctx, r.retryPolicy, r.stats.Retries, func() (err error) {
+		checksum, _, err = r.headHash(ctx, fs, "")
+		return
+	})
+	if err != nil {
+		r.report(ctx, errs.E(ctx, errs.KindIO, errs.Path(fs.Path()), fmt.Errorf("head hashing of [%s] failed: %w", fs.Path(), err)))
+		return
+	}
+	atomic.AddInt64(&r.stats.Counters.Hashed, 1)
+	r.mu.Lock()
+	r.heads[checksum] = append(r.heads[checksum], fs)
+	r.mu.Unlock()
+}
+
+// candidateGroups - groups of files with the same head checksum and different sizes,
+// sorted by size (descending) and priority (so that full file of truncated one is chosen by priority among equal ones)
+func (r *truncationFilter) candidateGroups() [][]FileStat {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var groups [][]FileStat
+	for _, files := range r.heads {
+		if len(files) < 2 {
+			continue
+		}
+		sort.Slice(files, func(i, j int) bool {
+			if files[i].Size() != files[j].Size() {
+				return files[i].Size() > files[j].Size()
+			}
+			return files[i].SortingKey() < files[j].SortingKey()
+		})
+		if files[0].Size() == files[len(files)-1].Size() {
+			continue
+		}
+		groups = append(groups, files)
+	}
+	r.heads = nil
+	return groups
+}
+
+// compare pairs each file of group (sorted by size descending) with the largest file it is prefix of;
+// files already paired as truncated are not compared as full ones: if file is prefix of truncated one,
+// it is prefix of the full one too, which is larger and so compared before (and vice versa)
+func (r *truncationFilter) compare(ctx context.Context, group []FileStat) {
+	truncated := make([]bool, len(group))
+	for i, short := range group {
+		for j, long := range group[:i] {
+			if long.Size() == short.Size() {
+				break // the rest are not larger
+			}
+			if truncated[j] {
+				continue
+			}
+			atomic.AddInt64(&r.stats.Counters.Compared, 1)
+			ok, err := r.prefixFunc(ctx, short, long)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				r.report(ctx, errs.E(ctx, errs.KindIO, errs.Path(short.Path()), err))
+				continue
+			}
+			if ok {
+				truncated[i] = true
+				r.stats.Lock()
+				r.stats.pairs = append(r.stats.pairs, TruncatedPair{Truncated: short, Full: long})
+				r.stats.Unlock()
+				break
+			}
+		}
+	}
+}
+
+func (r *truncationFilter) report(ctx context.Context, err errs.Error) {
+	select {
+	case <-ctx.Done():
+	case r.errCh <- err:
+	}
+}
+
+func (r *truncationFilter) OutputCh() <-chan FileStat {
+	return r.resCh
+}
+
+func (r *truncationFilter) ErrCh() <-chan errs.Error {
+	return r.errCh
+}
+
+func (r *truncationFilter) Stats() interface{} {
+	return &r.stats
+}
+
+func (r *truncationFilter) Concurrency() (string, workflow.Concurrency) {
+	return "truncation", r.concurrency
+}
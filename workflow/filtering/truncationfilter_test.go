@@ -0,0 +1,93 @@
+package filtering
+
+import (
+	"context"
+	. "github.com/nj-eka/fdups/filestat"
+	"github.com/nj-eka/fdups/workflow"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+)
+
+func TestTruncationFilter(t *testing.T) {
+	mapFS := fstest.MapFS{
+		"a": &fstest.MapFile{Data: []byte("abc")},    // prefix of b, c and d
+		"b": &fstest.MapFile{Data: []byte("abcd")},   // prefix of c
+		"c": &fstest.MapFile{Data: []byte("abcdef")}, // full of a and b
+		"d": &fstest.MapFile{Data: []byte("abXdef")}, // full of e, the same size as c
+		"e": &fstest.MapFile{Data: []byte("abX")},    // the same size as a
+		"f": &fstest.MapFile{Data: []byte("xy")},     // f and g - group of equal sizes
+		"g": &fstest.MapFile{Data: []byte("xy")},
+		"h": &fstest.MapFile{Data: []byte("a")}, // smaller than head
+	}
+	fsys := NewIOFS(mapFS)
+	names := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	files := make(map[string]FileStat)
+	for _, name := range names {
+		fileStat, err := GetFileStat(fsys, name, nil, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name] = fileStat
+	}
+	hasher, err := GetHashFileFunc(fsys, XXH64, 2, false, ReadFadvise, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hashed int64
+	headChecksums := NewHeadChecksums(func(ctx context.Context, fs FileStat, prefix string) (string, int64, error) {
+		atomic.AddInt64(&hashed, 1)
+		return hasher(ctx, fs, prefix)
+	})
+
+	ctx := context.Background()
+	inputCh := make(chan FileStat, len(names))
+	for _, name := range names {
+		inputCh <- files[name]
+	}
+	close(inputCh)
+	r := NewTruncationFilter(ctx, inputCh, headChecksums.Hash, NewFileSizeLesserFunc(2, false), GetPrefixFunc(fsys, ReadFadvise, nil), workflow.RetryPolicy{}, workflow.Concurrency{})
+	done := r.Run(ctx)
+	passed := 0
+	for range r.OutputCh() {
+		passed++
+	}
+	for err := range r.ErrCh() {
+		t.Errorf("unexpected error: %v", err)
+	}
+	<-done
+	if passed != len(names) {
+		t.Fatalf("all %d files must be passed on, got %d", len(names), passed)
+	}
+
+	stats := r.Stats().(*TruncationStats)
+	pairs, completed := stats.GetResult()
+	if !completed {
+		t.Fatal("detection is not completed")
+	}
+	expected := [][2]string{{"a", "c"}, {"b", "c"}, {"e", "d"}}
+	if len(pairs) != len(expected) {
+		t.Fatalf("expected %d pairs, got %+v", len(expected), pairs)
+	}
+	for i, pair := range pairs {
+		if pair.Truncated.Path() != expected[i][0] || pair.Full.Path() != expected[i][1] {
+			t.Errorf("pair %d: expected %s truncated of %s, got %s of %s", i, expected[i][0], expected[i][1], pair.Truncated.Path(), pair.Full.Path())
+		}
+	}
+	counters := stats.Counters.Snapshot()
+	if counters.Files != 7 || counters.Hashed != 7 || counters.Groups != 1 || counters.Skipped != 0 {
+		t.Errorf("unexpected counters: %+v", counters)
+	}
+
+	// head prefilter stage reuses checksums computed by truncation filter
+	checksum, written, err := headChecksums.Hash(ctx, files["c"], "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expectedChecksum, _, _ := hasher(ctx, files["c"], "0"); checksum != expectedChecksum || written != 0 {
+		t.Errorf("expected reused checksum %s (written 0), got %s (written %d)", expectedChecksum, checksum, written)
+	}
+	if hashed != 7 {
+		t.Errorf("each inode must be hashed once, hashed %d times", hashed)
+	}
+}
@@ -0,0 +1,267 @@
+package filtering
+
+import (
+	"context"
+	cou "github.com/nj-eka/fdups/contexts"
+	fh "github.com/nj-eka/fdups/fh"
+	. "github.com/nj-eka/fdups/filestat"
+	"github.com/nj-eka/fdups/logging"
+	"github.com/nj-eka/fdups/workflow"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// TunerSettings - settings of adaptive tuning of content filter (see Tuner)
+type TunerSettings struct {
+	// Enabled - tuning is on
+	Enabled bool
+	// Interval - how often workers of hashing stages are adjusted
+	Interval time.Duration
+	// MinSamples - number of files of size class hashed by prefilter stage before it is decided whether prefilter is worth running
+	MinSamples int
+	// MinElimination - min share of candidates prefilter has to eliminate to be worth running
+	// (used until latency of final stage for size class is known)
+	MinElimination float64
+	// MaxWorkers - upper bound of workers per stage; 0 = 4 * initial number of workers
+	MaxWorkers int
+}
+
+var DefaultTunerSettings = TunerSettings{
+	Interval:       3 * time.Second,
+	MinSamples:     128,
+	MinElimination: 0.1,
+}
+
+// Tuner - adaptive controller of content filter:
+// 1. prefilter stages (all but final) are skipped for size classes (powers of 2) where they don't pay off -
+// either share of eliminated candidates is small or expected saving of final stage hashing is less than prefilter latency;
+// decision is sticky per meta key (all files of meta group go the same way, so their checksums stay comparable);
+// 2. number of workers of each stage is adjusted by hill climbing on stage throughput (while stage is saturated).
+// Every decision is logged.
+type Tuner struct {
+	settings TunerSettings
+	stages   []*stageTuning
+}
+
+type stageTuning struct {
+	sync.Mutex
+	limiter    *workflow.Limiter
+	maxWorkers int
+	classes    map[int]*sizeClassStats
+	// skipMetaKeys - sticky decisions whether prefilter is skipped for meta key
+	skipMetaKeys map[string]bool
+	bypassed     int64
+	// hill climbing state (step is halved on each reversal of direction)
+	direction  int
+	step       int
+	prevRate   float64
+	prevInodes int
+	prevRead   int64
+	prevTime   time.Time
+}
+
+type sizeClassStats struct {
+	in, out  int
+	hashed   int
+	latency  time.Duration
+	decided  bool
+	skipping bool
+}
+
+func (s *sizeClassStats) avgLatency() time.Duration {
+	if s.hashed == 0 {
+		return 0
+	}
+	return s.latency / time.Duration(s.hashed)
+}
+
+// sizeClass - files are classified by power of 2 of their size
+func sizeClass(size int64) int {
+	return bits.Len64(uint64(size))
+}
+
+func sizeClassRange(class int) (from, to uint64) {
+	if class == 0 {
+		return 0, 1
+	}
+	return 1 << (class - 1), 1 << class
+}
+
+// NewTuner - tuner of stages with given worker limiters (nil if tuning is disabled)
+func NewTuner(settings TunerSettings, limiters []*workflow.Limiter) *Tuner {
+	if !settings.Enabled {
+		return nil
+	}
+	if settings.Interval <= 0 {
+		settings.Interval = DefaultTunerSettings.Interval
+	}
+	if settings.MinSamples <= 0 {
+		settings.MinSamples = DefaultTunerSettings.MinSamples
+	}
+	t := Tuner{settings: settings, stages: make([]*stageTuning, 0, len(limiters))}
+	for _, limiter := range limiters {
+		maxWorkers := settings.MaxWorkers
+		if maxWorkers <= 0 {
+			maxWorkers = limiter.Limit() * 4
+		}
+		t.stages = append(t.stages, &stageTuning{
+			limiter:      limiter,
+			maxWorkers:   maxWorkers,
+			classes:      make(map[int]*sizeClassStats),
+			skipMetaKeys: make(map[string]bool),
+			direction:    1,
+			step:         (limiter.Limit() + 3) / 4,
+		})
+	}
+	return &t
+}
+
+func (st *stageTuning) class(size int64) *sizeClassStats {
+	c, ok := st.classes[sizeClass(size)]
+	if !ok {
+		c = &sizeClassStats{}
+		st.classes[sizeClass(size)] = c
+	}
+	return c
+}
+
+// Skip - whether prefilter stage [index] is skipped for file (decision is made on the first file of meta key)
+func (t *Tuner) Skip(index int, fileStat FileStat) bool {
+	if index >= len(t.stages)-1 { // final stage is never skipped
+		return false
+	}
+	st := t.stages[index]
+	st.Lock()
+	defer st.Unlock()
+	skip, ok := st.skipMetaKeys[fileStat.MetaKey()]
+	if !ok {
+		skip = st.class(fileStat.Size()).skipping
+		st.skipMetaKeys[fileStat.MetaKey()] = skip
+	}
+	if skip {
+		st.bypassed++
+	}
+	return skip
+}
+
+// Hashed registers file hashed by stage [index] with latency
+func (t *Tuner) Hashed(ctx context.Context, index int, fileStat FileStat, latency time.Duration) {
+	var finalLatency time.Duration
+	if index < len(t.stages)-1 {
+		final := t.stages[len(t.stages)-1]
+		final.Lock()
+		if c, ok := final.classes[sizeClass(fileStat.Size())]; ok && c.hashed >= t.settings.MinSamples/4 {
+			finalLatency = c.avgLatency()
+		}
+		final.Unlock()
+	}
+	st := t.stages[index]
+	st.Lock()
+	defer st.Unlock()
+	c := st.class(fileStat.Size())
+	c.in++
+	c.hashed++
+	c.latency += latency
+	if index < len(t.stages)-1 && !c.decided && c.in >= t.settings.MinSamples {
+		c.decided = true
+		elimination := 1 - float64(c.out)/float64(c.in)
+		if finalLatency > 0 {
+			c.skipping = time.Duration(elimination*float64(finalLatency)) < c.avgLatency()
+		} else {
+			c.skipping = elimination < t.settings.MinElimination
+		}
+		decision := "kept"
+		if c.skipping {
+			decision = "skipped"
+		}
+		from, to := sizeClassRange(sizeClass(fileStat.Size()))
+		logging.LogMsg(ctx).Infof("tuner: prefilter stage [%d] for sizes [%s, %s) - %s: elimination %.1f%% of %d, latency %v (final stage %v)",
+			index, fh.BytesToHuman(from), fh.BytesToHuman(to), decision, elimination*100, c.in, c.avgLatency(), finalLatency)
+	}
+}
+
+// Passed registers file passed on by stage [index] (as member of group of candidates)
+func (t *Tuner) Passed(index int, fileStat FileStat) {
+	st := t.stages[index]
+	st.Lock()
+	defer st.Unlock()
+	st.class(fileStat.Size()).out++
+}
+
+// Bypassed - number of files bypassed stage [index] by tuner decision
+func (t *Tuner) Bypassed(index int) int64 {
+	st := t.stages[index]
+	st.Lock()
+	defer st.Unlock()
+	return st.bypassed
+}
+
+// Run adjusts workers of stages every Interval until ctx is done or content filter is completed
+func (t *Tuner) Run(ctx context.Context, stats *ContentFilterStats) {
+	ctx = cou.BuildContext(ctx, cou.AddContextOperation("tuner"))
+	ticker := time.NewTicker(t.settings.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if stats.IsCompleted() {
+				return
+			}
+			for index, st := range t.stages {
+				inodes, read := stats.StageInodeStats[index].GetStats()
+				t.adjustWorkers(ctx, index, st, inodes, read, now)
+			}
+		}
+	}
+}
+
+// adjustWorkers - hill climbing: workers are changed in the same direction while throughput grows,
+// direction is reversed when it drops; nothing is changed if stage is not saturated (throughput is bound by input)
+func (t *Tuner) adjustWorkers(ctx context.Context, index int, st *stageTuning, inodes int, read int64, now time.Time) {
+	prevTime := st.prevTime
+	prevInodes, prevRead := st.prevInodes, st.prevRead
+	st.prevTime, st.prevInodes, st.prevRead = now, inodes, read
+	if prevTime.IsZero() {
+		return
+	}
+	seconds := now.Sub(prevTime).Seconds()
+	// final stage reads whole files - its throughput is measured in bytes, prefilters - in files
+	rate := float64(inodes-prevInodes) / seconds
+	unit := "files/s"
+	if index == len(t.stages)-1 {
+		rate, unit = float64(read-prevRead)/seconds, "B/s"
+	}
+	prevRate := st.prevRate
+	st.prevRate = rate
+	if !st.limiter.Contended() {
+		return
+	}
+	if prevRate > 0 {
+		switch {
+		case rate < prevRate*0.95:
+			st.direction = -st.direction
+			if st.step /= 2; st.step < 1 {
+				st.step = 1
+			}
+		case rate <= prevRate*1.05: // plateau
+			return
+		}
+	}
+	limit := st.limiter.Limit()
+	newLimit := limit + st.direction*st.step
+	if newLimit < 1 {
+		newLimit = 1
+	}
+	if newLimit > st.maxWorkers {
+		newLimit = st.maxWorkers
+	}
+	if newLimit != limit {
+		st.limiter.SetLimit(newLimit)
+		logging.LogMsg(ctx).Infof("tuner: stage [%d] workers %d -> %d (throughput %.0f -> %.0f %s)", index, limit, newLimit, prevRate, rate, unit)
+	} else if limit == 1 || limit == st.maxWorkers {
+		st.direction = -st.direction // bounce off bound
+	}
+}
@@ -0,0 +1,81 @@
+package workflow
+
+import (
+	"context"
+	"sync"
+)
+
+// Limiter - semaphore with adjustable limit (e.g. max number of running workers of pipeline stage)
+type Limiter struct {
+	mu        sync.Mutex
+	limit     int
+	used      int
+	contended bool
+	// released - closed (and replaced) on each release or limit change to wake up waiting Acquire
+	released chan struct{}
+}
+
+func NewLimiter(limit int) *Limiter {
+	if limit < 1 {
+		limit = 1
+	}
+	return &Limiter{limit: limit, released: make(chan struct{})}
+}
+
+// Acquire blocks until slot is available or ctx is done (then false is returned)
+func (l *Limiter) Acquire(ctx context.Context) bool {
+	for {
+		l.mu.Lock()
+		if l.used < l.limit {
+			l.used++
+			l.mu.Unlock()
+			return true
+		}
+		l.contended = true
+		released := l.released
+		l.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return false
+		case <-released:
+		}
+	}
+}
+
+func (l *Limiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.used--
+	l.notify()
+}
+
+// SetLimit changes limit (min 1); if it is decreased, running holders are not affected
+func (l *Limiter) SetLimit(limit int) {
+	if limit < 1 {
+		limit = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.notify()
+}
+
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// Contended reports whether Acquire has waited for slot since the previous call (and resets it)
+func (l *Limiter) Contended() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	contended := l.contended
+	l.contended = false
+	return contended
+}
+
+func (l *Limiter) notify() {
+	close(l.released)
+	l.released = make(chan struct{})
+}
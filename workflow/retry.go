@@ -0,0 +1,72 @@
+package workflow
+
+import (
+	"context"
+	"github.com/nj-eka/fdups/errs"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy - how operations failed with transient errors (see errs.IsTransient) are retried
+type RetryPolicy struct {
+	// Attempts - max number of attempts (including the first one), < 2 = no retries
+	Attempts int
+	// Backoff - delay before the first retry, it is doubled on each next retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   5,
+	Backoff:    10 * time.Millisecond,
+	MaxBackoff: time.Second,
+}
+
+// RetryStats - counters of retries (safe for concurrent use)
+type RetryStats struct {
+	retries, recovered, failed int64
+}
+
+// Retries - number of retries made
+func (s *RetryStats) Retries() int64 { return atomic.LoadInt64(&s.retries) }
+
+// Recovered - number of operations succeeded after retries
+func (s *RetryStats) Recovered() int64 { return atomic.LoadInt64(&s.recovered) }
+
+// Failed - number of operations failed with transient error after all attempts
+func (s *RetryStats) Failed() int64 { return atomic.LoadInt64(&s.failed) }
+
+// Retry calls fn until it succeeds or fails with non transient error, attempts are exhausted or ctx is done;
+// returns the last error of fn
+func Retry(ctx context.Context, policy RetryPolicy, stats *RetryStats, fn func() error) error {
+	backoff := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			if attempt > 1 {
+				atomic.AddInt64(&stats.recovered, 1)
+			}
+			return nil
+		}
+		if !errs.IsTransient(err) {
+			return err
+		}
+		if attempt >= policy.Attempts {
+			if attempt > 1 {
+				atomic.AddInt64(&stats.failed, 1)
+			}
+			return err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		atomic.AddInt64(&stats.retries, 1)
+		if backoff *= 2; backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
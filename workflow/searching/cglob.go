@@ -5,9 +5,9 @@ import (
 	"fmt"
 	cou "github.com/nj-eka/fdups/contexts"
 	"github.com/nj-eka/fdups/errs"
+	"github.com/nj-eka/fdups/filestat"
 	"github.com/nj-eka/fdups/logging"
 	"github.com/nj-eka/fdups/workflow"
-	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -15,7 +15,8 @@ import (
 )
 
 // CGlob - adapted version of Glob function from standard library (without ** support) to work in concurrent mode
-func CGlob(ctx context.Context, wg *sync.WaitGroup, pattern string, cres chan<- string, cerr chan<- errs.Error) {
+// on fsys backend
+func CGlob(ctx context.Context, fsys filestat.FS, wg *sync.WaitGroup, pattern string, cres chan<- string, cerr chan<- errs.Error) {
 	ctx = cou.BuildContext(ctx, cou.AddContextOperation("CGlob"))
 	defer workflow.OnExit(ctx, cerr, fmt.Sprintf("CGlob [%s]", pattern), func() {
 		wg.Done()
@@ -28,7 +29,7 @@ func CGlob(ctx context.Context, wg *sync.WaitGroup, pattern string, cres chan<-
 		return
 	}
 	if !hasMeta(pattern) {
-		if _, err := os.Lstat(pattern); err != nil {
+		if _, err := fsys.Lstat(pattern); err != nil {
 			cerr <- errs.E(ctx, errs.KindOSStat, err) // fmt.Errorf("getting stat of [%s]: %w", pattern, err)) -> see PathError
 		} else {
 			cres <- pattern
@@ -40,29 +41,29 @@ func CGlob(ctx context.Context, wg *sync.WaitGroup, pattern string, cres chan<-
 	dir = cleanGlobPath(dir)
 	if !hasMeta(dir) {
 		// file contains meta (pattern)
-		glob(ctx, dir, file, cres, cerr)
+		glob(ctx, fsys, dir, file, cres, cerr)
 	} else {
 		// dir contains meta -> go deeper
 		// Prevent infinite recursion. See issue 15879. on Windows with patterns like `\\?\C:\*`
 		if dir == pattern {
-			cerr <- errs.E(ctx, errs.KindFileSystemOther, fmt.Errorf("infinite recursion with pattern [%s] on dir [%s] (see filepath issue 15879)", pattern, dir))
+			cerr <- errs.E(ctx, errs.KindFileSystemOther, errs.Path(dir), fmt.Errorf("infinite recursion with pattern [%s] on dir [%s] (see filepath issue 15879)", pattern, dir))
 			return
 		}
 		done := make(chan struct{})
 		go func(dir, pattern string) {
 			defer close(done)
-			dirs, err := filepath.Glob(dir) // blocking function call with long execution time (depending on number of files being processed)
+			dirs, err := fsys.Glob(dir) // blocking function call with long execution time (depending on number of files being processed)
 			select {
 			case <-ctx.Done():
 				return
 			default:
 			}
 			if err != nil {
-				cerr <- errs.E(ctx, errs.KindInvalidValue, fmt.Errorf("globbing on dir [%s]: %w", dir, err)) // ErrBadPattern
+				cerr <- errs.E(ctx, errs.KindInvalidValue, errs.Path(dir), fmt.Errorf("globbing on dir [%s]: %w", dir, err)) // ErrBadPattern
 				return
 			}
 			for _, dir := range dirs {
-				glob(ctx, dir, pattern, cres, cerr)
+				glob(ctx, fsys, dir, pattern, cres, cerr)
 			}
 		}(dir, file)
 		select {
@@ -74,34 +75,29 @@ func CGlob(ctx context.Context, wg *sync.WaitGroup, pattern string, cres chan<-
 	}
 }
 
-func glob(ctx context.Context, dir, pattern string, cres chan<- string, cerr chan<- errs.Error) {
+func glob(ctx context.Context, fsys filestat.FS, dir, pattern string, cres chan<- string, cerr chan<- errs.Error) {
 	defer workflow.OnExit(ctx, cerr, fmt.Sprintf("Glob in dir [%s] with pattern [%s]", dir, pattern), func() {
 	})
 	logging.LogMsg(ctx).Debugf(fmt.Sprintf("Glob searching in dir [%s] with pattern [%s] - started", dir, pattern))
-	fi, err := os.Stat(dir)
+	fi, err := fsys.Stat(dir)
 	if err != nil {
-		cerr <- errs.E(ctx, errs.KindOSStat, fmt.Errorf("getting stat of [%s]: %w", dir, err))
+		cerr <- errs.E(ctx, errs.KindOSStat, errs.Path(dir), fmt.Errorf("getting stat of [%s]: %w", dir, err))
 		return
 	}
 	if !fi.IsDir() {
-		cerr <- errs.E(ctx, errs.SeverityWarning, errs.KindNotDir, fmt.Errorf("[%s] is not dir", dir)) // or ignore I/O error
+		cerr <- errs.E(ctx, errs.SeverityWarning, errs.KindNotDir, errs.Path(dir), fmt.Errorf("[%s] is not dir", dir)) // or ignore I/O error
 		return
 	}
-	d, err := os.Open(dir)
+	entries, err := fsys.ReadDir(dir)
 	if err != nil {
-		cerr <- errs.E(ctx, errs.SeverityWarning, errs.KindIO, fmt.Errorf("opening [%s]: %w", dir, err)) // or ignore I/O error
+		cerr <- errs.E(ctx, errs.KindIO, errs.Path(dir), fmt.Errorf("reading [%s]: %w", dir, err))
 		return
 	}
-	defer d.Close() // open for reading
-	names, err := d.Readdirnames(-1)
-	if err != nil {
-		cerr <- errs.E(ctx, errs.KindIO, fmt.Errorf("reading [%s]: %w", dir, err))
-		return
-	}
-	for _, name := range names {
+	for _, entry := range entries {
+		name := entry.Name()
 		matched, err := filepath.Match(pattern, name)
 		if err != nil {
-			cerr <- errs.E(ctx, errs.KindInvalidValue, fmt.Errorf("matching [%s] with pattern [%s] in dir [%s] failed: %w", name, pattern, dir, err)) //  ErrBadPattern or ignore I/O error
+			cerr <- errs.E(ctx, errs.KindInvalidValue, errs.Path(dir), fmt.Errorf("matching [%s] with pattern [%s] in dir [%s] failed: %w", name, pattern, dir, err)) //  ErrBadPattern or ignore I/O error
 			continue
 		}
 		if matched {
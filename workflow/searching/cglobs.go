@@ -10,6 +10,7 @@ import (
 	"fmt"
 	cou "github.com/nj-eka/fdups/contexts"
 	"github.com/nj-eka/fdups/errs"
+	"github.com/nj-eka/fdups/filestat"
 	"github.com/nj-eka/fdups/logging"
 	"github.com/nj-eka/fdups/registrator"
 	"github.com/nj-eka/fdups/workflow"
@@ -21,8 +22,8 @@ import (
 
 type Globs []string
 
-// CExpand is concurrent extention of standard Glob function with support **.
-func (globs Globs) CExpand(ctx context.Context, wg *sync.WaitGroup, cres chan<- string, cerr chan<- errs.Error) {
+// CExpand is concurrent extention of standard Glob function with support ** (on fsys backend).
+func (globs Globs) CExpand(ctx context.Context, fsys filestat.FS, wg *sync.WaitGroup, cres chan<- string, cerr chan<- errs.Error) {
 	ctx = cou.BuildContext(ctx, cou.AddContextOperation("CGlobs"))
 	defer workflow.OnExit(ctx, cerr, fmt.Sprintf("CGlobs [%s]", globs), func() {
 		wg.Done()
@@ -37,7 +38,7 @@ func (globs Globs) CExpand(ctx context.Context, wg *sync.WaitGroup, cres chan<-
 		var hits []string
 		var hitMap = map[string]bool{}
 		for _, match := range matches {
-			paths, err := fp.Glob(strings.TrimRight(match+glob, string(fp.Separator)))
+			paths, err := fsys.Glob(strings.TrimRight(match+glob, string(fp.Separator)))
 			select {
 			case <-ctx.Done():
 				return
@@ -48,7 +49,7 @@ func (globs Globs) CExpand(ctx context.Context, wg *sync.WaitGroup, cres chan<-
 				return
 			}
 			for _, path := range paths {
-				err := fp.WalkDir(path,
+				err := filestat.WalkDir(fsys, path,
 					func(path string, d fs.DirEntry, err error) error {
 						if err == nil && d != nil {
 							if d.IsDir() {
@@ -72,7 +73,7 @@ func (globs Globs) CExpand(ctx context.Context, wg *sync.WaitGroup, cres chan<-
 						return nil
 					})
 				if err != nil {
-					cerr <- errs.E(ctx, errs.KindFileSystemOther, fmt.Errorf("walking dir [%s]: %w", path, err))
+					cerr <- errs.E(ctx, errs.KindFileSystemOther, errs.Path(path), fmt.Errorf("walking dir [%s]: %w", path, err))
 				}
 			}
 		}
@@ -4,6 +4,7 @@ import (
 	"context"
 	cou "github.com/nj-eka/fdups/contexts"
 	"github.com/nj-eka/fdups/errs"
+	"github.com/nj-eka/fdups/filestat"
 	"github.com/nj-eka/fdups/logging"
 	"github.com/nj-eka/fdups/registrator"
 	"github.com/nj-eka/fdups/workflow"
@@ -22,20 +23,28 @@ type Searcher interface {
 }
 
 type searcher struct {
-	patterns []string
-	resCh    chan string
-	errCh    chan errs.Error
-	stats    SearcherStats
+	fsys        filestat.FS
+	patterns    []string
+	resCh       chan string
+	errCh       chan errs.Error
+	stats       SearcherStats
+	concurrency workflow.Concurrency
 }
 
-func NewSearcher(ctx context.Context, roots []string, filePatterns []string, initCap int) Searcher {
+// NewSearcher - each pattern in each root is searched by its own worker (so concurrency.Workers is ignored),
+// found paths buffer is number of patterns by default
+func NewSearcher(ctx context.Context, fsys filestat.FS, roots []string, filePatterns []string, concurrency workflow.Concurrency, initCap int) Searcher {
 	ctx = cou.BuildContext(ctx, cou.SetContextOperation("1.0.search_init"))
 	patternsCount := len(roots) * len(filePatterns) // = maxWorkers
+	concurrency.Workers = 0
+	concurrency = concurrency.WithDefaults(patternsCount, patternsCount)
 	sr := searcher{
-		patterns: make([]string, 0, patternsCount),
-		resCh:    make(chan string, patternsCount),
-		errCh:    make(chan errs.Error, patternsCount*2),
-		stats:    SearcherStats(registrator.NewEncounter(initCap)),
+		fsys:        fsys,
+		patterns:    make([]string, 0, patternsCount),
+		resCh:       make(chan string, concurrency.Buffer),
+		errCh:       make(chan errs.Error, patternsCount*2),
+		stats:       SearcherStats(registrator.NewEncounter(initCap)),
+		concurrency: concurrency,
 	}
 	for _, rootDir := range roots {
 		for _, filePattern := range filePatterns {
@@ -56,10 +65,10 @@ func (r *searcher) Run(ctx context.Context) <-chan struct{} {
 		// todo: merge globs
 		if !strings.Contains(pattern, "**") {
 			wg.Add(1)
-			go CGlob(ctx, &wg, pattern, draftCh, r.errCh)
+			go CGlob(ctx, r.fsys, &wg, pattern, draftCh, r.errCh)
 		} else {
 			wg.Add(1)
-			go Globs(strings.Split(pattern, "**")).CExpand(ctx, &wg, draftCh, r.errCh)
+			go Globs(strings.Split(pattern, "**")).CExpand(ctx, r.fsys, &wg, draftCh, r.errCh)
 		}
 	}
 
@@ -93,9 +102,7 @@ func (r *searcher) Run(ctx context.Context) <-chan struct{} {
 					select {
 					case <-ctx.Done():
 						return
-					case <-done:
-						return
-					case r.resCh <- path:
+					case r.resCh <- path: // draftCh is closed after done, so all found paths are passed on
 					}
 				}
 			}
@@ -115,3 +122,7 @@ func (r *searcher) ErrCh() <-chan errs.Error {
 func (r *searcher) Stats() interface{} {
 	return r.stats
 }
+
+func (r *searcher) Concurrency() (string, workflow.Concurrency) {
+	return "search", r.concurrency
+}
@@ -14,6 +14,8 @@ import (
 
 type ValidatorStats struct {
 	FileStats, InodeStats registrator.Encounter
+	// Retries - retries of FileStat creation failed with transient errors
+	Retries *workflow.RetryStats
 }
 
 type Validator interface {
@@ -29,35 +31,47 @@ type validator struct {
 	errCh   chan errs.Error
 	stats   ValidatorStats
 
+	fsys           FS
 	metaKeyFunc    MetaKeyFunc
 	priorFunc      PriorFunc
 	validatorFunc  FileStatValidatorFunc
 	symLinkEnabled bool
-	maxWorkers     int
+	retryPolicy    workflow.RetryPolicy
+	concurrency    workflow.Concurrency
 }
 
 func NewValidator(ctx context.Context,
+	fsys FS,
 	inputCh <-chan string,
 	metaKeyFunc MetaKeyFunc,
 	priorFunc PriorFunc,
 	validatorFunc FileStatValidatorFunc,
 	symLinkEnabled bool,
+	retryPolicy workflow.RetryPolicy,
+	concurrency workflow.Concurrency,
 	initCap int) Validator {
 	ctx = cou.BuildContext(ctx, cou.SetContextOperation("2.0.validation_init"))
 	maxWorkers := cap(inputCh) * runtime.NumCPU()
+	if concurrency.Workers > 0 {
+		maxWorkers = concurrency.Workers
+	}
+	concurrency = concurrency.WithDefaults(maxWorkers, maxWorkers)
 	v := validator{
 		inputCh: inputCh,
-		resCh:   make(chan FileStat, maxWorkers),
-		errCh:   make(chan errs.Error, maxWorkers*2),
+		resCh:   make(chan FileStat, concurrency.Buffer),
+		errCh:   make(chan errs.Error, concurrency.Workers*2),
 		stats: ValidatorStats{
 			FileStats:  registrator.NewEncounter(initCap),
 			InodeStats: registrator.NewEncounter(initCap),
+			Retries:    &workflow.RetryStats{},
 		},
+		fsys:           fsys,
 		metaKeyFunc:    metaKeyFunc,
 		priorFunc:      priorFunc,
 		validatorFunc:  validatorFunc,
 		symLinkEnabled: symLinkEnabled,
-		maxWorkers:     maxWorkers,
+		retryPolicy:    retryPolicy,
+		concurrency:    concurrency,
 	}
 	return &v
 }
@@ -70,7 +84,7 @@ func (r *validator) Run(ctx context.Context) <-chan struct{} {
 		ctx = cou.BuildContext(ctx, cou.AddContextOperation("workers"))
 		var (
 			wg    sync.WaitGroup
-			wPool = make(chan struct{}, r.maxWorkers)
+			wPool = make(chan struct{}, r.concurrency.Workers)
 		)
 		defer workflow.OnExit(ctx, r.errCh, "workers", func() {
 			wg.Wait()
@@ -96,7 +110,12 @@ func (r *validator) Run(ctx context.Context) <-chan struct{} {
 					go func(filePath string) {
 						defer wg.Done()
 						defer func() { <-wPool }()
-						if fs, err := GetFileStat(filePath, r.metaKeyFunc, r.priorFunc, r.symLinkEnabled); err == nil {
+						var fs FileStat
+						err := workflow.Retry(ctx, r.retryPolicy, r.stats.Retries, func() (err error) {
+							fs, err = GetFileStat(r.fsys, filePath, r.metaKeyFunc, r.priorFunc, r.symLinkEnabled)
+							return
+						})
+						if err == nil {
 							if r.validatorFunc(fs) {
 								select {
 								case <-ctx.Done():
@@ -107,7 +126,7 @@ func (r *validator) Run(ctx context.Context) <-chan struct{} {
 								}
 							}
 						} else {
-							r.errCh <- errs.E(ctx, errs.KindFileStat, fmt.Errorf("creating FileStat of [%s] failed: %w", filePath, err))
+							r.errCh <- errs.E(ctx, errs.KindFileStat, errs.Path(filePath), fmt.Errorf("creating FileStat of [%s] failed: %w", filePath, err))
 						}
 					}(filePath)
 
@@ -129,3 +148,7 @@ func (r *validator) ErrCh() <-chan errs.Error {
 func (r *validator) Stats() interface{} {
 	return &r.stats
 }
+
+func (r *validator) Concurrency() (string, workflow.Concurrency) {
+	return "validation", r.concurrency
+}